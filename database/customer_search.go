@@ -0,0 +1,88 @@
+package database
+
+import (
+	"log"
+	"temp_kbtg_backend/models"
+)
+
+// CustomerSearchIndex reports whether the customers_fts full-text index is
+// available. It needs SQLite built with FTS5, which go-sqlite3 only
+// includes with the sqlite_fts5 build tag; without it customer search
+// falls back to scanning the customers table.
+var CustomerSearchIndex bool
+
+// customerSearchTriggers keep customers_fts in step with the customers table
+var customerSearchTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS customers_fts_insert AFTER INSERT ON customers BEGIN
+		INSERT INTO customers_fts(rowid, name, email, phone_normalized)
+		VALUES (new.id, new.name, new.email, new.phone_normalized);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS customers_fts_delete AFTER DELETE ON customers BEGIN
+		INSERT INTO customers_fts(customers_fts, rowid, name, email, phone_normalized)
+		VALUES ('delete', old.id, old.name, old.email, old.phone_normalized);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS customers_fts_update AFTER UPDATE ON customers BEGIN
+		INSERT INTO customers_fts(customers_fts, rowid, name, email, phone_normalized)
+		VALUES ('delete', old.id, old.name, old.email, old.phone_normalized);
+		INSERT INTO customers_fts(rowid, name, email, phone_normalized)
+		VALUES (new.id, new.name, new.email, new.phone_normalized);
+	END`,
+}
+
+// customerSearchTriggerNames are the names of customerSearchTriggers
+var customerSearchTriggerNames = []string{"customers_fts_insert", "customers_fts_delete", "customers_fts_update"}
+
+// checkCustomerSearch works out whether the search index can be used. It
+// runs before migrating, because triggers left by a build with FTS5 make
+// every statement touching the customers table fail without it.
+func checkCustomerSearch() {
+	var enabled int
+	DB.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled)
+	CustomerSearchIndex = enabled == 1
+	if CustomerSearchIndex {
+		return
+	}
+
+	log.Println("SQLite was built without FTS5; customer search scans the customers table (build with -tags sqlite_fts5)")
+	for _, trigger := range customerSearchTriggerNames {
+		if err := DB.Exec("DROP TRIGGER IF EXISTS " + trigger).Error; err != nil {
+			log.Fatal("Failed to drop customer search triggers:", err)
+		}
+	}
+}
+
+// setupCustomerSearch normalizes the phone numbers of existing customers and
+// builds the search index. The trigram tokenizer indexes every three
+// characters, so names match on any part of them, including Thai names,
+// which are written without spaces between words.
+func setupCustomerSearch() {
+	var customers []models.Customer
+	if err := DB.Where("phone <> '' AND (phone_normalized IS NULL OR phone_normalized = '')").
+		Find(&customers).Error; err != nil {
+		log.Fatal("Failed to fetch customer phone numbers:", err)
+	}
+	for _, customer := range customers {
+		if err := DB.Model(&customer).UpdateColumn("phone_normalized", models.NormalizePhone(customer.Phone)).Error; err != nil {
+			log.Fatal("Failed to normalize customer phone numbers:", err)
+		}
+	}
+
+	if !CustomerSearchIndex {
+		return
+	}
+
+	if err := DB.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS customers_fts USING fts5(
+		name, email, phone_normalized,
+		content='customers', content_rowid='id', tokenize='trigram')`).Error; err != nil {
+		log.Fatal("Failed to create customer search index:", err)
+	}
+	for _, trigger := range customerSearchTriggers {
+		if err := DB.Exec(trigger).Error; err != nil {
+			log.Fatal("Failed to create customer search triggers:", err)
+		}
+	}
+	// Picks up customers written while the index was not maintained
+	if err := DB.Exec("INSERT INTO customers_fts(customers_fts) VALUES ('rebuild')").Error; err != nil {
+		log.Fatal("Failed to build customer search index:", err)
+	}
+}
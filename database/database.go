@@ -1,8 +1,11 @@
 package database
 
 import (
+	"fmt"
 	"log"
+	"strings"
 	"temp_kbtg_backend/models"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -25,20 +28,352 @@ func InitDatabase() {
 
 	log.Println("Database connected successfully")
 
+	// Columns AutoMigrate is about to add to existing tables are backfilled below
+	var backfills []columnBackfill
+	for _, b := range columnBackfills {
+		if DB.Migrator().HasTable(b.Model) && !DB.Migrator().HasColumn(b.Model, b.Column) {
+			backfills = append(backfills, b)
+		}
+	}
+
+	checkCustomerSearch()
+
+	clearExtraDefaultAddresses()
+	migrateCheckConstraints()
+	addUniqueColumns()
+
 	// Auto migrate all models
-	err = DB.AutoMigrate(
-		&models.Customer{},
-		&models.DeliveryAddress{},
-		&models.Order{},
-		&models.LineItem{},
-		&models.User{},
-		&models.Transfer{},
-		&models.PointLedger{},
-	)
+	err = DB.AutoMigrate(MigratedModels...)
 
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	migrateMoneyColumns()
+
+	for _, b := range backfills {
+		if err := DB.Exec(b.SQL).Error; err != nil {
+			log.Fatalf("Failed to backfill %s: %v", b.Column, err)
+		}
+	}
+
+	migrateOrderStatuses()
+	normalizeTimes()
+
+	setupCustomerSearch()
+
 	log.Println("Database migration completed")
+
+	seedDatabase()
+}
+
+// MigratedModels are the models whose tables AutoMigrate maintains
+var MigratedModels = []interface{}{
+	&models.Customer{},
+	&models.DeliveryAddress{},
+	&models.CustomerMerge{},
+	&models.Order{},
+	&models.OrderPayment{},
+	&models.OrderStatusHistory{},
+	&models.LineItem{},
+	&models.Product{},
+	&models.Coupon{},
+	&models.OrderCoupon{},
+	&models.OrderDiscount{},
+	&models.TaxRule{},
+	&models.Invoice{},
+	&models.InvoiceLine{},
+	&models.InvoiceDiscount{},
+	&models.DocumentSequence{},
+	&models.Shipment{},
+	&models.ShipmentItem{},
+	&models.ShipmentEvent{},
+	&models.OrderReturn{},
+	&models.ReturnItem{},
+	&models.Cart{},
+	&models.CartItem{},
+	&models.CartCoupon{},
+	&models.User{},
+	&models.Transfer{},
+	&models.PointLedger{},
+	&models.Dispute{},
+	&models.DisputeNote{},
+	&models.SplitBill{},
+	&models.SplitParticipant{},
+	&models.PaymentCode{},
+	&models.PointType{},
+	&models.Wallet{},
+	&models.ExchangeRate{},
+	&models.EarnRule{},
+	&models.EarnRuleCategory{},
+	&models.Tier{},
+	&models.UserTierHistory{},
+	&models.Campaign{},
+	&models.CampaignMember{},
+	&models.CampaignAward{},
+	&models.ReferralConfig{},
+	&models.Referral{},
+	&models.VoucherBatch{},
+	&models.Voucher{},
+	&models.VoucherRedemption{},
+}
+
+// clearExtraDefaultAddresses leaves each customer at most one default
+// delivery address, the one added last, so that the unique index allowing
+// only one can be created
+func clearExtraDefaultAddresses() {
+	if !DB.Migrator().HasTable(&models.DeliveryAddress{}) ||
+		DB.Migrator().HasIndex(&models.DeliveryAddress{}, "idx_delivery_addresses_default") {
+		return
+	}
+
+	result := DB.Exec(`UPDATE delivery_addresses SET is_default = false
+		WHERE is_default AND id NOT IN (
+			SELECT MAX(id) FROM delivery_addresses WHERE is_default GROUP BY customer_id)`)
+	if result.Error != nil {
+		log.Fatal("Failed to clear extra default addresses:", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Cleared %d extra default delivery addresses", result.RowsAffected)
+	}
+}
+
+// migrateCheckConstraints rebuilds tables whose CHECK constraints changed
+// since they were created, e.g. to allow new ledger event types. AutoMigrate
+// only adds missing constraints, and SQLite cannot alter one in place. The
+// rebuild drops the table's indexes, so it runs before AutoMigrate recreates
+// them.
+func migrateCheckConstraints() {
+	for _, model := range MigratedModels {
+		if !DB.Migrator().HasTable(model) {
+			continue
+		}
+
+		stmt := &gorm.Statement{DB: DB}
+		if err := stmt.Parse(model); err != nil {
+			log.Fatal("Failed to parse model:", err)
+		}
+		var createSQL string
+		if err := DB.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", stmt.Table).
+			Scan(&createSQL).Error; err != nil {
+			log.Fatal("Failed to read table definition:", err)
+		}
+
+		for name, chk := range stmt.Schema.ParseCheckConstraints() {
+			if !DB.Migrator().HasConstraint(model, name) || strings.Contains(createSQL, chk.Constraint) {
+				continue
+			}
+			if err := DB.Migrator().CreateConstraint(model, name); err != nil {
+				log.Fatalf("Failed to update constraint %s: %v", name, err)
+			}
+			log.Printf("Rebuilt %s with the new %s constraint", stmt.Table, name)
+		}
+	}
+}
+
+// addUniqueColumns adds the unique columns AutoMigrate is about to add to
+// existing tables, e.g. users.referral_code. SQLite cannot add a UNIQUE
+// column, so the column is added plain and made unique by its index.
+func addUniqueColumns() {
+	for _, model := range MigratedModels {
+		if !DB.Migrator().HasTable(model) {
+			continue
+		}
+
+		stmt := &gorm.Statement{DB: DB}
+		if err := stmt.Parse(model); err != nil {
+			log.Fatal("Failed to parse model:", err)
+		}
+		for _, idx := range stmt.Schema.ParseIndexes() {
+			if idx.Class != "UNIQUE" || len(idx.Fields) != 1 {
+				continue
+			}
+			field := idx.Fields[0].Field
+			if DB.Migrator().HasColumn(model, field.DBName) {
+				continue
+			}
+
+			if err := DB.Exec(fmt.Sprintf("ALTER TABLE `%s` ADD `%s` %s",
+				stmt.Table, field.DBName, DB.Dialector.DataTypeOf(field))).Error; err != nil {
+				log.Fatalf("Failed to add %s.%s: %v", stmt.Table, field.DBName, err)
+			}
+			if err := DB.Migrator().CreateIndex(model, idx.Name); err != nil {
+				log.Fatalf("Failed to create index %s: %v", idx.Name, err)
+			}
+		}
+	}
+}
+
+// columnBackfill fills a newly added column of existing rows
+type columnBackfill struct {
+	Model  interface{}
+	Column string
+	SQL    string
+}
+
+// columnBackfills give rows created before a column existed the value it
+// would have had. Each runs once, when AutoMigrate adds the column.
+var columnBackfills = []columnBackfill{
+	{&models.Order{}, "subtotal_minor", "UPDATE orders SET subtotal_minor = total_price_minor"},
+	{&models.Order{}, "net_total_minor", "UPDATE orders SET net_total_minor = total_price_minor"},
+	{&models.LineItem{}, "net_minor", "UPDATE line_items SET net_minor = total_price_minor"},
+}
+
+// legacyMoneyColumns maps the float money columns of older databases onto
+// the integer minor-unit columns that replaced them
+var legacyMoneyColumns = []struct {
+	Table, From, To string
+}{
+	{"orders", "total_price", "total_price_minor"},
+	{"order_payments", "amount", "amount_minor"},
+	{"line_items", "unit_price", "unit_price_minor"},
+	{"line_items", "total_price", "total_price_minor"},
+	{"earn_rules", "min_spend", "min_spend_minor"},
+	{"campaigns", "min_order_total", "min_order_total_minor"},
+}
+
+// migrateMoneyColumns copies amounts from legacy float columns into their
+// minor-unit columns, rounded to the nearest satang, and drops the old columns
+func migrateMoneyColumns() {
+	for _, col := range legacyMoneyColumns {
+		if !DB.Migrator().HasColumn(col.Table, col.From) {
+			continue
+		}
+
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(fmt.Sprintf(
+				"UPDATE %s SET %s = CAST(ROUND(%s * 100) AS INTEGER) WHERE %s IS NOT NULL",
+				col.Table, col.To, col.From, col.From)).Error; err != nil {
+				return err
+			}
+			return tx.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", col.Table, col.From)).Error
+		})
+		if err != nil {
+			log.Fatalf("Failed to migrate %s.%s: %v", col.Table, col.From, err)
+		}
+		log.Printf("Migrated %s.%s to %s", col.Table, col.From, col.To)
+	}
+}
+
+// orderStatuses are the statuses of the order lifecycle
+var orderStatuses = []string{"pending", "processing", "shipped", "delivered", "cancelled"}
+
+// orderStatusAliases map statuses that clients could set before the order
+// lifecycle existed onto their lifecycle status
+var orderStatusAliases = map[string]string{
+	"completed": "delivered",
+	"complete":  "delivered",
+	"canceled":  "cancelled",
+}
+
+// migrateOrderStatuses moves orders whose status is not part of the order
+// lifecycle onto it, so they can still be transitioned. Statuses differing
+// only in case or spacing, and known aliases, map to their lifecycle status;
+// anything else restarts at pending. Each change is recorded in the order's
+// status history; no side effects such as invoicing are applied.
+func migrateOrderStatuses() {
+	var orders []models.Order
+	if err := DB.Select("id", "status").Where("status IS NULL OR status NOT IN ?", orderStatuses).
+		Find(&orders).Error; err != nil {
+		log.Fatal("Failed to fetch order statuses:", err)
+	}
+
+	for _, order := range orders {
+		status := strings.ToLower(strings.TrimSpace(order.Status))
+		if alias, ok := orderStatusAliases[status]; ok {
+			status = alias
+		}
+		known := false
+		for _, s := range orderStatuses {
+			known = known || s == status
+		}
+		if !known {
+			status = "pending"
+		}
+
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.Order{}).Where("id = ?", order.ID).
+				UpdateColumn("status", status).Error; err != nil {
+				return err
+			}
+			return tx.Create(&models.OrderStatusHistory{
+				OrderID:    order.ID,
+				FromStatus: order.Status,
+				ToStatus:   status,
+				Actor:      "system",
+				Reason:     "Migrated to the order lifecycle",
+			}).Error
+		})
+		if err != nil {
+			log.Fatalf("Failed to migrate the status of order %d: %v", order.ID, err)
+		}
+		log.Printf("Migrated order %d from status %q to %s", order.ID, order.Status, status)
+	}
+}
+
+// utcTimeColumns are the times clients send that are compared in SQL, e.g.
+// to find running campaigns. The SQLite driver stores times as text with
+// their UTC offset, so they only compare correctly when all are in UTC.
+var utcTimeColumns = []struct {
+	Table, Column string
+}{
+	{"orders", "order_date"},
+	{"campaigns", "starts_at"},
+	{"campaigns", "ends_at"},
+	{"voucher_batches", "expires_at"},
+	{"vouchers", "expires_at"},
+}
+
+// normalizeTimes moves the utcTimeColumns stored with a UTC offset other
+// than zero to UTC
+func normalizeTimes() {
+	for _, col := range utcTimeColumns {
+		var rows []struct {
+			ID    uint
+			Value time.Time
+		}
+		if err := DB.Table(col.Table).Select("id", col.Column+" AS value").
+			Where(col.Column+" NOT LIKE ?", "%+00:00").Scan(&rows).Error; err != nil {
+			log.Fatalf("Failed to fetch %s.%s: %v", col.Table, col.Column, err)
+		}
+
+		for _, row := range rows {
+			if err := DB.Table(col.Table).Where("id = ?", row.ID).
+				UpdateColumn(col.Column, row.Value.UTC()).Error; err != nil {
+				log.Fatalf("Failed to normalize %s.%s of row %d: %v", col.Table, col.Column, row.ID, err)
+			}
+		}
+		if len(rows) > 0 {
+			log.Printf("Normalized %s.%s of %d rows to UTC", col.Table, col.Column, len(rows))
+		}
+	}
+}
+
+// seedDatabase inserts the reference data the application expects to exist
+func seedDatabase() {
+	defaultPointType := models.PointType{Code: models.DefaultPointType, Name: "Points"}
+	if err := DB.Where("code = ?", defaultPointType.Code).FirstOrCreate(&defaultPointType).Error; err != nil {
+		log.Fatal("Failed to seed point types:", err)
+	}
+
+	tiers := []models.Tier{
+		{Code: "silver", Name: "Silver", Rank: 1, EarnMultiplier: 1, DailyTransferLimit: 10000},
+		{Code: "gold", Name: "Gold", Rank: 2, MinPointsEarned: 5000, MinOrders: 12, EarnMultiplier: 1.25, DailyTransferLimit: 50000},
+		{Code: "platinum", Name: "Platinum", Rank: 3, MinPointsEarned: 20000, MinOrders: 36, EarnMultiplier: 1.5},
+	}
+	for _, tier := range tiers {
+		if err := DB.Where("code = ?", tier.Code).FirstOrCreate(&tier).Error; err != nil {
+			log.Fatal("Failed to seed tiers:", err)
+		}
+	}
+
+	vat := models.TaxRule{Country: "TH", Name: "VAT", Rate: 7, PricesIncludeTax: true, Active: true}
+	if err := DB.Where("country = ?", vat.Country).FirstOrCreate(&vat).Error; err != nil {
+		log.Fatal("Failed to seed tax rules:", err)
+	}
+
+	referralConfig := models.ReferralConfig{PointType: models.DefaultPointType, ReferrerPoints: 100, RefereePoints: 50, Active: true}
+	if err := DB.FirstOrCreate(&referralConfig).Error; err != nil {
+		log.Fatal("Failed to seed referral config:", err)
+	}
 }
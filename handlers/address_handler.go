@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// postalCodeFormats are the postal code formats of the countries we ship to,
+// keyed by ISO 3166-1 alpha-2 code. Other countries are not validated.
+var postalCodeFormats = map[string]*regexp.Regexp{
+	"TH": regexp.MustCompile(`^\d{5}$`),
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+	"GB": regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`),
+	"JP": regexp.MustCompile(`^\d{3}-?\d{4}$`),
+	"SG": regexp.MustCompile(`^\d{6}$`),
+	"MY": regexp.MustCompile(`^\d{5}$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"AU": regexp.MustCompile(`^\d{4}$`),
+	"CA": regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`),
+}
+
+// countryNames maps common country names onto their ISO codes
+var countryNames = map[string]string{
+	"THAILAND":       "TH",
+	"UNITED STATES":  "US",
+	"USA":            "US",
+	"UNITED KINGDOM": "GB",
+	"UK":             "GB",
+	"JAPAN":          "JP",
+	"SINGAPORE":      "SG",
+	"MALAYSIA":       "MY",
+	"GERMANY":        "DE",
+	"AUSTRALIA":      "AU",
+	"CANADA":         "CA",
+}
+
+// GetCustomerAddresses returns a customer's delivery addresses, default first
+func GetCustomerAddresses(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var customer models.Customer
+
+	if err := database.DB.First(&customer, id).Error; err != nil {
+		return customerNotFound(c, id)
+	}
+
+	var addresses []models.DeliveryAddress
+	if err := database.DB.Where("customer_id = ?", customer.ID).
+		Order("is_default DESC, id ASC").
+		Find(&addresses).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch addresses",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    addresses,
+	})
+}
+
+// CreateCustomerAddress adds a delivery address. A customer's first address
+// becomes their default.
+func CreateCustomerAddress(c *fiber.Ctx) error {
+	id := c.Params("id")
+	address := new(models.DeliveryAddress)
+
+	if err := c.BodyParser(address); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var customer models.Customer
+		if err := tx.First(&customer, id).Error; err != nil {
+			return newRequestError(404, "Customer not found")
+		}
+
+		address.ID = 0
+		address.CustomerID = customer.ID
+		if err := validateAddress(address); err != nil {
+			return err
+		}
+
+		var existing int64
+		if err := tx.Model(&models.DeliveryAddress{}).Where("customer_id = ?", customer.ID).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing == 0 {
+			address.IsDefault = true
+		}
+
+		makeDefault := address.IsDefault
+		address.IsDefault = false
+		if err := tx.Create(address).Error; err != nil {
+			return err
+		}
+		if makeDefault {
+			return setDefaultAddress(tx, address)
+		}
+		return nil
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to create address")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    address,
+	})
+}
+
+// UpdateCustomerAddress updates a delivery address. Setting is_default moves
+// the default from the customer's current default address.
+func UpdateCustomerAddress(c *fiber.Ctx) error {
+	id := c.Params("id")
+	addressID := c.Params("addressId")
+	var address models.DeliveryAddress
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND customer_id = ?", addressID, id).First(&address).Error; err != nil {
+			return newRequestError(404, "Address not found")
+		}
+
+		key, customerID, wasDefault := address.ID, address.CustomerID, address.IsDefault
+		if err := c.BodyParser(&address); err != nil {
+			return newRequestError(400, "Invalid request body")
+		}
+		address.ID, address.CustomerID = key, customerID
+
+		if err := validateAddress(&address); err != nil {
+			return err
+		}
+		if wasDefault && !address.IsDefault {
+			return newRequestError(400, "A customer must have a default address; make another address the default instead")
+		}
+
+		makeDefault := address.IsDefault && !wasDefault
+		address.IsDefault = wasDefault
+		if err := tx.Save(&address).Error; err != nil {
+			return err
+		}
+		if makeDefault {
+			return setDefaultAddress(tx, &address)
+		}
+		return nil
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to update address")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    address,
+	})
+}
+
+// DeleteCustomerAddress deletes a delivery address. If it was the default,
+// the customer's oldest remaining address becomes the default.
+func DeleteCustomerAddress(c *fiber.Ctx) error {
+	id := c.Params("id")
+	addressID := c.Params("addressId")
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var address models.DeliveryAddress
+		if err := tx.Where("id = ? AND customer_id = ?", addressID, id).First(&address).Error; err != nil {
+			return newRequestError(404, "Address not found")
+		}
+		if err := tx.Delete(&address).Error; err != nil {
+			return err
+		}
+		if !address.IsDefault {
+			return nil
+		}
+
+		var next models.DeliveryAddress
+		if err := tx.Where("customer_id = ?", address.CustomerID).Order("id ASC").First(&next).Error; err != nil {
+			return nil // No addresses left
+		}
+		return setDefaultAddress(tx, &next)
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to delete address")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Address deleted successfully",
+	})
+}
+
+// setDefaultAddress makes address the customer's only default address. The
+// old default is cleared first so the unique index never sees two.
+func setDefaultAddress(tx *gorm.DB, address *models.DeliveryAddress) error {
+	if err := tx.Model(&models.DeliveryAddress{}).
+		Where("customer_id = ? AND is_default = ?", address.CustomerID, true).
+		Update("is_default", false).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(address).Update("is_default", true).Error; err != nil {
+		return err
+	}
+	address.IsDefault = true
+	return nil
+}
+
+// validateAddress checks the required fields and, for countries with a
+// known format, the postal code
+func validateAddress(address *models.DeliveryAddress) error {
+	address.Address = strings.TrimSpace(address.Address)
+	address.PostalCode = strings.ToUpper(strings.TrimSpace(address.PostalCode))
+	if address.Address == "" {
+		return newRequestError(400, "Address is required")
+	}
+
+	country := countryCode(address.Country)
+	format, ok := postalCodeFormats[country]
+	if !ok {
+		return nil
+	}
+	if !format.MatchString(address.PostalCode) {
+		return newRequestError(400, fmt.Sprintf("Invalid postal code %q for country %s", address.PostalCode, country))
+	}
+	return nil
+}
+
+// countryCode returns the ISO code for a country given as a code or a name
+func countryCode(country string) string {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if code, ok := countryNames[country]; ok {
+		return code
+	}
+	return country
+}
+
+// snapshotOrderAddress copies the order's delivery address onto the order.
+// Without a delivery_address_id the customer's default address is used.
+func snapshotOrderAddress(tx *gorm.DB, order *models.Order) error {
+	var address models.DeliveryAddress
+	if order.DeliveryAddressID != nil {
+		if err := tx.Where("id = ? AND customer_id = ?", *order.DeliveryAddressID, order.CustomerID).
+			First(&address).Error; err != nil {
+			return newRequestError(400, "Delivery address not found for this customer")
+		}
+	} else if err := tx.Where("customer_id = ? AND is_default = ?", order.CustomerID, true).
+		First(&address).Error; err != nil {
+		return nil // Customer has no addresses yet
+	}
+
+	order.DeliveryAddressID = &address.ID
+	order.ShippingAddress = models.AddressSnapshot{
+		Address:    address.Address,
+		City:       address.City,
+		PostalCode: address.PostalCode,
+		Country:    address.Country,
+	}
+	return nil
+}
@@ -0,0 +1,505 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// CampaignRequest represents the request body for creating or updating a campaign
+type CampaignRequest struct {
+	Name             string       `json:"name"`
+	Type             string       `json:"type"` // order_multiplier, first_transfer or segment_bonus
+	PointType        string       `json:"point_type"`
+	Multiplier       float64      `json:"multiplier"`
+	BonusPoints      int          `json:"bonus_points"`
+	StartsAt         time.Time    `json:"starts_at"`
+	EndsAt           time.Time    `json:"ends_at"`
+	Active           *bool        `json:"active"`
+	MinOrderTotal    models.Money `json:"min_order_total"`
+	Tiers            []string     `json:"tiers"`
+	MaxAwardsPerUser int          `json:"max_awards_per_user"`
+	BudgetPoints     int          `json:"budget_points"`
+	UserIDs          []uint       `json:"user_ids"` // Segment members; empty = every user
+}
+
+// campaignEvent is an earn event that campaigns are evaluated against
+type campaignEvent struct {
+	Trigger    string // "order" or "transfer"
+	UserID     uint
+	OrderID    *uint
+	TransferID *uint
+	OrderTotal models.Money
+	Earned     map[string]int // Points the order earned per point type
+}
+
+// CampaignReport summarises what a campaign has paid out
+type CampaignReport struct {
+	CampaignID      uint   `json:"campaign_id"`
+	Name            string `json:"name"`
+	Type            string `json:"type"`
+	PointType       string `json:"point_type"`
+	BudgetPoints    int    `json:"budget_points"`
+	SpentPoints     int    `json:"spent_points"`
+	RemainingPoints *int   `json:"remaining_points"` // null when uncapped
+	Awards          int    `json:"awards"`
+	Users           int    `json:"users"`
+}
+
+// GetCampaigns returns all campaigns with optional filtering
+func GetCampaigns(c *fiber.Ctx) error {
+	var campaigns []models.Campaign
+
+	query := database.DB.Preload("Members")
+	if campaignType := c.Query("type"); campaignType != "" {
+		query = query.Where("type = ?", campaignType)
+	}
+	if c.Query("running") == "true" {
+		now := time.Now().UTC()
+		query = query.Where("active = ? AND starts_at <= ? AND ends_at > ?", true, now, now)
+	}
+
+	if err := query.Order("starts_at DESC").Find(&campaigns).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch campaigns",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    campaigns,
+	})
+}
+
+// GetCampaign returns a single campaign by ID
+func GetCampaign(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var campaign models.Campaign
+
+	if err := database.DB.Preload("Members").First(&campaign, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Campaign not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    campaign,
+	})
+}
+
+// CreateCampaign creates a new campaign
+func CreateCampaign(c *fiber.Ctx) error {
+	req := new(CampaignRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	campaign := models.Campaign{Active: true}
+	if err := saveCampaign(&campaign, req); err != nil {
+		return sendError(c, err, "Failed to create campaign")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    campaign,
+	})
+}
+
+// UpdateCampaign replaces a campaign's settings and segment. Points already
+// spent are kept.
+func UpdateCampaign(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var campaign models.Campaign
+
+	if err := database.DB.First(&campaign, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Campaign not found",
+		})
+	}
+
+	req := new(CampaignRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := saveCampaign(&campaign, req); err != nil {
+		return sendError(c, err, "Failed to update campaign")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    campaign,
+	})
+}
+
+// GetCampaignReport returns the points spent by every campaign
+func GetCampaignReport(c *fiber.Ctx) error {
+	var campaigns []models.Campaign
+	if err := database.DB.Order("starts_at DESC").Find(&campaigns).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch campaign report",
+		})
+	}
+
+	type awardTotals struct {
+		CampaignID uint
+		Awards     int
+		Users      int
+	}
+	var totals []awardTotals
+	if err := database.DB.Model(&models.CampaignAward{}).
+		Select("campaign_id, COUNT(*) AS awards, COUNT(DISTINCT user_id) AS users").
+		Group("campaign_id").
+		Scan(&totals).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch campaign report",
+		})
+	}
+	byCampaign := make(map[uint]awardTotals)
+	for _, t := range totals {
+		byCampaign[t.CampaignID] = t
+	}
+
+	report := make([]CampaignReport, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		row := CampaignReport{
+			CampaignID:   campaign.ID,
+			Name:         campaign.Name,
+			Type:         campaign.Type,
+			PointType:    campaign.PointType,
+			BudgetPoints: campaign.BudgetPoints,
+			SpentPoints:  campaign.SpentPoints,
+			Awards:       byCampaign[campaign.ID].Awards,
+			Users:        byCampaign[campaign.ID].Users,
+		}
+		if campaign.BudgetPoints > 0 {
+			remaining := campaign.BudgetPoints - campaign.SpentPoints
+			row.RemainingPoints = &remaining
+		}
+		report = append(report, row)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// saveCampaign validates req, copies it onto campaign and stores the campaign
+// with its segment members
+func saveCampaign(campaign *models.Campaign, req *CampaignRequest) error {
+	if req.Name == "" || req.StartsAt.IsZero() || req.EndsAt.IsZero() {
+		return newRequestError(400, "name, starts_at and ends_at are required")
+	}
+	if !req.EndsAt.After(req.StartsAt) {
+		return newRequestError(400, "ends_at must be after starts_at")
+	}
+	if req.MinOrderTotal < 0 || req.MaxAwardsPerUser < 0 || req.BudgetPoints < 0 {
+		return newRequestError(400, "min_order_total, max_awards_per_user and budget_points cannot be negative")
+	}
+
+	switch req.Type {
+	case "order_multiplier":
+		if req.Multiplier <= 1 {
+			return newRequestError(400, "multiplier must be greater than 1")
+		}
+		req.BonusPoints = 0
+	case "first_transfer", "segment_bonus":
+		if req.BonusPoints <= 0 {
+			return newRequestError(400, "bonus_points must be greater than 0")
+		}
+		req.Multiplier = 1
+	default:
+		return newRequestError(400, "type must be order_multiplier, first_transfer or segment_bonus")
+	}
+
+	campaign.Name = req.Name
+	campaign.Type = req.Type
+	campaign.PointType = req.PointType
+	if campaign.PointType == "" {
+		campaign.PointType = models.DefaultPointType
+	}
+	campaign.Multiplier = req.Multiplier
+	campaign.BonusPoints = req.BonusPoints
+	// Stored in UTC so the running campaigns can be compared with now in SQL
+	campaign.StartsAt = req.StartsAt.UTC()
+	campaign.EndsAt = req.EndsAt.UTC()
+	if req.Active != nil {
+		campaign.Active = *req.Active
+	}
+	campaign.MinOrderTotal = req.MinOrderTotal
+	campaign.Tiers = strings.Join(req.Tiers, ",")
+	campaign.MaxAwardsPerUser = req.MaxAwardsPerUser
+	campaign.BudgetPoints = req.BudgetPoints
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := findPointType(tx, campaign.PointType); err != nil {
+			return err
+		}
+		for _, code := range req.Tiers {
+			var tier models.Tier
+			if err := tx.Where("code = ?", code).First(&tier).Error; err != nil {
+				return newRequestError(400, fmt.Sprintf("Unknown tier: %s", code))
+			}
+		}
+		if len(req.UserIDs) > 0 {
+			var found int64
+			tx.Model(&models.User{}).Where("id IN ?", req.UserIDs).Count(&found)
+			if int(found) != len(uniqueIDs(req.UserIDs)) {
+				return newRequestError(400, "One or more segment users not found")
+			}
+		}
+
+		if err := tx.Omit("Members").Save(campaign).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("campaign_id = ?", campaign.ID).Delete(&models.CampaignMember{}).Error; err != nil {
+			return err
+		}
+		campaign.Members = nil
+		for _, userID := range uniqueIDs(req.UserIDs) {
+			member := models.CampaignMember{CampaignID: campaign.ID, UserID: userID}
+			if err := tx.Create(&member).Error; err != nil {
+				return err
+			}
+			campaign.Members = append(campaign.Members, member)
+		}
+
+		return nil
+	})
+}
+
+// applyCampaigns pays out every running campaign the event qualifies for.
+// Each bonus is an 'earn' ledger entry attributed to the campaign in its
+// metadata and counted against the campaign budget.
+func applyCampaigns(tx *gorm.DB, event campaignEvent) error {
+	now := time.Now().UTC()
+	var campaigns []models.Campaign
+	if err := tx.Where("active = ? AND starts_at <= ? AND ends_at > ?", true, now, now).
+		Order("id ASC").
+		Find(&campaigns).Error; err != nil {
+		return err
+	}
+	if len(campaigns) == 0 {
+		return nil
+	}
+
+	var user models.User
+	if err := tx.First(&user, event.UserID).Error; err != nil {
+		return nil
+	}
+	tier, err := userTier(tx, &user)
+	if err != nil {
+		return err
+	}
+
+	for i := range campaigns {
+		campaign := &campaigns[i]
+
+		points, err := campaignBonus(tx, campaign, event)
+		if err != nil {
+			return err
+		}
+		if points <= 0 {
+			continue
+		}
+
+		eligible, err := campaignEligible(tx, campaign, &user, tier)
+		if err != nil {
+			return err
+		}
+		if !eligible {
+			continue
+		}
+
+		// Reserve the points against the budget before paying them out
+		result := tx.Model(&models.Campaign{}).
+			Where("id = ? AND (budget_points = 0 OR spent_points + ? <= budget_points)", campaign.ID, points).
+			Update("spent_points", gorm.Expr("spent_points + ?", points))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue // Budget exhausted
+		}
+
+		ledger, err := applyPoints(tx, pointEntry{
+			UserID:     user.ID,
+			PointType:  campaign.PointType,
+			Change:     points,
+			EventType:  "earn",
+			TransferID: event.TransferID,
+			OrderID:    event.OrderID,
+			Reference:  fmt.Sprintf("campaign-%d", campaign.ID),
+			Metadata: ledgerMetadata(map[string]interface{}{
+				"campaign_id":   campaign.ID,
+				"campaign_name": campaign.Name,
+				"campaign_type": campaign.Type,
+			}),
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Create(&models.CampaignAward{
+			CampaignID: campaign.ID,
+			UserID:     user.ID,
+			LedgerID:   ledger.ID,
+			Points:     points,
+			OrderID:    event.OrderID,
+			TransferID: event.TransferID,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// campaignBonus works out the bonus a campaign pays for an event, ignoring
+// eligibility and budget
+func campaignBonus(tx *gorm.DB, campaign *models.Campaign, event campaignEvent) (int, error) {
+	if event.Trigger == "order" && event.OrderTotal < campaign.MinOrderTotal {
+		return 0, nil
+	}
+
+	switch campaign.Type {
+	case "order_multiplier":
+		if event.Trigger != "order" {
+			return 0, nil
+		}
+		return floorPoints(float64(event.Earned[campaign.PointType]) * (campaign.Multiplier - 1)), nil
+
+	case "first_transfer":
+		if event.Trigger != "transfer" {
+			return 0, nil
+		}
+		var earlier int64
+		if err := tx.Model(&models.Transfer{}).
+			Where("from_user_id = ? AND id <> ? AND status IN ?",
+				event.UserID, *event.TransferID, []string{"completed", "reversed"}).
+			Count(&earlier).Error; err != nil {
+			return 0, err
+		}
+		if earlier > 0 {
+			return 0, nil
+		}
+		return campaign.BonusPoints, nil
+
+	case "segment_bonus":
+		// A one-off bonus, so members can't farm it by moving points around
+		var earlier int64
+		if err := tx.Model(&models.CampaignAward{}).
+			Where("campaign_id = ? AND user_id = ? AND reversed_points < points", campaign.ID, event.UserID).
+			Count(&earlier).Error; err != nil {
+			return 0, err
+		}
+		if earlier > 0 {
+			return 0, nil
+		}
+		return campaign.BonusPoints, nil
+	}
+
+	return 0, nil
+}
+
+// campaignEligible checks the campaign's tier, segment and per-user limits
+func campaignEligible(tx *gorm.DB, campaign *models.Campaign, user *models.User, tier *models.Tier) (bool, error) {
+	if campaign.Tiers != "" {
+		if tier == nil {
+			return false, nil
+		}
+		allowed := false
+		for _, code := range strings.Split(campaign.Tiers, ",") {
+			if code == tier.Code {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false, nil
+		}
+	}
+
+	var members, isMember int64
+	if err := tx.Model(&models.CampaignMember{}).Where("campaign_id = ?", campaign.ID).Count(&members).Error; err != nil {
+		return false, err
+	}
+	if members > 0 {
+		if err := tx.Model(&models.CampaignMember{}).
+			Where("campaign_id = ? AND user_id = ?", campaign.ID, user.ID).
+			Count(&isMember).Error; err != nil {
+			return false, err
+		}
+		if isMember == 0 {
+			return false, nil
+		}
+	}
+
+	if campaign.MaxAwardsPerUser > 0 {
+		var awards int64
+		if err := tx.Model(&models.CampaignAward{}).
+			Where("campaign_id = ? AND user_id = ? AND reversed_points < points", campaign.ID, user.ID).
+			Count(&awards).Error; err != nil {
+			return false, err
+		}
+		if int(awards) >= campaign.MaxAwardsPerUser {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// reverseCampaignAwards records the points clawed back from the campaign
+// bonuses an order earned and returns them to the campaigns' budgets.
+// clawback gives how many more of an award's points were clawed back.
+// Fully clawed back awards no longer count towards per-user limits.
+func reverseCampaignAwards(tx *gorm.DB, orderID uint, clawback func(award models.CampaignAward) int) error {
+	var awards []models.CampaignAward
+	if err := tx.Where("order_id = ? AND reversed_points < points", orderID).Find(&awards).Error; err != nil {
+		return err
+	}
+
+	for _, award := range awards {
+		points := min(clawback(award), award.Points-award.Reversed)
+		if points <= 0 {
+			continue
+		}
+		if err := tx.Model(&award).
+			Update("reversed_points", gorm.Expr("reversed_points + ?", points)).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Campaign{}).Where("id = ?", award.CampaignID).
+			Update("spent_points", gorm.Expr("MAX(spent_points - ?, 0)", points)).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// uniqueIDs returns ids without duplicates, keeping the first occurrence order
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool)
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRunningCampaignsWithOffsets(t *testing.T) {
+	bangkok := time.FixedZone("ICT", 7*60*60)
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		startsAt    time.Time
+		endsAt      time.Time
+		wantRunning bool
+	}{
+		{"ended two hours ago", now.Add(-48 * time.Hour), now.Add(-2 * time.Hour), false},
+		{"ends in two hours", now.Add(-48 * time.Hour), now.Add(2 * time.Hour), true},
+		{"starts in two hours", now.Add(2 * time.Hour), now.Add(48 * time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			status, body := sendRequest(t, CreateCampaign, "POST", "/campaigns", "/campaigns", fmt.Sprintf(
+				`{"name": "Bonus", "type": "first_transfer", "bonus_points": 10, "starts_at": %q, "ends_at": %q}`,
+				tt.startsAt.In(bangkok).Format(time.RFC3339), tt.endsAt.In(bangkok).Format(time.RFC3339)))
+			if status != 201 {
+				t.Fatalf("CreateCampaign returned %d: %v", status, body)
+			}
+
+			status, body = sendRequest(t, GetCampaigns, "GET", "/campaigns", "/campaigns?running=true", "")
+			if status != 200 {
+				t.Fatalf("GetCampaigns returned %d: %v", status, body)
+			}
+			if running := len(body["data"].([]interface{})) == 1; running != tt.wantRunning {
+				t.Errorf("running = %v, want %v", running, tt.wantRunning)
+			}
+		})
+	}
+}
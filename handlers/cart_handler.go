@@ -0,0 +1,645 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// cartTTL is how long a cart stays active after it was last changed
+const cartTTL = 7 * 24 * time.Hour
+
+// CartRequest represents the request body for opening a cart
+type CartRequest struct {
+	CustomerID uint   `json:"customer_id"`
+	Currency   string `json:"currency"`
+}
+
+// CartItemRequest represents the request body for adding or changing a cart
+// item
+type CartItemRequest struct {
+	ProductID *uint  `json:"product_id"`
+	SKU       string `json:"sku"`
+	Quantity  int    `json:"quantity"`
+}
+
+// CheckoutRequest represents the request body for checking out a cart
+type CheckoutRequest struct {
+	DeliveryAddressID *uint  `json:"delivery_address_id"` // Defaults to the customer's default address
+	Actor             string `json:"actor"`
+}
+
+// CreateCart returns the customer's active cart, opening a new one if they
+// have none
+func CreateCart(c *fiber.Ctx) error {
+	req := new(CartRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	currency := strings.ToUpper(req.Currency)
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+	if !models.SupportedCurrencies[currency] {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Unsupported currency: " + currency,
+		})
+	}
+
+	var cart models.Cart
+	created := false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var customer models.Customer
+		if err := tx.First(&customer, req.CustomerID).Error; err != nil {
+			return newRequestError(400, "Customer not found")
+		}
+
+		err := tx.Where("customer_id = ? AND status = ?", customer.ID, "active").First(&cart).Error
+		if err == nil && cart.ExpiresAt.After(time.Now()) {
+			if cart.Currency != currency {
+				return newRequestError(409, fmt.Sprintf("Customer already has an active %s cart", cart.Currency))
+			}
+			return priceCart(tx, &cart)
+		}
+		if err == nil {
+			if err := tx.Model(&cart).Update("status", "expired").Error; err != nil {
+				return err
+			}
+		}
+
+		cart = models.Cart{
+			CustomerID: customer.ID,
+			Currency:   currency,
+			Status:     "active",
+			ExpiresAt:  time.Now().Add(cartTTL),
+		}
+		created = true
+		if err := tx.Create(&cart).Error; err != nil {
+			return err
+		}
+		return priceCart(tx, &cart)
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to create cart")
+	}
+
+	status := 200
+	if created {
+		status = 201
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"success": true,
+		"data":    cart,
+	})
+}
+
+// GetCart returns a cart priced at the current product prices and coupons
+func GetCart(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var cart models.Cart
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := preloadCart(tx).First(&cart, id).Error; err != nil {
+			return newRequestError(404, "Cart not found")
+		}
+		if cart.Status != "active" {
+			return nil // Checked out carts are kept as they were
+		}
+		if err := checkCartActive(&cart); err != nil {
+			return err
+		}
+		return priceCart(tx, &cart)
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to fetch cart")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    cart,
+	})
+}
+
+// GetCustomerCart returns the customer's active cart
+func GetCustomerCart(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var cart models.Cart
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("customer_id = ? AND status = ? AND expires_at > ?", id, "active", time.Now()).
+			First(&cart).Error; err != nil {
+			return newRequestError(404, "Customer has no active cart")
+		}
+		return priceCart(tx, &cart)
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to fetch cart")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    cart,
+	})
+}
+
+// AddCartItem adds a product to a cart. Adding a product that is already in
+// the cart adds to its quantity.
+func AddCartItem(c *fiber.Ctx) error {
+	id := c.Params("id")
+	req := new(CartItemRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.Quantity <= 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "quantity must be greater than 0",
+		})
+	}
+
+	var cart *models.Cart
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		cart, err = findActiveCart(tx, id)
+		if err != nil {
+			return err
+		}
+
+		product, err := findOrderableProduct(tx, &models.Order{Currency: cart.Currency}, req.ProductID, req.SKU)
+		if err != nil {
+			return err
+		}
+
+		item := models.CartItem{CartID: cart.ID, ProductID: product.ID}
+		if err := tx.Where("cart_id = ? AND product_id = ?", cart.ID, product.ID).First(&item).Error; err != nil &&
+			err != gorm.ErrRecordNotFound {
+			return err
+		}
+		item.Quantity += req.Quantity
+		if err := checkCartStock(product, item.Quantity); err != nil {
+			return err
+		}
+		snapshotCartProduct(&item, product)
+		if err := tx.Save(&item).Error; err != nil {
+			return err
+		}
+
+		return touchCart(tx, cart)
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to add cart item")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    cart,
+	})
+}
+
+// UpdateCartItem changes the quantity of a cart item
+func UpdateCartItem(c *fiber.Ctx) error {
+	id := c.Params("id")
+	itemID := c.Params("itemId")
+	req := new(CartItemRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.Quantity <= 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "quantity must be greater than 0",
+		})
+	}
+
+	var cart *models.Cart
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		cart, err = findActiveCart(tx, id)
+		if err != nil {
+			return err
+		}
+
+		var item models.CartItem
+		if err := tx.Where("id = ? AND cart_id = ?", itemID, cart.ID).First(&item).Error; err != nil {
+			return newRequestError(404, "Cart item not found")
+		}
+
+		var product models.Product
+		if err := tx.First(&product, item.ProductID).Error; err != nil {
+			return newRequestError(400, fmt.Sprintf("Product %d not found", item.ProductID))
+		}
+		if err := checkCartStock(&product, req.Quantity); err != nil {
+			return err
+		}
+		if err := tx.Model(&item).Update("quantity", req.Quantity).Error; err != nil {
+			return err
+		}
+
+		return touchCart(tx, cart)
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to update cart item")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    cart,
+	})
+}
+
+// DeleteCartItem removes an item from a cart
+func DeleteCartItem(c *fiber.Ctx) error {
+	id := c.Params("id")
+	itemID := c.Params("itemId")
+
+	var cart *models.Cart
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		cart, err = findActiveCart(tx, id)
+		if err != nil {
+			return err
+		}
+
+		result := tx.Where("id = ? AND cart_id = ?", itemID, cart.ID).Delete(&models.CartItem{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return newRequestError(404, "Cart item not found")
+		}
+
+		return touchCart(tx, cart)
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to delete cart item")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    cart,
+	})
+}
+
+// ApplyCartCoupon enters a coupon code on a cart. The coupon's usage and
+// customer limits are checked at checkout, when a use is taken.
+func ApplyCartCoupon(c *fiber.Ctx) error {
+	id := c.Params("id")
+	req := new(ApplyCouponRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	code := normalizeCouponCode(req.Code)
+	if code == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "code is required",
+		})
+	}
+
+	var cart *models.Cart
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		cart, err = findActiveCart(tx, id)
+		if err != nil {
+			return err
+		}
+
+		var coupon models.Coupon
+		if err := tx.Where("code = ?", code).First(&coupon).Error; err != nil {
+			return newRequestError(404, "Coupon not found")
+		}
+		if err := checkCouponCurrent(&coupon, cart.Currency); err != nil {
+			return err
+		}
+
+		var applied int64
+		if err := tx.Model(&models.CartCoupon{}).
+			Where("cart_id = ? AND coupon_id = ?", cart.ID, coupon.ID).
+			Count(&applied).Error; err != nil {
+			return err
+		}
+		if applied > 0 {
+			return newRequestError(409, "Coupon is already applied to this cart")
+		}
+
+		if err := tx.Create(&models.CartCoupon{
+			CartID:   cart.ID,
+			CouponID: coupon.ID,
+			Code:     coupon.Code,
+		}).Error; err != nil {
+			return err
+		}
+
+		return touchCart(tx, cart)
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to apply coupon")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    cart,
+	})
+}
+
+// RemoveCartCoupon removes a coupon code from a cart
+func RemoveCartCoupon(c *fiber.Ctx) error {
+	id := c.Params("id")
+	code := normalizeCouponCode(c.Params("code"))
+
+	var cart *models.Cart
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		cart, err = findActiveCart(tx, id)
+		if err != nil {
+			return err
+		}
+
+		result := tx.Where("cart_id = ? AND code = ?", cart.ID, code).Delete(&models.CartCoupon{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return newRequestError(404, "Coupon is not applied to this cart")
+		}
+
+		return touchCart(tx, cart)
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to remove coupon")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    cart,
+	})
+}
+
+// CheckoutCart turns a cart into a pending order. The items take their
+// stock and the coupons a use each, the order is priced and taxed like any
+// other, and the cart is emptied; if any step fails nothing changes.
+func CheckoutCart(c *fiber.Ctx) error {
+	id := c.Params("id")
+	req := new(CheckoutRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.Actor == "" {
+		req.Actor = defaultOrderActor
+	}
+
+	var order models.Order
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		cart, err := findActiveCart(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := priceCart(tx, cart); err != nil {
+			return err
+		}
+		if len(cart.Items) == 0 {
+			return newRequestError(400, "Cart is empty")
+		}
+
+		order = models.Order{
+			CustomerID:        cart.CustomerID,
+			OrderDate:         time.Now().UTC(),
+			Status:            "pending",
+			Currency:          cart.Currency,
+			DeliveryAddressID: req.DeliveryAddressID,
+		}
+		for _, cartItem := range cart.Items {
+			if !cartItem.Available {
+				return newRequestError(400, fmt.Sprintf("Product %s is no longer available; remove it from the cart", cartItem.SKU))
+			}
+			productID := cartItem.ProductID
+			item := models.LineItem{ProductID: &productID, Quantity: cartItem.Quantity}
+			if err := prepareLineItem(tx, &order, &item); err != nil {
+				return err
+			}
+			order.Items = append(order.Items, item)
+		}
+
+		if err := snapshotOrderAddress(tx, &order); err != nil {
+			return err
+		}
+		if err := tx.Omit("Payments", "Discounts").Create(&order).Error; err != nil {
+			return err
+		}
+		if err := recordOrderStatus(tx, order.ID, "", order.Status, req.Actor, fmt.Sprintf("Checked out from cart #%d", cart.ID)); err != nil {
+			return err
+		}
+
+		for _, cc := range cart.Coupons {
+			var coupon models.Coupon
+			if err := tx.First(&coupon, cc.CouponID).Error; err != nil {
+				return newRequestError(400, fmt.Sprintf("Coupon %s no longer exists; remove it from the cart", cc.Code))
+			}
+			if err := applyCoupon(tx, &coupon, &order); err != nil {
+				return err
+			}
+		}
+		if err := recalculateOrderTotal(tx, &order); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(cart).Updates(map[string]interface{}{
+			"status":               "checked_out",
+			"order_id":             order.ID,
+			"checked_out_at":       now,
+			"subtotal_minor":       0,
+			"discount_total_minor": 0,
+			"total_minor":          0,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("cart_id = ?", cart.ID).Delete(&models.CartItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("cart_id = ?", cart.ID).Delete(&models.CartCoupon{}).Error
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to check out cart")
+	}
+
+	database.DB.Preload("Items").Preload("Discounts").First(&order, order.ID)
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    order,
+	})
+}
+
+// ExpireCarts marks every active cart past its expiry as expired. It is run
+// periodically from main.
+func ExpireCarts() {
+	if err := database.DB.Model(&models.Cart{}).
+		Where("status = ? AND expires_at < ?", "active", time.Now()).
+		Update("status", "expired").Error; err != nil {
+		log.Printf("Failed to expire carts: %v", err)
+	}
+}
+
+// findActiveCart loads a cart that can still be changed
+func findActiveCart(tx *gorm.DB, id string) (*models.Cart, error) {
+	var cart models.Cart
+	if err := tx.First(&cart, id).Error; err != nil {
+		return nil, newRequestError(404, "Cart not found")
+	}
+	if err := checkCartActive(&cart); err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+// checkCartActive checks that cart has neither been checked out nor expired.
+// A cart past its expiry counts as expired before the job has marked it.
+func checkCartActive(cart *models.Cart) error {
+	switch {
+	case cart.Status == "checked_out":
+		return newRequestError(409, fmt.Sprintf("Cart has already been checked out into order %d", *cart.OrderID))
+	case cart.Status == "expired" || !cart.ExpiresAt.After(time.Now()):
+		return newRequestError(410, "Cart has expired")
+	}
+	return nil
+}
+
+// touchCart extends the expiry of a cart that was just changed and prices it
+func touchCart(tx *gorm.DB, cart *models.Cart) error {
+	cart.ExpiresAt = time.Now().Add(cartTTL)
+	if err := tx.Model(cart).Update("expires_at", cart.ExpiresAt).Error; err != nil {
+		return err
+	}
+	return priceCart(tx, cart)
+}
+
+// priceCart reprices the cart's items at the current product prices, works
+// out the discounts its coupons give with computeDiscounts, as for orders,
+// and stores the new totals. Coupons that are no longer current or whose
+// minimum the cart does not meet give no discount.
+func priceCart(tx *gorm.DB, cart *models.Cart) error {
+	cart.Items, cart.Coupons = nil, nil
+	if err := preloadCart(tx).First(cart, cart.ID).Error; err != nil {
+		return err
+	}
+
+	var items []models.LineItem
+	var subtotal models.Money
+	for i := range cart.Items {
+		item := &cart.Items[i]
+		var product models.Product
+		err := tx.First(&product, item.ProductID).Error
+		item.Available = err == nil && product.Active && product.Currency == cart.Currency
+		item.Discount = 0
+		if !item.Available {
+			item.TotalPrice = 0
+			continue
+		}
+
+		snapshotCartProduct(item, &product)
+		subtotal += item.TotalPrice
+		items = append(items, models.LineItem{
+			ID:          item.ID,
+			SKU:         item.SKU,
+			ProductName: item.ProductName,
+			Category:    item.Category,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			TotalPrice:  item.TotalPrice,
+		})
+	}
+
+	var coupons []models.Coupon
+	for _, cc := range cart.Coupons {
+		var coupon models.Coupon
+		if err := tx.First(&coupon, cc.CouponID).Error; err != nil {
+			continue
+		}
+		if checkCouponCurrent(&coupon, cart.Currency) == nil {
+			coupons = append(coupons, coupon)
+		}
+	}
+
+	cart.Discounts = []models.CartDiscount{}
+	var discount models.Money
+	for _, d := range computeDiscounts(coupons, items, subtotal) {
+		discount += d.Amount
+		cart.Discounts = append(cart.Discounts, models.CartDiscount{
+			Code:        d.Code,
+			Scope:       d.Scope,
+			CartItemID:  d.LineItemID,
+			Description: d.Description,
+			Amount:      d.Amount,
+		})
+	}
+
+	for i := range cart.Items {
+		item := &cart.Items[i]
+		for _, d := range cart.Discounts {
+			if d.CartItemID != nil && *d.CartItemID == item.ID {
+				item.Discount += d.Amount
+			}
+		}
+		if err := tx.Save(item).Error; err != nil {
+			return err
+		}
+	}
+
+	cart.Subtotal, cart.DiscountTotal, cart.Total = subtotal, discount, subtotal-discount
+	return tx.Model(cart).Updates(map[string]interface{}{
+		"subtotal_minor":       cart.Subtotal,
+		"discount_total_minor": cart.DiscountTotal,
+		"total_minor":          cart.Total,
+	}).Error
+}
+
+// snapshotCartProduct copies the product's current details and price onto
+// item and computes its total
+func snapshotCartProduct(item *models.CartItem, product *models.Product) {
+	item.SKU = product.SKU
+	item.ProductName = product.Name
+	item.Category = product.Category
+	item.UnitPrice = product.Price
+	item.TotalPrice = product.Price.Mul(item.Quantity)
+	item.Available = true
+}
+
+// checkCartStock checks that quantity units of product are in stock. Carts
+// don't hold stock, so the check is repeated when the cart is checked out.
+func checkCartStock(product *models.Product, quantity int) error {
+	if product.Stock < quantity {
+		return newRequestError(409, fmt.Sprintf("Insufficient stock for %s: %d available, %d requested",
+			product.SKU, product.Stock, quantity))
+	}
+	return nil
+}
+
+// preloadCart loads a cart's items and coupons in the order they were added
+func preloadCart(tx *gorm.DB) *gorm.DB {
+	return tx.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).Preload("Coupons", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	})
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"temp_kbtg_backend/models"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func TestCreateCart(t *testing.T) {
+	tests := []struct {
+		name       string
+		existing   *models.Cart // The customer's earlier cart
+		body       string
+		wantStatus int
+		wantCarts  int64 // Active carts of the customer afterwards
+	}{
+		{
+			name:       "opens a cart",
+			body:       `{"customer_id": 1}`,
+			wantStatus: 201,
+			wantCarts:  1,
+		},
+		{
+			name:       "returns the active cart",
+			existing:   &models.Cart{CustomerID: 1, Currency: "THB", Status: "active", ExpiresAt: time.Now().Add(time.Hour)},
+			body:       `{"customer_id": 1, "currency": "thb"}`,
+			wantStatus: 200,
+			wantCarts:  1,
+		},
+		{
+			name:       "active cart in another currency",
+			existing:   &models.Cart{CustomerID: 1, Currency: "THB", Status: "active", ExpiresAt: time.Now().Add(time.Hour)},
+			body:       `{"customer_id": 1, "currency": "USD"}`,
+			wantStatus: 409,
+			wantCarts:  1,
+		},
+		{
+			name:       "replaces a cart past its expiry",
+			existing:   &models.Cart{CustomerID: 1, Currency: "THB", Status: "active", ExpiresAt: time.Now().Add(-time.Hour)},
+			body:       `{"customer_id": 1, "currency": "USD"}`,
+			wantStatus: 201,
+			wantCarts:  1,
+		},
+		{
+			name:       "unknown customer",
+			body:       `{"customer_id": 9}`,
+			wantStatus: 400,
+		},
+		{
+			name:       "unsupported currency",
+			body:       `{"customer_id": 1, "currency": "XYZ"}`,
+			wantStatus: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t)
+			createRecords(t, db, &models.Customer{Name: "A", Email: "a@example.com"})
+			if tt.existing != nil {
+				createRecords(t, db, tt.existing)
+			}
+
+			status, body := sendRequest(t, CreateCart, "POST", "/carts", "/carts", tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("CreateCart returned %d, want %d: %v", status, tt.wantStatus, body)
+			}
+
+			var carts int64
+			db.Model(&models.Cart{}).Where("customer_id = ? AND status = ?", 1, "active").Count(&carts)
+			if carts != tt.wantCarts {
+				t.Errorf("%d active carts, want %d", carts, tt.wantCarts)
+			}
+		})
+	}
+}
+
+func TestCheckoutCart(t *testing.T) {
+	tests := []struct {
+		name       string
+		change     func(db *gorm.DB) // Applied after the items were added
+		wantStatus int
+		wantTotal  models.Money // Of the order
+		wantStock  int
+		wantUsed   int // Uses of the cart's coupon
+	}{
+		{
+			name:       "creates a pending order at current prices",
+			change:     func(db *gorm.DB) { db.Model(&models.Product{}).Where("id = ?", 1).Update("price_minor", 6000) },
+			wantStatus: 201,
+			wantTotal:  10800, // 2 pens at 60.00, less 10%
+			wantStock:  3,
+			wantUsed:   1,
+		},
+		{
+			name:       "product deactivated",
+			change:     func(db *gorm.DB) { db.Model(&models.Product{}).Where("id = ?", 1).Update("active", false) },
+			wantStatus: 400,
+			wantStock:  5,
+		},
+		{
+			name:       "stock sold meanwhile",
+			change:     func(db *gorm.DB) { db.Model(&models.Product{}).Where("id = ?", 1).Update("stock", 1) },
+			wantStatus: 409,
+			wantStock:  1,
+		},
+		{
+			name: "cart expired",
+			change: func(db *gorm.DB) {
+				db.Model(&models.Cart{}).Where("id = ?", 1).Update("expires_at", time.Now().Add(-time.Minute))
+			},
+			wantStatus: 410,
+			wantStock:  5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t)
+			createRecords(t, db,
+				&models.Customer{Name: "A", Email: "a@example.com"},
+				&models.Product{SKU: "PEN", Name: "Pen", Price: 5000, Stock: 5, Active: true},
+				&models.Coupon{Code: "SAVE10", Type: "percentage", Scope: "order", PercentOff: 10, Active: true})
+
+			steps := []struct {
+				handler fiber.Handler
+				route   string
+				path    string
+				body    string
+			}{
+				{CreateCart, "/carts", "/carts", `{"customer_id": 1}`},
+				{AddCartItem, "/carts/:id/items", "/carts/1/items", `{"sku": "PEN", "quantity": 2}`},
+				{ApplyCartCoupon, "/carts/:id/coupons", "/carts/1/coupons", `{"code": "save10"}`},
+			}
+			for _, step := range steps {
+				if status, body := sendRequest(t, step.handler, "POST", step.route, step.path, step.body); status != 201 {
+					t.Fatalf("POST %s returned %d: %v", step.path, status, body)
+				}
+			}
+			tt.change(db)
+
+			status, body := sendRequest(t, CheckoutCart, "POST", "/carts/:id/checkout", "/carts/1/checkout", `{}`)
+			if status != tt.wantStatus {
+				t.Fatalf("CheckoutCart returned %d, want %d: %v", status, tt.wantStatus, body)
+			}
+
+			var cart models.Cart
+			if err := preloadCart(db).First(&cart, 1).Error; err != nil {
+				t.Fatal(err)
+			}
+			var orders []models.Order
+			db.Find(&orders)
+			if tt.wantStatus == 201 {
+				if cart.Status != "checked_out" || len(cart.Items) != 0 || cart.OrderID == nil {
+					t.Errorf("cart %s with %d items and order %v, want checked out and empty", cart.Status, len(cart.Items), cart.OrderID)
+				}
+				if len(orders) != 1 || orders[0].Status != "pending" || orders[0].TotalPrice != tt.wantTotal {
+					t.Errorf("orders = %+v, want one pending order of %s", orders, tt.wantTotal)
+				}
+			} else {
+				if len(cart.Items) != 1 || len(cart.Coupons) != 1 || len(orders) != 0 {
+					t.Errorf("failed checkout left %d items, %d coupons and %d orders; want 1, 1 and 0",
+						len(cart.Items), len(cart.Coupons), len(orders))
+				}
+			}
+
+			var product models.Product
+			var coupon models.Coupon
+			if err := db.First(&product, 1).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := db.First(&coupon, 1).Error; err != nil {
+				t.Fatal(err)
+			}
+			if product.Stock != tt.wantStock || coupon.UsedCount != tt.wantUsed {
+				t.Errorf("stock %d and coupon uses %d, want %d and %d", product.Stock, coupon.UsedCount, tt.wantStock, tt.wantUsed)
+			}
+		})
+	}
+}
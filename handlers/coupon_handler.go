@@ -0,0 +1,617 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// CouponRequest represents the request body for creating or updating a coupon
+type CouponRequest struct {
+	Code             string       `json:"code"`
+	Description      string       `json:"description"`
+	Type             string       `json:"type"`  // percentage or fixed
+	Scope            string       `json:"scope"` // order (default) or line
+	PercentOff       float64      `json:"percent_off"`
+	AmountOff        models.Money `json:"amount_off"`
+	Currency         string       `json:"currency"`
+	MaxDiscount      models.Money `json:"max_discount"`
+	MinOrderTotal    models.Money `json:"min_order_total"`
+	SKU              string       `json:"sku"`
+	Category         string       `json:"category"`
+	UsageLimit       int          `json:"usage_limit"`
+	PerCustomerLimit int          `json:"per_customer_limit"`
+	StartsAt         *time.Time   `json:"starts_at"`
+	EndsAt           *time.Time   `json:"ends_at"`
+	Active           *bool        `json:"active"`
+}
+
+// ApplyCouponRequest represents the request body for applying a coupon to an order
+type ApplyCouponRequest struct {
+	Code string `json:"code"`
+}
+
+// GetCoupons returns all coupons with optional filtering
+func GetCoupons(c *fiber.Ctx) error {
+	var coupons []models.Coupon
+
+	query := database.DB
+	if scope := c.Query("scope"); scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+	if active := c.Query("active"); active != "" {
+		query = query.Where("active = ?", active == "true")
+	}
+
+	if err := query.Order("code ASC").Find(&coupons).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch coupons",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    coupons,
+	})
+}
+
+// GetCoupon returns a single coupon by ID
+func GetCoupon(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var coupon models.Coupon
+
+	if err := database.DB.First(&coupon, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Coupon not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    coupon,
+	})
+}
+
+// CreateCoupon creates a new coupon
+func CreateCoupon(c *fiber.Ctx) error {
+	req := new(CouponRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	coupon := models.Coupon{Active: true}
+	if err := saveCoupon(&coupon, req); err != nil {
+		return sendError(c, err, "Failed to create coupon")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    coupon,
+	})
+}
+
+// UpdateCoupon updates a coupon. Orders it is already applied to are
+// repriced the next time their items change.
+func UpdateCoupon(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var coupon models.Coupon
+
+	if err := database.DB.First(&coupon, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Coupon not found",
+		})
+	}
+
+	req := new(CouponRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := saveCoupon(&coupon, req); err != nil {
+		return sendError(c, err, "Failed to update coupon")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    coupon,
+	})
+}
+
+// DeleteCoupon deletes a coupon that has never been applied to an order.
+// Used coupons are kept for order history and should be deactivated instead.
+func DeleteCoupon(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var coupon models.Coupon
+		if err := tx.First(&coupon, id).Error; err != nil {
+			return newRequestError(404, "Coupon not found")
+		}
+
+		var used int64
+		if err := tx.Model(&models.OrderCoupon{}).Where("coupon_id = ?", coupon.ID).Count(&used).Error; err != nil {
+			return err
+		}
+		if used > 0 {
+			return newRequestError(409, "Coupon has been used on orders; set active to false instead")
+		}
+
+		return tx.Delete(&coupon).Error
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to delete coupon")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Coupon deleted successfully",
+	})
+}
+
+// ApplyOrderCoupon applies a coupon to an order and recomputes its totals
+func ApplyOrderCoupon(c *fiber.Ctx) error {
+	id := c.Params("id")
+	req := new(ApplyCouponRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	code := normalizeCouponCode(req.Code)
+	if code == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "code is required",
+		})
+	}
+
+	var order *models.Order
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, err = findEditableOrder(tx, id)
+		if err != nil {
+			return err
+		}
+
+		var coupon models.Coupon
+		if err := tx.Where("code = ?", code).First(&coupon).Error; err != nil {
+			return newRequestError(404, "Coupon not found")
+		}
+		if err := applyCoupon(tx, &coupon, order); err != nil {
+			return err
+		}
+
+		if err := recalculateOrderTotal(tx, order); err != nil {
+			return err
+		}
+
+		var discounts int64
+		if err := tx.Model(&models.OrderDiscount{}).
+			Where("order_id = ? AND coupon_id = ?", order.ID, coupon.ID).
+			Count(&discounts).Error; err != nil {
+			return err
+		}
+		if discounts == 0 {
+			return newRequestError(400, fmt.Sprintf("Coupon %s does not apply to any item on this order", coupon.Code))
+		}
+		return nil
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to apply coupon")
+	}
+
+	database.DB.Preload("Items").Preload("Discounts").First(order, order.ID)
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    order,
+	})
+}
+
+// RemoveOrderCoupon removes a coupon from an order and recomputes its totals
+func RemoveOrderCoupon(c *fiber.Ctx) error {
+	id := c.Params("id")
+	code := normalizeCouponCode(c.Params("code"))
+
+	var order *models.Order
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, err = findEditableOrder(tx, id)
+		if err != nil {
+			return err
+		}
+
+		var applied models.OrderCoupon
+		if err := tx.Where("order_id = ? AND code = ?", order.ID, code).First(&applied).Error; err != nil {
+			return newRequestError(404, "Coupon is not applied to this order")
+		}
+		if err := tx.Delete(&applied).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Coupon{}).
+			Where("id = ? AND used_count > 0", applied.CouponID).
+			Update("used_count", gorm.Expr("used_count - 1")).Error; err != nil {
+			return err
+		}
+
+		return recalculateOrderTotal(tx, order)
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to remove coupon")
+	}
+
+	database.DB.Preload("Items").Preload("Discounts").First(order, order.ID)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    order,
+	})
+}
+
+// saveCoupon validates req, copies it onto coupon and stores it
+func saveCoupon(coupon *models.Coupon, req *CouponRequest) error {
+	req.Code = normalizeCouponCode(req.Code)
+	if req.Code == "" {
+		return newRequestError(400, "code is required")
+	}
+	if req.Scope == "" {
+		req.Scope = "order"
+	}
+	if req.Scope != "order" && req.Scope != "line" {
+		return newRequestError(400, "scope must be order or line")
+	}
+
+	switch req.Type {
+	case "percentage":
+		if req.PercentOff <= 0 || req.PercentOff > 100 {
+			return newRequestError(400, "percent_off must be greater than 0 and at most 100")
+		}
+		req.AmountOff = 0
+	case "fixed":
+		if req.AmountOff <= 0 {
+			return newRequestError(400, "amount_off must be greater than 0")
+		}
+		req.PercentOff = 0
+	default:
+		return newRequestError(400, "type must be percentage or fixed")
+	}
+
+	if req.MaxDiscount < 0 || req.MinOrderTotal < 0 || req.UsageLimit < 0 || req.PerCustomerLimit < 0 {
+		return newRequestError(400, "max_discount, min_order_total, usage_limit and per_customer_limit cannot be negative")
+	}
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		return newRequestError(400, "ends_at must be after starts_at")
+	}
+	if req.Scope == "order" {
+		req.SKU, req.Category = "", ""
+	}
+
+	req.Currency = strings.ToUpper(req.Currency)
+	if req.Currency == "" {
+		req.Currency = models.DefaultCurrency
+	}
+	if !models.SupportedCurrencies[req.Currency] {
+		return newRequestError(400, "Unsupported currency: "+req.Currency)
+	}
+
+	coupon.Code = req.Code
+	coupon.Description = req.Description
+	coupon.Type = req.Type
+	coupon.Scope = req.Scope
+	coupon.PercentOff = req.PercentOff
+	coupon.AmountOff = req.AmountOff
+	coupon.Currency = req.Currency
+	coupon.MaxDiscount = req.MaxDiscount
+	coupon.MinOrderTotal = req.MinOrderTotal
+	coupon.SKU = strings.ToUpper(strings.TrimSpace(req.SKU))
+	coupon.Category = req.Category
+	coupon.UsageLimit = req.UsageLimit
+	coupon.PerCustomerLimit = req.PerCustomerLimit
+	coupon.StartsAt = req.StartsAt
+	coupon.EndsAt = req.EndsAt
+	if req.Active != nil {
+		coupon.Active = *req.Active
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var clash int64
+		if err := tx.Model(&models.Coupon{}).
+			Where("code = ? AND id <> ?", coupon.Code, coupon.ID).
+			Count(&clash).Error; err != nil {
+			return err
+		}
+		if clash > 0 {
+			return newRequestError(409, fmt.Sprintf("A coupon with code %s already exists", coupon.Code))
+		}
+
+		if coupon.ID == 0 {
+			return tx.Create(coupon).Error
+		}
+		// UsedCount is left alone so orders applying the coupon meanwhile count
+		if err := tx.Omit("UsedCount").Save(coupon).Error; err != nil {
+			return err
+		}
+		return tx.First(coupon, coupon.ID).Error
+	})
+}
+
+// applyCoupon checks that coupon can be used on order, takes one of its uses
+// and records it on the order. The order's totals are not recalculated.
+func applyCoupon(tx *gorm.DB, coupon *models.Coupon, order *models.Order) error {
+	if err := checkCouponUsable(tx, coupon, order); err != nil {
+		return err
+	}
+
+	// Claim one use; the condition keeps concurrent orders within the limit
+	result := tx.Model(&models.Coupon{}).
+		Where("id = ? AND (usage_limit = 0 OR used_count < usage_limit)", coupon.ID).
+		Update("used_count", gorm.Expr("used_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return newRequestError(409, fmt.Sprintf("Coupon %s usage limit reached", coupon.Code))
+	}
+
+	// The unique index on (order_id, coupon_id) backs up the check above
+	return tx.Create(&models.OrderCoupon{
+		OrderID:    order.ID,
+		CouponID:   coupon.ID,
+		CustomerID: order.CustomerID,
+		Code:       coupon.Code,
+	}).Error
+}
+
+// checkCouponCurrent checks that coupon is active, within its validity
+// window and for currency
+func checkCouponCurrent(coupon *models.Coupon, currency string) error {
+	now := time.Now()
+	if !coupon.Active {
+		return newRequestError(400, "Coupon is not active")
+	}
+	if coupon.StartsAt != nil && now.Before(*coupon.StartsAt) {
+		return newRequestError(400, "Coupon is not valid yet")
+	}
+	if coupon.EndsAt != nil && !now.Before(*coupon.EndsAt) {
+		return newRequestError(400, "Coupon has expired")
+	}
+	if coupon.Currency != currency {
+		return newRequestError(400, fmt.Sprintf("Coupon is for %s orders", coupon.Currency))
+	}
+	return nil
+}
+
+// checkCouponUsable checks that coupon can be applied to order right now:
+// it is current, not yet on the order, within the customer's limit and the
+// order meets its minimum
+func checkCouponUsable(tx *gorm.DB, coupon *models.Coupon, order *models.Order) error {
+	if err := checkCouponCurrent(coupon, order.Currency); err != nil {
+		return err
+	}
+
+	var items int64
+	if err := tx.Model(&models.LineItem{}).Where("order_id = ?", order.ID).Count(&items).Error; err != nil {
+		return err
+	}
+	if items == 0 {
+		return newRequestError(400, "Coupons can only be applied to orders with line items")
+	}
+
+	var applied int64
+	if err := tx.Model(&models.OrderCoupon{}).
+		Where("order_id = ? AND coupon_id = ?", order.ID, coupon.ID).
+		Count(&applied).Error; err != nil {
+		return err
+	}
+	if applied > 0 {
+		return newRequestError(409, "Coupon is already applied to this order")
+	}
+
+	if coupon.PerCustomerLimit > 0 {
+		var used int64
+		if err := tx.Model(&models.OrderCoupon{}).
+			Joins("JOIN orders ON orders.id = order_coupons.order_id").
+			Where("order_coupons.coupon_id = ? AND order_coupons.customer_id = ? AND orders.status <> ?",
+				coupon.ID, order.CustomerID, "cancelled").
+			Count(&used).Error; err != nil {
+			return err
+		}
+		if int(used) >= coupon.PerCustomerLimit {
+			return newRequestError(409, "Customer has already used this coupon the maximum number of times")
+		}
+	}
+
+	var subtotal models.Money
+	if err := tx.Model(&models.LineItem{}).
+		Select("COALESCE(SUM(total_price_minor), 0)").
+		Where("order_id = ?", order.ID).
+		Scan(&subtotal).Error; err != nil {
+		return err
+	}
+	if subtotal < coupon.MinOrderTotal {
+		return newRequestError(400, fmt.Sprintf("Coupon needs an order of at least %s %s", coupon.MinOrderTotal, coupon.Currency))
+	}
+
+	return nil
+}
+
+// applyOrderDiscounts replaces the order's discount records with the
+// discounts of its coupons, as worked out by computeDiscounts, and returns
+// them
+func applyOrderDiscounts(tx *gorm.DB, order *models.Order, items []models.LineItem, subtotal models.Money) ([]models.OrderDiscount, error) {
+	if err := tx.Where("order_id = ?", order.ID).Delete(&models.OrderDiscount{}).Error; err != nil {
+		return nil, err
+	}
+
+	var applied []models.OrderCoupon
+	if err := tx.Where("order_id = ?", order.ID).Order("id ASC").Find(&applied).Error; err != nil {
+		return nil, err
+	}
+	if len(applied) == 0 {
+		return nil, nil
+	}
+
+	coupons := make([]models.Coupon, 0, len(applied))
+	for _, a := range applied {
+		var coupon models.Coupon
+		if err := tx.First(&coupon, a.CouponID).Error; err != nil {
+			return nil, err
+		}
+		coupons = append(coupons, coupon)
+	}
+
+	discounts := computeDiscounts(coupons, items, subtotal)
+	for i := range discounts {
+		discounts[i].OrderID = order.ID
+		if err := tx.Create(&discounts[i]).Error; err != nil {
+			return nil, err
+		}
+	}
+	return discounts, nil
+}
+
+// computeDiscounts works out the discounts coupons, in the order they were
+// applied, give on items without storing them. Line discounts are taken
+// first and order discounts apply to what is left, so the total is never
+// discounted below zero. A coupon whose minimum subtotal does not meet
+// gives no discount.
+func computeDiscounts(coupons []models.Coupon, items []models.LineItem, subtotal models.Money) []models.OrderDiscount {
+	if len(items) == 0 {
+		return nil
+	}
+
+	remaining := make(map[uint]models.Money, len(items))
+	for _, item := range items {
+		remaining[item.ID] = item.TotalPrice
+	}
+
+	var discounts []models.OrderDiscount
+	var total models.Money
+	for _, scope := range []string{"line", "order"} {
+		for i := range coupons {
+			coupon := &coupons[i]
+			if coupon.Scope != scope || subtotal < coupon.MinOrderTotal {
+				continue
+			}
+
+			for _, discount := range couponDiscounts(coupon, items, remaining, subtotal-total) {
+				total += discount.Amount
+				discounts = append(discounts, discount)
+			}
+		}
+	}
+	return discounts
+}
+
+// couponDiscounts works out the discounts coupon gives. remaining holds what
+// is left of each line item after earlier discounts and is reduced as line
+// discounts are taken; orderRemaining is what is left of the whole order.
+func couponDiscounts(coupon *models.Coupon, items []models.LineItem, remaining map[uint]models.Money, orderRemaining models.Money) []models.OrderDiscount {
+	budget := coupon.MaxDiscount // 0 = no cap
+	capped := func(amount, limit models.Money) models.Money {
+		amount = min(amount, limit)
+		if coupon.MaxDiscount > 0 {
+			amount = min(amount, budget)
+			budget -= amount
+		}
+		return amount
+	}
+
+	if coupon.Scope == "order" {
+		amount := coupon.AmountOff
+		if coupon.Type == "percentage" {
+			amount = orderRemaining.Percent(coupon.PercentOff)
+		}
+		amount = capped(amount, orderRemaining)
+		if amount <= 0 {
+			return nil
+		}
+		return []models.OrderDiscount{{
+			CouponID:    coupon.ID,
+			Code:        coupon.Code,
+			Scope:       coupon.Scope,
+			Description: couponLabel(coupon, "order"),
+			Amount:      amount,
+		}}
+	}
+
+	var discounts []models.OrderDiscount
+	for i := range items {
+		item := &items[i]
+		if !couponMatchesItem(coupon, item) {
+			continue
+		}
+
+		amount := coupon.AmountOff.Mul(item.Quantity)
+		if coupon.Type == "percentage" {
+			amount = item.TotalPrice.Percent(coupon.PercentOff)
+		}
+		amount = capped(amount, min(remaining[item.ID], orderRemaining))
+		if amount <= 0 {
+			continue
+		}
+		remaining[item.ID] -= amount
+		orderRemaining -= amount
+
+		discounts = append(discounts, models.OrderDiscount{
+			CouponID:    coupon.ID,
+			Code:        coupon.Code,
+			Scope:       coupon.Scope,
+			LineItemID:  &item.ID,
+			Description: couponLabel(coupon, item.ProductName),
+			Amount:      amount,
+		})
+	}
+	return discounts
+}
+
+// couponMatchesItem reports whether a line coupon discounts item
+func couponMatchesItem(coupon *models.Coupon, item *models.LineItem) bool {
+	return (coupon.SKU == "" || coupon.SKU == item.SKU) &&
+		(coupon.Category == "" || coupon.Category == item.Category)
+}
+
+// couponLabel describes a discount for order and invoice listings,
+// e.g. "SAVE10: 10% off order"
+func couponLabel(coupon *models.Coupon, target string) string {
+	if coupon.Type == "percentage" {
+		return fmt.Sprintf("%s: %g%% off %s", coupon.Code, coupon.PercentOff, target)
+	}
+	if coupon.Scope == "line" {
+		return fmt.Sprintf("%s: %s %s off each %s", coupon.Code, coupon.AmountOff, coupon.Currency, target)
+	}
+	return fmt.Sprintf("%s: %s %s off %s", coupon.Code, coupon.AmountOff, coupon.Currency, target)
+}
+
+// releaseOrderCoupons gives back the uses an order's coupons took, e.g.
+// when the order is cancelled
+func releaseOrderCoupons(tx *gorm.DB, order *models.Order) error {
+	var applied []models.OrderCoupon
+	if err := tx.Where("order_id = ?", order.ID).Find(&applied).Error; err != nil {
+		return err
+	}
+	for _, a := range applied {
+		if err := tx.Model(&models.Coupon{}).
+			Where("id = ? AND used_count > 0", a.CouponID).
+			Update("used_count", gorm.Expr("used_count - 1")).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeCouponCode trims and upper-cases a coupon code
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
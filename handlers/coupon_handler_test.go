@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"temp_kbtg_backend/models"
+	"testing"
+)
+
+func TestCouponDiscounts(t *testing.T) {
+	items := []models.LineItem{
+		{ID: 1, SKU: "PEN", ProductName: "Pen", Category: "stationery", Quantity: 3, TotalPrice: 30000},
+		{ID: 2, SKU: "INK", ProductName: "Ink", Category: "stationery", Quantity: 1, TotalPrice: 25000},
+		{ID: 3, SKU: "MUG", ProductName: "Mug", Category: "kitchen", Quantity: 2, TotalPrice: 10000},
+	}
+
+	tests := []struct {
+		name           string
+		coupon         models.Coupon
+		remaining      map[uint]models.Money // Defaults to the item totals
+		orderRemaining models.Money
+		want           map[uint]models.Money // Discount by line item; 0 = order discount
+	}{
+		{
+			name:           "order percentage",
+			coupon:         models.Coupon{Scope: "order", Type: "percentage", PercentOff: 10},
+			orderRemaining: 65000,
+			want:           map[uint]models.Money{0: 6500},
+		},
+		{
+			name:           "order percentage capped by max discount",
+			coupon:         models.Coupon{Scope: "order", Type: "percentage", PercentOff: 10, MaxDiscount: 3000},
+			orderRemaining: 65000,
+			want:           map[uint]models.Money{0: 3000},
+		},
+		{
+			name:           "fixed order discount never exceeds what is left",
+			coupon:         models.Coupon{Scope: "order", Type: "fixed", AmountOff: 100000},
+			orderRemaining: 65000,
+			want:           map[uint]models.Money{0: 65000},
+		},
+		{
+			name:           "nothing left to discount",
+			coupon:         models.Coupon{Scope: "order", Type: "fixed", AmountOff: 1000},
+			orderRemaining: 0,
+			want:           map[uint]models.Money{},
+		},
+		{
+			name:           "fixed line discount is per unit",
+			coupon:         models.Coupon{Scope: "line", Type: "fixed", AmountOff: 500, SKU: "PEN"},
+			orderRemaining: 65000,
+			want:           map[uint]models.Money{1: 1500},
+		},
+		{
+			name:           "line percentage by category",
+			coupon:         models.Coupon{Scope: "line", Type: "percentage", PercentOff: 20, Category: "stationery"},
+			orderRemaining: 65000,
+			want:           map[uint]models.Money{1: 6000, 2: 5000},
+		},
+		{
+			name:           "max discount is shared by the lines",
+			coupon:         models.Coupon{Scope: "line", Type: "percentage", PercentOff: 20, MaxDiscount: 8000},
+			orderRemaining: 65000,
+			want:           map[uint]models.Money{1: 6000, 2: 2000},
+		},
+		{
+			name:           "line discount limited to what earlier discounts left",
+			coupon:         models.Coupon{Scope: "line", Type: "fixed", AmountOff: 5000, SKU: "MUG"},
+			remaining:      map[uint]models.Money{1: 30000, 2: 25000, 3: 4000},
+			orderRemaining: 59000,
+			want:           map[uint]models.Money{3: 4000},
+		},
+		{
+			name:           "no matching items",
+			coupon:         models.Coupon{Scope: "line", Type: "fixed", AmountOff: 500, SKU: "BOOK"},
+			orderRemaining: 65000,
+			want:           map[uint]models.Money{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remaining := tt.remaining
+			if remaining == nil {
+				remaining = make(map[uint]models.Money)
+				for _, item := range items {
+					remaining[item.ID] = item.TotalPrice
+				}
+			}
+			before := make(map[uint]models.Money)
+			for id, amount := range remaining {
+				before[id] = amount
+			}
+
+			got := make(map[uint]models.Money)
+			for _, d := range couponDiscounts(&tt.coupon, items, remaining, tt.orderRemaining) {
+				id := uint(0)
+				if d.LineItemID != nil {
+					id = *d.LineItemID
+				}
+				got[id] += d.Amount
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("couponDiscounts() = %v, want %v", got, tt.want)
+			}
+			for id, amount := range tt.want {
+				if got[id] != amount {
+					t.Errorf("couponDiscounts() = %v, want %v", got, tt.want)
+				}
+				// Line discounts are taken off what is left of their line
+				if id != 0 && remaining[id] != before[id]-amount {
+					t.Errorf("remaining[%d] = %d, want %d", id, remaining[id], before[id]-amount)
+				}
+			}
+		})
+	}
+}
+
+func TestComputeDiscounts(t *testing.T) {
+	items := []models.LineItem{
+		{ID: 1, SKU: "PEN", ProductName: "Pen", Quantity: 3, TotalPrice: 30000},
+		{ID: 2, SKU: "INK", ProductName: "Ink", Quantity: 1, TotalPrice: 25000},
+	}
+	save10 := models.Coupon{ID: 1, Code: "SAVE10", Scope: "order", Type: "percentage", PercentOff: 10}
+	pen5 := models.Coupon{ID: 2, Code: "PEN5", Scope: "line", Type: "fixed", AmountOff: 500, SKU: "PEN"}
+	big := models.Coupon{ID: 3, Code: "BIG", Scope: "order", Type: "fixed", AmountOff: 10000, MinOrderTotal: 100000}
+
+	tests := []struct {
+		name    string
+		coupons []models.Coupon
+		items   []models.LineItem
+		want    []string // Coupon codes in the order their discounts apply
+		total   models.Money
+	}{
+		{
+			name:    "line discounts come before order discounts",
+			coupons: []models.Coupon{save10, pen5},
+			items:   items,
+			want:    []string{"PEN5", "SAVE10"},
+			total:   1500 + 5350, // 10% of 535.00
+		},
+		{
+			name:    "minimum not met",
+			coupons: []models.Coupon{big},
+			items:   items,
+		},
+		{
+			name:    "no items",
+			coupons: []models.Coupon{save10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var subtotal models.Money
+			for _, item := range tt.items {
+				subtotal += item.TotalPrice
+			}
+
+			var codes []string
+			var total models.Money
+			for _, d := range computeDiscounts(tt.coupons, tt.items, subtotal) {
+				codes = append(codes, d.Code)
+				total += d.Amount
+			}
+			if len(codes) != len(tt.want) {
+				t.Fatalf("computeDiscounts() codes = %v, want %v", codes, tt.want)
+			}
+			for i := range codes {
+				if codes[i] != tt.want[i] {
+					t.Errorf("computeDiscounts() codes = %v, want %v", codes, tt.want)
+				}
+			}
+			if total != tt.total {
+				t.Errorf("computeDiscounts() total = %d, want %d", total, tt.total)
+			}
+		})
+	}
+}
@@ -29,9 +29,7 @@ func GetCustomer(c *fiber.Ctx) error {
 	var customer models.Customer
 
 	if err := database.DB.First(&customer, id).Error; err != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"error": "Customer not found",
-		})
+		return customerNotFound(c, id)
 	}
 
 	return c.JSON(fiber.Map{
@@ -50,6 +48,11 @@ func CreateCustomer(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := validateCustomerUser(customer); err != nil {
+		return sendError(c, err, "Failed to create customer")
+	}
+	customer.PhoneNormalized = models.NormalizePhone(customer.Phone)
+
 	if err := database.DB.Create(&customer).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to create customer",
@@ -79,6 +82,11 @@ func UpdateCustomer(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := validateCustomerUser(&customer); err != nil {
+		return sendError(c, err, "Failed to update customer")
+	}
+	customer.PhoneNormalized = models.NormalizePhone(customer.Phone)
+
 	if err := database.DB.Save(&customer).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to update customer",
@@ -113,3 +121,15 @@ func DeleteCustomer(c *fiber.Ctx) error {
 		"message": "Customer deleted successfully",
 	})
 }
+
+// validateCustomerUser checks that a customer's linked points account exists
+func validateCustomerUser(customer *models.Customer) error {
+	if customer.UserID == nil {
+		return nil
+	}
+
+	if err := database.DB.First(&models.User{}, *customer.UserID).Error; err != nil {
+		return newRequestError(400, "Linked user not found")
+	}
+	return nil
+}
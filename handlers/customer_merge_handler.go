@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	// duplicateNameSimilarity is how similar two names must be, from 0 to 1,
+	// for the customers to be reported as possible duplicates
+	duplicateNameSimilarity = 0.6
+	// maxMergeRedirects caps how many merges a lookup follows, e.g. when
+	// a customer was merged into one that was merged again later
+	maxMergeRedirects = 10
+	// defaultMergeActor is recorded when a merge does not name its actor
+	defaultMergeActor = "system"
+)
+
+// CustomerMergeRequest represents the request body for merging a duplicate
+// into a customer
+type CustomerMergeRequest struct {
+	DuplicateID uint   `json:"duplicate_id"`
+	Actor       string `json:"actor"`
+	Reason      string `json:"reason"`
+}
+
+// CustomerDuplicate is a customer that may be the same person as another
+type CustomerDuplicate struct {
+	Customer       models.Customer `json:"customer"`
+	Reasons        []string        `json:"reasons"` // phone, name
+	NameSimilarity float64         `json:"name_similarity"`
+}
+
+// GetCustomerDuplicates returns the customers that may be the same person
+// as a customer: those with the same normalized phone number and those with
+// a similar name. Phone matches come first.
+func GetCustomerDuplicates(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var customer models.Customer
+
+	if err := database.DB.First(&customer, id).Error; err != nil {
+		return customerNotFound(c, id)
+	}
+
+	duplicates := make(map[uint]*CustomerDuplicate)
+	var ids []uint
+	add := func(id uint, reason string, similarity float64) {
+		d, ok := duplicates[id]
+		if !ok {
+			d = &CustomerDuplicate{Reasons: []string{}}
+			duplicates[id] = d
+			ids = append(ids, id)
+		}
+		d.Reasons = append(d.Reasons, reason)
+		d.NameSimilarity = max(d.NameSimilarity, similarity)
+	}
+
+	if customer.PhoneNormalized != "" {
+		var samePhone []models.Customer
+		if err := database.DB.Where("phone_normalized = ? AND id <> ?", customer.PhoneNormalized, customer.ID).
+			Find(&samePhone).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to find duplicates",
+			})
+		}
+		for _, other := range samePhone {
+			add(other.ID, "phone", nameSimilarity(customer.Name, other.Name))
+		}
+	}
+
+	matches, err := searchCustomers(database.DB, customerSearch{text: strings.ToLower(customer.Name)})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to find duplicates",
+		})
+	}
+	for _, m := range matches {
+		if m.ID == customer.ID {
+			continue
+		}
+		if similarity := nameSimilarity(customer.Name, m.Name); similarity >= duplicateNameSimilarity {
+			add(m.ID, "name", similarity)
+		}
+	}
+
+	result := make([]CustomerDuplicate, 0, len(ids))
+	if len(ids) > 0 {
+		var found []models.Customer
+		if err := database.DB.Where("id IN ?", ids).Find(&found).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to find duplicates",
+			})
+		}
+		for _, other := range found {
+			d := duplicates[other.ID]
+			d.Customer = other
+			result = append(result, *d)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		pi, pj := result[i].Reasons[0] == "phone", result[j].Reasons[0] == "phone"
+		if pi != pj {
+			return pi
+		}
+		if result[i].NameSimilarity != result[j].NameSimilarity {
+			return result[i].NameSimilarity > result[j].NameSimilarity
+		}
+		return result[i].Customer.ID < result[j].Customer.ID
+	})
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// MergeCustomer merges a duplicate into a customer. The duplicate's orders,
+// delivery addresses, returns, coupon uses and carts move to the customer,
+// who also takes the duplicate's phone number and points account if they
+// have none. Invoices and credit notes are issued documents and stay with
+// the duplicate's ID. The duplicate is then deleted, the merge is recorded
+// and lookups of the duplicate's ID redirect to the customer.
+func MergeCustomer(c *fiber.Ctx) error {
+	id := c.Params("id")
+	req := new(CustomerMergeRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.DuplicateID == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "duplicate_id is required",
+		})
+	}
+	if req.Actor == "" {
+		req.Actor = defaultMergeActor
+	}
+
+	var customer models.Customer
+	var merge models.CustomerMerge
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&customer, id).Error; err != nil {
+			return newRequestError(404, "Customer not found")
+		}
+		if customer.ID == req.DuplicateID {
+			return newRequestError(400, "Cannot merge a customer into itself")
+		}
+		var duplicate models.Customer
+		if err := tx.First(&duplicate, req.DuplicateID).Error; err != nil {
+			return newRequestError(404, fmt.Sprintf("Duplicate customer %d not found", req.DuplicateID))
+		}
+		// Points earned on the duplicate's orders are reversed from its user,
+		// so two points accounts cannot be combined into one customer
+		if customer.UserID != nil && duplicate.UserID != nil && *customer.UserID != *duplicate.UserID {
+			return newRequestError(409, fmt.Sprintf("Customers %d and %d are linked to different points accounts", customer.ID, duplicate.ID))
+		}
+
+		merge = models.CustomerMerge{
+			SourceID: duplicate.ID,
+			TargetID: customer.ID,
+			Name:     duplicate.Name,
+			Email:    duplicate.Email,
+			Phone:    duplicate.Phone,
+			UserID:   duplicate.UserID,
+			Actor:    req.Actor,
+			Reason:   req.Reason,
+		}
+
+		orders, err := moveCustomerRecords(tx, &models.Order{}, duplicate.ID, customer.ID)
+		if err != nil {
+			return err
+		}
+		merge.Orders = orders
+		for _, model := range []interface{}{&models.OrderReturn{}, &models.OrderCoupon{}} {
+			if _, err := moveCustomerRecords(tx, model, duplicate.ID, customer.ID); err != nil {
+				return err
+			}
+		}
+
+		// The customer keeps their default address, if they have one
+		var defaults int64
+		if err := tx.Model(&models.DeliveryAddress{}).
+			Where("customer_id = ? AND is_default = ?", customer.ID, true).
+			Count(&defaults).Error; err != nil {
+			return err
+		}
+		if defaults > 0 {
+			if err := tx.Model(&models.DeliveryAddress{}).
+				Where("customer_id = ?", duplicate.ID).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		addresses, err := moveCustomerRecords(tx, &models.DeliveryAddress{}, duplicate.ID, customer.ID)
+		if err != nil {
+			return err
+		}
+		merge.Addresses = addresses
+
+		// ... and their active cart; the duplicate's is moved only if they have none
+		var activeCarts int64
+		if err := tx.Model(&models.Cart{}).
+			Where("customer_id = ? AND status = ?", customer.ID, "active").
+			Count(&activeCarts).Error; err != nil {
+			return err
+		}
+		if activeCarts > 0 {
+			if err := tx.Model(&models.Cart{}).
+				Where("customer_id = ? AND status = ?", duplicate.ID, "active").
+				Update("status", "expired").Error; err != nil {
+				return err
+			}
+		}
+		if _, err := moveCustomerRecords(tx, &models.Cart{}, duplicate.ID, customer.ID); err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{}
+		if customer.Phone == "" && duplicate.Phone != "" {
+			updates["phone"] = duplicate.Phone
+			updates["phone_normalized"] = duplicate.PhoneNormalized
+		}
+		if customer.UserID == nil && duplicate.UserID != nil {
+			updates["user_id"] = *duplicate.UserID
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&customer).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(&merge).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&duplicate).Error; err != nil {
+			return err
+		}
+		return tx.First(&customer, customer.ID).Error
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to merge customers")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"customer": customer,
+			"merge":    merge,
+		},
+	})
+}
+
+// GetCustomerMerges returns the duplicates merged into a customer
+func GetCustomerMerges(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var customer models.Customer
+
+	if err := database.DB.First(&customer, id).Error; err != nil {
+		return customerNotFound(c, id)
+	}
+
+	var merges []models.CustomerMerge
+	if err := database.DB.Where("target_id = ?", customer.ID).Order("id ASC").Find(&merges).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch merges",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    merges,
+	})
+}
+
+// customerNotFound responds to a lookup of a customer that does not exist.
+// The ID of a merged customer redirects to the customer it was merged into.
+func customerNotFound(c *fiber.Ctx, id string) error {
+	target, merged := mergedCustomerTarget(database.DB, id)
+	if !merged {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Customer not found",
+		})
+	}
+
+	c.Location(strings.Replace(c.OriginalURL(), "/customers/"+id, fmt.Sprintf("/customers/%d", target), 1))
+	return c.Status(301).JSON(fiber.Map{
+		"error":       "Customer has been merged",
+		"merged_into": target,
+	})
+}
+
+// mergedCustomerTarget returns the customer that the customer with the
+// given ID was merged into, following later merges of that customer
+func mergedCustomerTarget(tx *gorm.DB, id string) (uint, bool) {
+	var merge models.CustomerMerge
+	if err := tx.Where("source_id = ?", id).First(&merge).Error; err != nil {
+		return 0, false
+	}
+
+	target := merge.TargetID
+	for i := 0; i < maxMergeRedirects; i++ {
+		var next models.CustomerMerge
+		if err := tx.Where("source_id = ?", target).First(&next).Error; err != nil {
+			break
+		}
+		target = next.TargetID
+	}
+	return target, true
+}
+
+// moveCustomerRecords moves the rows of model belonging to one customer to
+// another and returns how many moved
+func moveCustomerRecords(tx *gorm.DB, model interface{}, fromID, toID uint) (int, error) {
+	result := tx.Model(model).Where("customer_id = ?", fromID).Update("customer_id", toID)
+	return int(result.RowsAffected), result.Error
+}
+
+// nameSimilarity compares two names, ignoring case and word order
+func nameSimilarity(a, b string) float64 {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	sorted := func(s string) string {
+		words := searchWords(s)
+		sort.Strings(words)
+		return strings.Join(words, " ")
+	}
+	return max(trigramSimilarity(a, b), trigramSimilarity(sorted(a), sorted(b)))
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"temp_kbtg_backend/models"
+	"testing"
+)
+
+func TestMergeCustomerPointsAccounts(t *testing.T) {
+	one, two := uint(1), uint(2)
+
+	tests := []struct {
+		name          string
+		customerUser  *uint
+		duplicateUser *uint
+		wantStatus    int
+		wantUser      *uint // Of the customer after the merge
+	}{
+		{"neither linked", nil, nil, 200, nil},
+		{"duplicate linked", nil, &two, 200, &two},
+		{"customer linked", &one, nil, 200, &one},
+		{"same account", &one, &one, 200, &one},
+		{"different accounts", &one, &two, 409, &one},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t)
+			createRecords(t, db,
+				&models.User{Name: "A", Email: "a@example.com", ReferralCode: "A"},
+				&models.User{Name: "B", Email: "b@example.com", ReferralCode: "B"},
+				&models.Customer{Name: "A", Email: "a@example.com", UserID: tt.customerUser},
+				&models.Customer{Name: "A", Email: "a.dup@example.com", UserID: tt.duplicateUser})
+
+			status, body := sendRequest(t, MergeCustomer, "POST", "/customers/:id/merge", "/customers/1/merge", `{"duplicate_id": 2}`)
+			if status != tt.wantStatus {
+				t.Fatalf("MergeCustomer returned %d, want %d: %v", status, tt.wantStatus, body)
+			}
+
+			var customer models.Customer
+			if err := db.First(&customer, 1).Error; err != nil {
+				t.Fatal(err)
+			}
+			if (customer.UserID == nil) != (tt.wantUser == nil) || customer.UserID != nil && *customer.UserID != *tt.wantUser {
+				t.Errorf("customer user_id = %v, want %v", customer.UserID, tt.wantUser)
+			}
+
+			var duplicates int64
+			db.Model(&models.Customer{}).Where("id = ?", 2).Count(&duplicates)
+			if merged := duplicates == 0; merged != (tt.wantStatus == 200) {
+				t.Errorf("duplicate merged = %v, want %v", merged, tt.wantStatus == 200)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"sort"
+	"strings"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	// minTrigramSimilarity is how similar, from 0 to 1, a customer's name or
+	// email or one of their words must be to a query they don't contain
+	minTrigramSimilarity = 0.45
+	// maxSearchCandidates caps how many customers a search ranks
+	maxSearchCandidates = 1000
+)
+
+// customerSearch is a normalized search query
+type customerSearch struct {
+	text  string // Lower-cased query, or the normalized number of a phone search
+	phone bool   // Query looks like a phone number and only matches phones
+}
+
+// customerMatch is a customer a search found, with how well it matched
+type customerMatch struct {
+	ID              uint
+	Name            string
+	Email           string
+	PhoneNormalized string
+	prefix          bool    // A field, or one of its words, starts with the query
+	similarity      float64 // Best trigram similarity of a field or word; 1 when one contains the query
+}
+
+// SearchCustomers finds customers whose name, email or phone starts with,
+// contains or resembles the q query parameter. Prefix matches come first,
+// then the rest by relevance; results are paginated like order listings.
+func SearchCustomers(c *fiber.Ctx) error {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "q is required",
+		})
+	}
+
+	page, err := parsePagination(c)
+	if err != nil {
+		return sendError(c, err, "Failed to search customers")
+	}
+
+	matches, err := searchCustomers(database.DB, parseCustomerSearch(q))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to search customers",
+		})
+	}
+
+	page.setTotal(int64(len(matches)))
+	start, end := page.window(len(matches))
+	ids := make([]uint, 0, end-start)
+	for _, m := range matches[start:end] {
+		ids = append(ids, m.ID)
+	}
+
+	customers := make([]models.Customer, 0, len(ids))
+	if len(ids) > 0 {
+		var found []models.Customer
+		if err := database.DB.Where("id IN ?", ids).Find(&found).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to search customers",
+			})
+		}
+		byID := make(map[uint]models.Customer, len(found))
+		for _, customer := range found {
+			byID[customer.ID] = customer
+		}
+		for _, id := range ids {
+			if customer, ok := byID[id]; ok {
+				customers = append(customers, customer)
+			}
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"success":    true,
+		"data":       customers,
+		"pagination": page,
+	})
+}
+
+// parseCustomerSearch normalizes a query. Queries made only of digits and
+// phone punctuation search phone numbers.
+func parseCustomerSearch(q string) customerSearch {
+	digits := 0
+	for _, r := range q {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case strings.ContainsRune(" +-().", r):
+		default:
+			return customerSearch{text: strings.ToLower(q)}
+		}
+	}
+	if digits == 0 {
+		return customerSearch{text: strings.ToLower(q)}
+	}
+	return customerSearch{text: models.NormalizePhone(q), phone: true}
+}
+
+// searchCustomers returns the customers matching search, prefix matches
+// first. Queries of three characters or more are looked up in the trigram
+// index, which finds customers sharing any three-letter sequence with the
+// query; those not similar enough are dropped and the rest keep the index's
+// bm25 ranking, names weighing most. Without the index, customers sharing
+// a three-letter sequence are found with LIKE and ranked by similarity.
+// Either way at most maxSearchCandidates are ranked. Shorter queries only
+// match prefixes.
+func searchCustomers(tx *gorm.DB, search customerSearch) ([]customerMatch, error) {
+	var candidates []customerMatch
+	switch {
+	case len([]rune(search.text)) < 3:
+		pattern := escapeLike(search.text) + "%"
+		query := tx.Model(&models.Customer{}).Select("id, name, email, phone_normalized")
+		if search.phone {
+			query = query.Where(`phone_normalized LIKE ? ESCAPE '\'`, pattern)
+		} else {
+			query = query.Where(`name LIKE ? ESCAPE '\' OR name LIKE ? ESCAPE '\' OR email LIKE ? ESCAPE '\'`,
+				pattern, "% "+pattern, pattern)
+		}
+		if err := query.Order("name ASC, id ASC").Limit(maxSearchCandidates).Scan(&candidates).Error; err != nil {
+			return nil, err
+		}
+	case database.CustomerSearchIndex:
+		columns := "{name email}"
+		if search.phone {
+			columns = "phone_normalized"
+		}
+		var terms []string
+		for _, t := range trigrams(search.text) {
+			terms = append(terms, `"`+strings.ReplaceAll(t, `"`, `""`)+`"`)
+		}
+		if err := tx.Raw(`SELECT rowid AS id, name, email, phone_normalized FROM customers_fts
+			WHERE customers_fts MATCH ?
+			ORDER BY bm25(customers_fts, 10.0, 5.0, 5.0), rowid LIMIT ?`,
+			columns+" : ("+strings.Join(terms, " OR ")+")", maxSearchCandidates).
+			Scan(&candidates).Error; err != nil {
+			return nil, err
+		}
+	default:
+		// Without the index the same candidates are found with LIKE, those
+		// containing the whole query first so the limit keeps them
+		columns := []string{"name", "email"}
+		if search.phone {
+			columns = []string{"phone_normalized"}
+		}
+		var conditions, contains []string
+		var args []interface{}
+		for _, t := range trigrams(search.text) {
+			for _, column := range columns {
+				conditions = append(conditions, column+` LIKE ? ESCAPE '\'`)
+				args = append(args, "%"+escapeLike(t)+"%")
+			}
+		}
+		for _, column := range columns {
+			contains = append(contains, column+` LIKE ? ESCAPE '\'`)
+			args = append(args, "%"+escapeLike(search.text)+"%")
+		}
+		if err := tx.Raw(`SELECT id, name, email, phone_normalized FROM customers
+			WHERE `+strings.Join(conditions, " OR ")+`
+			ORDER BY CASE WHEN `+strings.Join(contains, " OR ")+` THEN 0 ELSE 1 END, id LIMIT ?`,
+			append(args, maxSearchCandidates)...).
+			Scan(&candidates).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var matches []customerMatch
+	for _, m := range candidates {
+		scoreCustomerMatch(&m, search)
+		if m.prefix || m.similarity >= minTrigramSimilarity {
+			matches = append(matches, m)
+		}
+	}
+
+	// Without the index nothing has ranked the candidates yet
+	if !database.CustomerSearchIndex {
+		sort.SliceStable(matches, func(i, j int) bool {
+			return matches[i].similarity > matches[j].similarity
+		})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].prefix && !matches[j].prefix
+	})
+	return matches, nil
+}
+
+// scoreCustomerMatch works out whether m's name, email or phone starts with
+// the query and how similar they are to it. Names and emails are compared
+// whole and word by word, so a misspelt first name still matches; phone
+// numbers only match when they contain the query.
+func scoreCustomerMatch(m *customerMatch, search customerSearch) {
+	if search.phone {
+		m.prefix = strings.HasPrefix(m.PhoneNormalized, search.text)
+		if strings.Contains(m.PhoneNormalized, search.text) {
+			m.similarity = 1
+		}
+		return
+	}
+
+	name := strings.ToLower(m.Name)
+	email := strings.ToLower(m.Email)
+	localPart, _, _ := strings.Cut(email, "@")
+	texts := append([]string{name, email}, searchWords(name)...)
+	texts = append(texts, searchWords(localPart)...)
+	for _, text := range texts {
+		switch {
+		case strings.HasPrefix(text, search.text):
+			m.prefix = true
+			m.similarity = 1
+		case strings.Contains(text, search.text):
+			m.similarity = 1
+		default:
+			m.similarity = max(m.similarity, trigramSimilarity(search.text, text))
+		}
+	}
+}
+
+// searchWords splits s into words. Thai vowel and tone marks are part of
+// their word.
+func searchWords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r)
+	})
+}
+
+// trigrams returns the distinct three-character sequences of s
+func trigrams(s string) []string {
+	runes := []rune(s)
+	seen := make(map[string]bool)
+	var result []string
+	for i := 0; i+3 <= len(runes); i++ {
+		t := string(runes[i : i+3])
+		if !seen[t] {
+			seen[t] = true
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// trigramSimilarity returns the Dice coefficient of the trigrams of a and b,
+// padded so that matching first and last letters count
+func trigramSimilarity(a, b string) float64 {
+	ta, tb := trigrams("  "+a+" "), trigrams("  "+b+" ")
+	inB := make(map[string]bool, len(tb))
+	for _, t := range tb {
+		inB[t] = true
+	}
+	shared := 0
+	for _, t := range ta {
+		if inB[t] {
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(ta)+len(tb))
+}
+
+// escapeLike escapes the LIKE wildcards in s, for patterns using ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
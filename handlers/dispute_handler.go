@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"fmt"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// CreateDisputeRequest represents the request body for opening a dispute
+type CreateDisputeRequest struct {
+	OpenedByUserID uint   `json:"opened_by_user_id"`
+	Reason         string `json:"reason"`
+	Description    string `json:"description"`
+}
+
+// AddDisputeNoteRequest represents the request body for adding evidence to a dispute
+type AddDisputeNoteRequest struct {
+	Author string `json:"author"`
+	Note   string `json:"note"`
+}
+
+// ResolveDisputeRequest represents the request body for resolving a dispute
+type ResolveDisputeRequest struct {
+	Outcome    string `json:"outcome"` // "refund" or "reject"
+	Resolution string `json:"resolution"`
+}
+
+// activeDisputeStatuses are the dispute states that still await a decision
+var activeDisputeStatuses = []string{"open", "under_review"}
+
+// GetDisputes returns all disputes with optional filtering
+func GetDisputes(c *fiber.Ctx) error {
+	var disputes []models.Dispute
+
+	query := database.DB.Preload("Transfer")
+
+	// Optional filters
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if transferID := c.Query("transfer_id"); transferID != "" {
+		query = query.Where("transfer_id = ?", transferID)
+	}
+
+	if err := query.Order("created_at DESC").Find(&disputes).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch disputes",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    disputes,
+	})
+}
+
+// GetDispute returns a single dispute with its transfer and evidence notes
+func GetDispute(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var dispute models.Dispute
+
+	if err := database.DB.Preload("Transfer").Preload("Notes").First(&dispute, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Dispute not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    dispute,
+	})
+}
+
+// CreateDispute opens a dispute against a transfer
+func CreateDispute(c *fiber.Ctx) error {
+	idempotencyKey := c.Params("id")
+	req := new(CreateDisputeRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.OpenedByUserID == 0 || req.Reason == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "opened_by_user_id and reason are required",
+		})
+	}
+	if req.Reason != "unauthorized" && req.Reason != "mistaken" && req.Reason != "other" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "reason must be one of: unauthorized, mistaken, other",
+		})
+	}
+
+	var dispute models.Dispute
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var transfer models.Transfer
+		if err := tx.Where("idempotency_key = ?", idempotencyKey).First(&transfer).Error; err != nil {
+			return newRequestError(404, "Transfer not found")
+		}
+
+		if req.OpenedByUserID != transfer.FromUserID && req.OpenedByUserID != transfer.ToUserID {
+			return newRequestError(400, "Only the sender or receiver can dispute a transfer")
+		}
+
+		// Completed transfers and held escrow transfers can be disputed
+		held := transfer.IsEscrow && transfer.Status == "processing"
+		if transfer.Status != "completed" && !held {
+			return newRequestError(400, fmt.Sprintf("Cannot dispute transfer with status: %s", transfer.Status))
+		}
+
+		var active int64
+		if err := tx.Model(&models.Dispute{}).
+			Where("transfer_id = ? AND status IN ?", transfer.ID, activeDisputeStatuses).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			return newRequestError(400, "Transfer already has an open dispute")
+		}
+
+		dispute = models.Dispute{
+			TransferID:     transfer.ID,
+			OpenedByUserID: req.OpenedByUserID,
+			Reason:         req.Reason,
+			Description:    req.Description,
+			Status:         "open",
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		}
+		if err := tx.Create(&dispute).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&transfer).Update("is_disputed", true).Error
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to create dispute")
+	}
+
+	database.DB.Preload("Transfer").First(&dispute, dispute.ID)
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    dispute,
+	})
+}
+
+// AddDisputeNote attaches an evidence note to an unresolved dispute
+func AddDisputeNote(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var dispute models.Dispute
+
+	if err := database.DB.First(&dispute, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Dispute not found",
+		})
+	}
+
+	req := new(AddDisputeNoteRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Author == "" || req.Note == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "author and note are required",
+		})
+	}
+
+	if dispute.Status != "open" && dispute.Status != "under_review" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot add notes to a resolved dispute",
+		})
+	}
+
+	note := models.DisputeNote{
+		DisputeID: dispute.ID,
+		Author:    req.Author,
+		Note:      req.Note,
+		CreatedAt: time.Now(),
+	}
+	if err := database.DB.Create(&note).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to add dispute note",
+		})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    note,
+	})
+}
+
+// ReviewDispute moves an open dispute to under_review
+func ReviewDispute(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var dispute models.Dispute
+
+	if err := database.DB.First(&dispute, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Dispute not found",
+		})
+	}
+
+	if dispute.Status != "open" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("Cannot review dispute with status: %s", dispute.Status),
+		})
+	}
+
+	dispute.Status = "under_review"
+	dispute.UpdatedAt = time.Now()
+	if err := database.DB.Save(&dispute).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to update dispute",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    dispute,
+	})
+}
+
+// ResolveDispute closes a dispute. A refund outcome reverses the transfer,
+// or refunds the sender if the transfer is still held in escrow.
+func ResolveDispute(c *fiber.Ctx) error {
+	id := c.Params("id")
+	req := new(ResolveDisputeRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Outcome != "refund" && req.Outcome != "reject" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "outcome must be either refund or reject",
+		})
+	}
+
+	var dispute models.Dispute
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Transfer").First(&dispute, id).Error; err != nil {
+			return newRequestError(404, "Dispute not found")
+		}
+
+		if dispute.Status != "open" && dispute.Status != "under_review" {
+			return newRequestError(400, fmt.Sprintf("Cannot resolve dispute with status: %s", dispute.Status))
+		}
+
+		now := time.Now()
+		dispute.Status = "resolved_rejected"
+		dispute.Resolution = req.Resolution
+		dispute.ResolvedAt = &now
+		dispute.UpdatedAt = now
+
+		if req.Outcome == "refund" {
+			dispute.Status = "resolved_refund"
+			reason := fmt.Sprintf("Dispute #%d resolved with refund", dispute.ID)
+
+			transfer := dispute.Transfer
+			if transfer.IsEscrow && transfer.Status == "processing" {
+				if err := refundEscrow(tx, transfer, reason); err != nil {
+					return err
+				}
+			} else if err := reverseTransfer(tx, transfer, reason); err != nil {
+				return err
+			}
+		}
+
+		return tx.Omit("Transfer", "Notes").Save(&dispute).Error
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to resolve dispute")
+	}
+
+	database.DB.Preload("Transfer").Preload("Notes").First(&dispute, dispute.ID)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    dispute,
+	})
+}
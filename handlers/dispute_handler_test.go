@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"fmt"
+	"temp_kbtg_backend/models"
+	"testing"
+)
+
+func TestCreateDispute(t *testing.T) {
+	tests := []struct {
+		name       string
+		transfer   string // Status of the transfer
+		escrow     bool
+		openedBy   uint
+		existing   string // Status of an earlier dispute; empty for none
+		wantStatus int
+	}{
+		{name: "sender disputes a completed transfer", transfer: "completed", openedBy: 1, wantStatus: 201},
+		{name: "receiver disputes a held escrow transfer", transfer: "processing", escrow: true, openedBy: 2, wantStatus: 201},
+		{name: "another user", transfer: "completed", openedBy: 3, wantStatus: 400},
+		{name: "reversed transfer", transfer: "reversed", openedBy: 1, wantStatus: 400},
+		{name: "dispute already open", transfer: "completed", openedBy: 1, existing: "under_review", wantStatus: 400},
+		{name: "earlier dispute resolved", transfer: "completed", openedBy: 1, existing: "resolved_rejected", wantStatus: 201},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t)
+			transfer := models.Transfer{FromUserID: 1, ToUserID: 2, Amount: 30, Status: tt.transfer, IsEscrow: tt.escrow, IdempotencyKey: "t-1"}
+			createRecords(t, db, &transfer)
+			if tt.existing != "" {
+				createRecords(t, db, &models.Dispute{TransferID: transfer.ID, OpenedByUserID: 1, Reason: "other", Status: tt.existing})
+			}
+
+			status, body := sendRequest(t, CreateDispute, "POST", "/transfers/:id/disputes", "/transfers/t-1/disputes",
+				fmt.Sprintf(`{"opened_by_user_id": %d, "reason": "mistaken"}`, tt.openedBy))
+			if status != tt.wantStatus {
+				t.Fatalf("CreateDispute returned %d, want %d: %v", status, tt.wantStatus, body)
+			}
+
+			if err := db.First(&transfer, transfer.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if transfer.IsDisputed != (tt.wantStatus == 201) {
+				t.Errorf("transfer is_disputed = %v, want %v", transfer.IsDisputed, tt.wantStatus == 201)
+			}
+		})
+	}
+}
+
+func TestResolveDispute(t *testing.T) {
+	tests := []struct {
+		name         string
+		transfer     string
+		escrow       bool
+		dispute      string
+		outcome      string
+		wantStatus   int
+		wantDispute  string
+		wantTransfer string
+		wantSender   int
+		wantReceiver int
+	}{
+		{
+			name: "refund reverses a completed transfer", transfer: "completed", dispute: "under_review", outcome: "refund",
+			wantStatus: 200, wantDispute: "resolved_refund", wantTransfer: "reversed", wantSender: 100, wantReceiver: 0,
+		},
+		{
+			name: "refund returns held escrow to the sender", transfer: "processing", escrow: true, dispute: "open", outcome: "refund",
+			wantStatus: 200, wantDispute: "resolved_refund", wantTransfer: "reversed", wantSender: 100, wantReceiver: 0,
+		},
+		{
+			name: "reject leaves the transfer", transfer: "completed", dispute: "open", outcome: "reject",
+			wantStatus: 200, wantDispute: "resolved_rejected", wantTransfer: "completed", wantSender: 70, wantReceiver: 30,
+		},
+		{
+			name: "already resolved", transfer: "completed", dispute: "resolved_rejected", outcome: "refund",
+			wantStatus: 400, wantDispute: "resolved_rejected", wantTransfer: "completed", wantSender: 70, wantReceiver: 30,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t)
+			// The sender has paid 30 points; a completed transfer has credited them to the receiver
+			receiver := 30
+			if tt.escrow {
+				receiver = 0
+			}
+			transfer := models.Transfer{FromUserID: 1, ToUserID: 2, Amount: 30, Status: tt.transfer, IsEscrow: tt.escrow, IdempotencyKey: "t-1"}
+			createRecords(t, db,
+				&models.User{Name: "A", Email: "a@example.com", ReferralCode: "A", Balance: 70},
+				&models.User{Name: "B", Email: "b@example.com", ReferralCode: "B", Balance: receiver},
+				&transfer)
+			dispute := models.Dispute{TransferID: transfer.ID, OpenedByUserID: 1, Reason: "mistaken", Status: tt.dispute}
+			createRecords(t, db, &dispute)
+
+			status, body := sendRequest(t, ResolveDispute, "POST", "/disputes/:id/resolve", fmt.Sprintf("/disputes/%d/resolve", dispute.ID),
+				fmt.Sprintf(`{"outcome": %q}`, tt.outcome))
+			if status != tt.wantStatus {
+				t.Fatalf("ResolveDispute returned %d, want %d: %v", status, tt.wantStatus, body)
+			}
+
+			if err := db.First(&dispute, dispute.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := db.First(&transfer, transfer.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if dispute.Status != tt.wantDispute || transfer.Status != tt.wantTransfer {
+				t.Errorf("dispute %s, transfer %s; want %s, %s", dispute.Status, transfer.Status, tt.wantDispute, tt.wantTransfer)
+			}
+			for id, want := range map[uint]int{1: tt.wantSender, 2: tt.wantReceiver} {
+				var user models.User
+				if err := db.First(&user, id).Error; err != nil {
+					t.Fatal(err)
+				}
+				if user.Balance != want {
+					t.Errorf("user %d balance = %d, want %d", id, user.Balance, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// EarnRuleRequest represents the request body for creating or updating an earn rule
+type EarnRuleRequest struct {
+	Name                string                    `json:"name"`
+	PointType           string                    `json:"point_type"`
+	Rate                float64                   `json:"rate"`
+	MinSpend            models.Money              `json:"min_spend"`
+	Active              *bool                     `json:"active"`
+	CategoryMultipliers []models.EarnRuleCategory `json:"category_multipliers"`
+}
+
+// earningOrderStatuses are the order statuses that award loyalty points.
+// Delivered replaced the old completed status; as delivered orders cannot be
+// cancelled, refunding their returns is the only way points are taken back.
+var earningOrderStatuses = map[string]bool{
+	"delivered": true,
+}
+
+// GetEarnRules returns all earn rules with their category multipliers
+func GetEarnRules(c *fiber.Ctx) error {
+	var rules []models.EarnRule
+
+	if err := database.DB.Preload("CategoryMultipliers").Find(&rules).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch earn rules",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    rules,
+	})
+}
+
+// GetEarnRule returns a single earn rule by ID
+func GetEarnRule(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var rule models.EarnRule
+
+	if err := database.DB.Preload("CategoryMultipliers").First(&rule, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Earn rule not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    rule,
+	})
+}
+
+// CreateEarnRule creates a new earn rule
+func CreateEarnRule(c *fiber.Ctx) error {
+	req := new(EarnRuleRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	rule := models.EarnRule{Active: true}
+	if err := saveEarnRule(&rule, req); err != nil {
+		return sendError(c, err, "Failed to create earn rule")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    rule,
+	})
+}
+
+// UpdateEarnRule replaces an earn rule and its category multipliers
+func UpdateEarnRule(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var rule models.EarnRule
+
+	if err := database.DB.First(&rule, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Earn rule not found",
+		})
+	}
+
+	req := new(EarnRuleRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := saveEarnRule(&rule, req); err != nil {
+		return sendError(c, err, "Failed to update earn rule")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    rule,
+	})
+}
+
+// DeleteEarnRule deletes an earn rule
+func DeleteEarnRule(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var rule models.EarnRule
+
+	if err := database.DB.First(&rule, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Earn rule not found",
+		})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("earn_rule_id = ?", rule.ID).Delete(&models.EarnRuleCategory{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&rule).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to delete earn rule",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Earn rule deleted successfully",
+	})
+}
+
+// saveEarnRule validates req, copies it onto rule and stores the rule with
+// its category multipliers
+func saveEarnRule(rule *models.EarnRule, req *EarnRuleRequest) error {
+	if req.Name == "" || req.Rate < 0 || req.MinSpend < 0 {
+		return newRequestError(400, "Name is required and rate and min_spend cannot be negative")
+	}
+	for _, m := range req.CategoryMultipliers {
+		if m.Category == "" || m.Multiplier < 0 {
+			return newRequestError(400, "Each category multiplier needs a category and a non-negative multiplier")
+		}
+	}
+
+	rule.Name = req.Name
+	rule.PointType = req.PointType
+	if rule.PointType == "" {
+		rule.PointType = models.DefaultPointType
+	}
+	rule.Rate = req.Rate
+	rule.MinSpend = req.MinSpend
+	if req.Active != nil {
+		rule.Active = *req.Active
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := findPointType(tx, rule.PointType); err != nil {
+			return err
+		}
+		if err := tx.Omit("CategoryMultipliers").Save(rule).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("earn_rule_id = ?", rule.ID).Delete(&models.EarnRuleCategory{}).Error; err != nil {
+			return err
+		}
+		rule.CategoryMultipliers = nil
+		for _, m := range req.CategoryMultipliers {
+			multiplier := models.EarnRuleCategory{
+				EarnRuleID: rule.ID,
+				Category:   m.Category,
+				Multiplier: m.Multiplier,
+			}
+			if err := tx.Create(&multiplier).Error; err != nil {
+				return err
+			}
+			rule.CategoryMultipliers = append(rule.CategoryMultipliers, multiplier)
+		}
+
+		return nil
+	})
+}
+
+// awardOrderPoints credits the user linked to the order's customer with the
+// points earned under every active earn rule. Orders that already earned
+// points are skipped, so it is safe to call on every status change.
+func awardOrderPoints(tx *gorm.DB, order *models.Order) error {
+	var customer models.Customer
+	if err := tx.First(&customer, order.CustomerID).Error; err != nil || customer.UserID == nil {
+		return nil
+	}
+
+	var earned int64
+	if err := tx.Model(&models.PointLedger{}).
+		Where("order_id = ? AND event_type = ?", order.ID, "earn").
+		Count(&earned).Error; err != nil {
+		return err
+	}
+	if earned > 0 {
+		return nil
+	}
+
+	var rules []models.EarnRule
+	if err := tx.Preload("CategoryMultipliers").Where("active = ?", true).Find(&rules).Error; err != nil {
+		return err
+	}
+
+	var items []models.LineItem
+	if err := tx.Where("order_id = ?", order.ID).Find(&items).Error; err != nil {
+		return err
+	}
+
+	var user models.User
+	if err := tx.First(&user, *customer.UserID).Error; err != nil {
+		return nil
+	}
+	tier, err := userTier(tx, &user)
+	if err != nil {
+		return err
+	}
+	tierCode, tierMultiplier := "", 1.0
+	if tier != nil {
+		tierCode, tierMultiplier = tier.Code, tier.EarnMultiplier
+	}
+
+	earnedByType := make(map[string]int)
+	for _, rule := range rules {
+		points := floorPoints(orderEarnPoints(rule, order, items) * tierMultiplier)
+		if points <= 0 {
+			continue
+		}
+		earnedByType[rule.PointType] += points
+
+		if _, err := applyPoints(tx, pointEntry{
+			UserID:    *customer.UserID,
+			PointType: rule.PointType,
+			Change:    points,
+			EventType: "earn",
+			OrderID:   &order.ID,
+			Reference: fmt.Sprintf("order-%d", order.ID),
+			Metadata: ledgerMetadata(map[string]interface{}{
+				"earn_rule_id":    rule.ID,
+				"rate":            rule.Rate,
+				"order_total":     order.TotalPrice,
+				"tier":            tierCode,
+				"tier_multiplier": tierMultiplier,
+			}),
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := applyCampaigns(tx, campaignEvent{
+		Trigger:    "order",
+		UserID:     user.ID,
+		OrderID:    &order.ID,
+		OrderTotal: order.TotalPrice,
+		Earned:     earnedByType,
+	}); err != nil {
+		return err
+	}
+
+	if err := qualifyReferral(tx, user.ID, "order"); err != nil {
+		return err
+	}
+
+	// Upgrade straight away rather than waiting for the next recompute
+	_, err = recomputeUserTier(tx, &user)
+	return err
+}
+
+// orderEarnPoints works out the unrounded points one rule awards for an
+// order. Line items earn on what they cost after discounts, weighted by
+// their category multiplier; orders without line items earn on TotalPrice
+// at the base rate.
+func orderEarnPoints(rule models.EarnRule, order *models.Order, items []models.LineItem) float64 {
+	if order.TotalPrice < rule.MinSpend {
+		return 0
+	}
+
+	if len(items) == 0 {
+		return order.TotalPrice.Float() * rule.Rate
+	}
+
+	multipliers := make(map[string]float64)
+	for _, m := range rule.CategoryMultipliers {
+		multipliers[m.Category] = m.Multiplier
+	}
+
+	total := 0.0
+	for _, item := range items {
+		multiplier := 1.0
+		if m, ok := multipliers[item.Category]; ok {
+			multiplier = m
+		}
+		total += (item.TotalPrice - item.Discount).Float() * rule.Rate * multiplier
+	}
+
+	return total
+}
+
+// floorPoints rounds earned points down, ignoring float noise such as 6.9999999
+func floorPoints(points float64) int {
+	return int(math.Floor(points + 1e-9))
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"temp_kbtg_backend/models"
+	"testing"
+	"time"
+)
+
+func TestOrderEarnPointsAfterDiscounts(t *testing.T) {
+	rule := models.EarnRule{
+		Rate:                0.1,
+		CategoryMultipliers: []models.EarnRuleCategory{{Category: "kitchen", Multiplier: 2}},
+	}
+
+	tests := []struct {
+		name    string
+		coupons []models.Coupon
+		want    int
+	}{
+		{
+			name: "no coupons",
+			want: 60 + 20*2, // 600.00 of pens, 200.00 of mugs
+		},
+		{
+			name:    "order coupon",
+			coupons: []models.Coupon{{Code: "SAVE10", Scope: "order", Type: "percentage", PercentOff: 10}},
+			want:    54 + 18*2,
+		},
+		{
+			name:    "line coupon",
+			coupons: []models.Coupon{{Code: "PEN50", Scope: "line", Type: "fixed", AmountOff: 5000, SKU: "PEN"}},
+			want:    45 + 20*2,
+		},
+		{
+			name: "line and order coupons",
+			coupons: []models.Coupon{
+				{Code: "SAVE10", Scope: "order", Type: "percentage", PercentOff: 10},
+				{Code: "PEN50", Scope: "line", Type: "fixed", AmountOff: 5000, SKU: "PEN"},
+			},
+			// 10% off the 450.00 of pens and 200.00 of mugs left after PEN50
+			want: 40 + 18*2,
+		},
+		{
+			name:    "free order",
+			coupons: []models.Coupon{{Code: "FREE", Scope: "order", Type: "percentage", PercentOff: 100}},
+			want:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t)
+			order := models.Order{CustomerID: 1, OrderDate: time.Now().UTC(), Status: "pending", Currency: models.DefaultCurrency}
+			createRecords(t, db,
+				&models.TaxRule{Country: "TH", Name: "VAT", Rate: 7, PricesIncludeTax: true, Active: true},
+				&order)
+			createRecords(t, db,
+				&models.LineItem{OrderID: order.ID, SKU: "PEN", ProductName: "Pen", Category: "stationery",
+					Quantity: 3, UnitPrice: 20000, TotalPrice: 60000},
+				&models.LineItem{OrderID: order.ID, SKU: "MUG", ProductName: "Mug", Category: "kitchen",
+					Quantity: 1, UnitPrice: 20000, TotalPrice: 20000})
+			for i := range tt.coupons {
+				coupon := &tt.coupons[i]
+				coupon.Active = true
+				createRecords(t, db, coupon)
+				createRecords(t, db, &models.OrderCoupon{OrderID: order.ID, CouponID: coupon.ID, CustomerID: 1, Code: coupon.Code})
+			}
+
+			if err := recalculateOrderTotal(db, &order); err != nil {
+				t.Fatal(err)
+			}
+			var items []models.LineItem
+			if err := db.Where("order_id = ?", order.ID).Order("id ASC").Find(&items).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			if got := floorPoints(orderEarnPoints(rule, &order, items)); got != tt.want {
+				t.Errorf("orderEarnPoints() = %d, want %d (order total %s)", got, tt.want, order.TotalPrice)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// requestError is returned by business logic helpers so the calling handler
+// can respond with the right status code and message
+type requestError struct {
+	Status  int
+	Message string
+}
+
+func (e *requestError) Error() string {
+	return e.Message
+}
+
+func newRequestError(status int, message string) error {
+	return &requestError{Status: status, Message: message}
+}
+
+// sendError writes err as a standard error response. Errors that did not come
+// from newRequestError are reported as a 500 with the fallback message.
+func sendError(c *fiber.Ctx, err error, fallback string) error {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return c.Status(reqErr.Status).JSON(fiber.Map{
+			"error": reqErr.Message,
+		})
+	}
+
+	return c.Status(500).JSON(fiber.Map{
+		"error": fallback,
+	})
+}
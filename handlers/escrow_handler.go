@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"log"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// defaultEscrowTimeoutHours is used when an escrow transfer does not set
+// escrow_timeout_hours
+const defaultEscrowTimeoutHours = 72
+
+// holdEscrow takes the points from the sender and records the held amount on
+// both users' ledgers. The receiver's entry has no balance change.
+func holdEscrow(tx *gorm.DB, transfer *models.Transfer) error {
+	metadata := ledgerMetadata(map[string]interface{}{
+		"held_amount": transfer.Amount,
+		"expires_at":  transfer.EscrowExpiresAt,
+	})
+
+	if _, err := applyPoints(tx, pointEntry{
+		UserID:     transfer.FromUserID,
+		PointType:  transfer.PointType,
+		Change:     -transfer.Amount,
+		EventType:  "escrow_hold",
+		TransferID: &transfer.ID,
+		Reference:  transfer.IdempotencyKey,
+		Metadata:   metadata,
+	}); err != nil {
+		return err
+	}
+
+	_, err := applyPoints(tx, pointEntry{
+		UserID:     transfer.ToUserID,
+		PointType:  transfer.PointType,
+		Change:     0,
+		EventType:  "escrow_hold",
+		TransferID: &transfer.ID,
+		Reference:  transfer.IdempotencyKey,
+		Metadata:   metadata,
+	})
+	return err
+}
+
+// settleEscrow moves a held escrow transfer out of "processing". The
+// conditional update makes sure only one caller can settle a transfer.
+func settleEscrow(tx *gorm.DB, transfer *models.Transfer, status string, reason string) error {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":     status,
+		"updated_at": now,
+	}
+	if status == "completed" {
+		updates["completed_at"] = now
+	}
+	if reason != "" {
+		updates["fail_reason"] = reason
+	}
+
+	result := tx.Model(&models.Transfer{}).
+		Where("id = ? AND is_escrow = ? AND status = ?", transfer.ID, true, "processing").
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return newRequestError(400, "Escrow transfer is no longer held")
+	}
+
+	return tx.First(transfer, transfer.ID).Error
+}
+
+// releaseEscrow credits the held points to the receiver and completes the transfer
+func releaseEscrow(tx *gorm.DB, transfer *models.Transfer) error {
+	if err := settleEscrow(tx, transfer, "completed", ""); err != nil {
+		return err
+	}
+
+	_, err := applyPoints(tx, pointEntry{
+		UserID:     transfer.ToUserID,
+		PointType:  transfer.PointType,
+		Change:     transfer.Amount,
+		EventType:  "escrow_release",
+		TransferID: &transfer.ID,
+		Reference:  transfer.IdempotencyKey,
+	})
+	if err != nil {
+		return err
+	}
+
+	return onTransferCompleted(tx, transfer)
+}
+
+// refundEscrow returns the held points to the sender and marks the transfer reversed
+func refundEscrow(tx *gorm.DB, transfer *models.Transfer, reason string) error {
+	if err := settleEscrow(tx, transfer, "reversed", reason); err != nil {
+		return err
+	}
+
+	metadata := ledgerMetadata(map[string]interface{}{
+		"reason": reason,
+	})
+
+	if _, err := applyPoints(tx, pointEntry{
+		UserID:     transfer.FromUserID,
+		PointType:  transfer.PointType,
+		Change:     transfer.Amount,
+		EventType:  "escrow_refund",
+		TransferID: &transfer.ID,
+		Reference:  transfer.IdempotencyKey,
+		Metadata:   metadata,
+	}); err != nil {
+		return err
+	}
+
+	_, err := applyPoints(tx, pointEntry{
+		UserID:     transfer.ToUserID,
+		PointType:  transfer.PointType,
+		Change:     0,
+		EventType:  "escrow_refund",
+		TransferID: &transfer.ID,
+		Reference:  transfer.IdempotencyKey,
+		Metadata:   metadata,
+	})
+	return err
+}
+
+// ReleaseTransfer releases a held escrow transfer to the receiver
+func ReleaseTransfer(c *fiber.Ctx) error {
+	idempotencyKey := c.Params("id")
+	var transfer models.Transfer
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("idempotency_key = ?", idempotencyKey).First(&transfer).Error; err != nil {
+			return newRequestError(404, "Transfer not found")
+		}
+
+		if !transfer.IsEscrow {
+			return newRequestError(400, "Transfer is not an escrow transfer")
+		}
+		if transfer.EscrowExpiresAt != nil && transfer.EscrowExpiresAt.Before(time.Now()) {
+			return newRequestError(400, "Escrow has expired")
+		}
+
+		var active int64
+		if err := tx.Model(&models.Dispute{}).
+			Where("transfer_id = ? AND status IN ?", transfer.ID, activeDisputeStatuses).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			return newRequestError(400, "Transfer has an open dispute")
+		}
+
+		return releaseEscrow(tx, &transfer)
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to release transfer")
+	}
+
+	database.DB.Preload("FromUser").Preload("ToUser").First(&transfer, transfer.ID)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    transfer,
+		"message": "Transfer released successfully",
+	})
+}
+
+// RefundExpiredEscrows refunds every held escrow transfer past its expiry.
+// Transfers with an open dispute are left for the dispute to settle. It is
+// run periodically from main.
+func RefundExpiredEscrows() {
+	var transfers []models.Transfer
+	activeDisputes := database.DB.Model(&models.Dispute{}).
+		Select("transfer_id").
+		Where("status IN ?", activeDisputeStatuses)
+
+	if err := database.DB.
+		Where("is_escrow = ? AND status = ? AND escrow_expires_at < ?", true, "processing", time.Now()).
+		Where("id NOT IN (?)", activeDisputes).
+		Find(&transfers).Error; err != nil {
+		log.Printf("Failed to fetch expired escrow transfers: %v", err)
+		return
+	}
+
+	for i := range transfers {
+		transfer := transfers[i]
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			return refundEscrow(tx, &transfer, "Escrow timed out")
+		})
+		if err != nil {
+			log.Printf("Failed to refund escrow transfer %s: %v", transfer.IdempotencyKey, err)
+		}
+	}
+}
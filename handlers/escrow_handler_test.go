@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"temp_kbtg_backend/models"
+	"testing"
+	"time"
+)
+
+func TestEscrowTransfer(t *testing.T) {
+	tests := []struct {
+		name         string
+		expired      bool
+		disputed     bool
+		action       string // release, cancel or timeout
+		wantStatus   int    // Of the request; 0 for timeout
+		wantTransfer string
+		wantSender   int
+		wantReceiver int
+	}{
+		{name: "release", action: "release", wantStatus: 200, wantTransfer: "completed", wantSender: 70, wantReceiver: 30},
+		{name: "release after expiry", expired: true, action: "release", wantStatus: 400, wantTransfer: "processing", wantSender: 70},
+		{name: "release while disputed", disputed: true, action: "release", wantStatus: 400, wantTransfer: "processing", wantSender: 70},
+		{name: "cancel", action: "cancel", wantStatus: 400, wantTransfer: "processing", wantSender: 70},
+		{name: "timeout refunds the sender", expired: true, action: "timeout", wantTransfer: "reversed", wantSender: 100},
+		{name: "timeout waits for expiry", action: "timeout", wantTransfer: "processing", wantSender: 70},
+		{name: "timeout leaves disputes to settle", expired: true, disputed: true, action: "timeout", wantTransfer: "processing", wantSender: 70},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t)
+			createRecords(t, db,
+				&models.User{Name: "A", Email: "a@example.com", ReferralCode: "A", Balance: 100},
+				&models.User{Name: "B", Email: "b@example.com", ReferralCode: "B"})
+
+			status, body := sendRequest(t, CreateTransfer, "POST", "/transfers", "/transfers",
+				`{"from_user_id": 1, "to_user_id": 2, "amount": 30, "idempotency_key": "escrow-1", "escrow": true}`)
+			if status != 201 {
+				t.Fatalf("CreateTransfer returned %d: %v", status, body)
+			}
+			var transfer models.Transfer
+			if err := db.Where("idempotency_key = ?", "escrow-1").First(&transfer).Error; err != nil {
+				t.Fatal(err)
+			}
+			if tt.expired {
+				if err := db.Model(&transfer).Update("escrow_expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.disputed {
+				createRecords(t, db, &models.Dispute{TransferID: transfer.ID, OpenedByUserID: 1, Reason: "mistaken", Status: "open"})
+			}
+
+			switch tt.action {
+			case "release":
+				status, body = sendRequest(t, ReleaseTransfer, "POST", "/transfers/:id/release", "/transfers/escrow-1/release", "")
+			case "cancel":
+				status, body = sendRequest(t, CancelTransfer, "POST", "/transfers/:id/cancel", "/transfers/escrow-1/cancel", "")
+			case "timeout":
+				status = 0
+				RefundExpiredEscrows()
+			}
+			if status != tt.wantStatus {
+				t.Fatalf("%s returned %d, want %d: %v", tt.action, status, tt.wantStatus, body)
+			}
+
+			if err := db.First(&transfer, transfer.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if transfer.Status != tt.wantTransfer {
+				t.Errorf("transfer status = %s, want %s", transfer.Status, tt.wantTransfer)
+			}
+			for id, want := range map[uint]int{1: tt.wantSender, 2: tt.wantReceiver} {
+				var user models.User
+				if err := db.First(&user, id).Error; err != nil {
+					t.Fatal(err)
+				}
+				if user.Balance != want {
+					t.Errorf("user %d balance = %d, want %d", id, user.Balance, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens an empty database with the tables of the given models
+func newTestDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// useTestDB points database.DB at an empty database with every table and
+// the default point type, worth 1.00 a point, for the rest of the test
+func useTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := newTestDB(t, database.MigratedModels...)
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
+
+	createRecords(t, db, &models.PointType{Code: models.DefaultPointType, Name: "Points", RedeemValue: 1})
+	return db
+}
+
+// createRecords inserts records in order, failing the test on any error
+func createRecords(t *testing.T, db *gorm.DB, records ...interface{}) {
+	t.Helper()
+	for _, record := range records {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// sendRequest sends a JSON request for path to handler, routed at route,
+// and returns the response status and decoded body
+func sendRequest(t *testing.T, handler fiber.Handler, method, route, path, body string) (int, map[string]interface{}) {
+	t.Helper()
+	app := fiber.New()
+	app.Add(method, route, handler)
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("%s %s returned %d: %s", method, path, resp.StatusCode, data)
+	}
+	return resp.StatusCode, decoded
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"fmt"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Document number prefixes; the year of issue and a six digit sequence
+// number follow, e.g. INV-2025-000001
+const (
+	invoicePrefix    = "INV"
+	creditNotePrefix = "CN"
+)
+
+// invoiceDocument is an invoice as it is rendered: the invoice itself and,
+// on invoices, a receipt of what has been paid towards the order so far
+type invoiceDocument struct {
+	*models.Invoice
+	Payments   []models.OrderPayment `json:"payments,omitempty"`
+	Paid       models.Money          `json:"paid"`
+	BalanceDue models.Money          `json:"balance_due"`
+}
+
+// GetOrderInvoice renders the invoice of a confirmed order as JSON, HTML or
+// plain text, chosen with ?format=json|html|text
+func GetOrderInvoice(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var invoice models.Invoice
+
+	if err := database.DB.Where("order_id = ? AND type = ?", id, "invoice").First(&invoice).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Invoice not found; orders are invoiced when they are confirmed",
+		})
+	}
+
+	return renderInvoice(c, &invoice)
+}
+
+// GetOrderCreditNotes returns the credit notes issued against an order
+func GetOrderCreditNotes(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var creditNotes []models.Invoice
+
+	if err := database.DB.Preload("Lines").Preload("Discounts").
+		Where("order_id = ? AND type = ?", id, "credit_note").
+		Order("id ASC").Find(&creditNotes).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch credit notes",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    creditNotes,
+	})
+}
+
+// GetInvoice renders an invoice or credit note by its number, in the same
+// formats as GetOrderInvoice
+func GetInvoice(c *fiber.Ctx) error {
+	number := c.Params("number")
+	var invoice models.Invoice
+
+	if err := database.DB.Where("number = ?", number).First(&invoice).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Invoice not found",
+		})
+	}
+
+	return renderInvoice(c, &invoice)
+}
+
+// renderInvoice writes invoice in the format asked for by ?format
+func renderInvoice(c *fiber.Ctx, invoice *models.Invoice) error {
+	format := c.Query("format", "json")
+	if format != "json" && format != "html" && format != "text" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "format must be json, html or text",
+		})
+	}
+
+	doc, err := loadInvoiceDocument(database.DB, invoice)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to load invoice",
+		})
+	}
+
+	switch format {
+	case "html":
+		c.Type("html", "utf-8")
+		return invoiceHTML.Execute(c.Response().BodyWriter(), doc)
+	case "text":
+		c.Type("txt", "utf-8")
+		return invoiceText.Execute(c.Response().BodyWriter(), doc)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    doc,
+	})
+}
+
+// loadInvoiceDocument loads the lines and discounts of invoice and, for
+// invoices, the payments made towards its order
+func loadInvoiceDocument(tx *gorm.DB, invoice *models.Invoice) (*invoiceDocument, error) {
+	if err := tx.Where("invoice_id = ?", invoice.ID).Order("id ASC").Find(&invoice.Lines).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("invoice_id = ?", invoice.ID).Order("id ASC").Find(&invoice.Discounts).Error; err != nil {
+		return nil, err
+	}
+
+	doc := &invoiceDocument{Invoice: invoice}
+	if invoice.Type != "invoice" {
+		return doc, nil
+	}
+
+	if err := tx.Where("order_id = ?", invoice.OrderID).Order("id ASC").Find(&doc.Payments).Error; err != nil {
+		return nil, err
+	}
+	for _, payment := range doc.Payments {
+		if payment.Status == "applied" {
+			doc.Paid += payment.Amount
+		}
+	}
+	if doc.Paid < invoice.Total {
+		doc.BalanceDue = invoice.Total - doc.Paid
+	}
+	return doc, nil
+}
+
+// issueInvoice invoices a confirmed order. The invoice copies the order's
+// line items, discounts, tax, customer and shipping address as they are now.
+func issueInvoice(tx *gorm.DB, order *models.Order) error {
+	var existing int64
+	if err := tx.Model(&models.Invoice{}).
+		Where("order_id = ? AND type = ?", order.ID, "invoice").
+		Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+
+	var customer models.Customer
+	if err := tx.First(&customer, order.CustomerID).Error; err != nil {
+		return err
+	}
+	var items []models.LineItem
+	if err := tx.Where("order_id = ?", order.ID).Order("id ASC").Find(&items).Error; err != nil {
+		return err
+	}
+	var discounts []models.OrderDiscount
+	if err := tx.Where("order_id = ?", order.ID).Order("id ASC").Find(&discounts).Error; err != nil {
+		return err
+	}
+
+	invoice := models.Invoice{
+		Type:             "invoice",
+		OrderID:          order.ID,
+		CustomerID:       customer.ID,
+		CustomerName:     customer.Name,
+		CustomerEmail:    customer.Email,
+		CustomerPhone:    customer.Phone,
+		Address:          order.ShippingAddress,
+		Currency:         order.Currency,
+		Subtotal:         order.Subtotal,
+		DiscountTotal:    order.DiscountTotal,
+		NetTotal:         order.NetTotal,
+		TaxTotal:         order.TaxTotal,
+		Total:            order.TotalPrice,
+		TaxCountry:       order.TaxCountry,
+		TaxRate:          order.TaxRate,
+		PricesIncludeTax: order.PricesIncludeTax,
+	}
+	for _, item := range items {
+		itemID := item.ID
+		invoice.Lines = append(invoice.Lines, models.InvoiceLine{
+			LineItemID:  &itemID,
+			SKU:         item.SKU,
+			Description: item.ProductName,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			Total:       item.TotalPrice,
+			Discount:    item.Discount,
+			Net:         item.Net,
+			Tax:         item.Tax,
+		})
+	}
+	// Orders without line items are invoiced as a single line
+	if len(items) == 0 {
+		invoice.Lines = []models.InvoiceLine{{
+			Description: fmt.Sprintf("Order #%d", order.ID),
+			Quantity:    1,
+			UnitPrice:   order.Subtotal,
+			Total:       order.Subtotal,
+			Net:         order.NetTotal,
+			Tax:         order.TaxTotal,
+		}}
+	}
+	for _, d := range discounts {
+		invoice.Discounts = append(invoice.Discounts, models.InvoiceDiscount{
+			Code:        d.Code,
+			Description: d.Description,
+			Amount:      d.Amount,
+		})
+	}
+
+	return createInvoice(tx, &invoice, invoicePrefix)
+}
+
+// creditOrderInvoice reverses the order's invoice with a credit note for its
+// full amount. Orders that were never invoiced have nothing to credit.
+func creditOrderInvoice(tx *gorm.DB, order *models.Order, reason string) error {
+	var invoice models.Invoice
+	err := tx.Preload("Lines").Preload("Discounts").
+		Where("order_id = ? AND type = ?", order.ID, "invoice").First(&invoice).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = issueCreditNote(tx, &invoice, invoice.Lines, invoice.Discounts, reason)
+	return err
+}
+
+// issueCreditNote credits lines of invoice, in full or in part. Each line
+// carries the amounts being credited; the credit note totals are their sum.
+// The credit notes of an invoice can never add up to more than the invoice.
+func issueCreditNote(tx *gorm.DB, invoice *models.Invoice, lines []models.InvoiceLine, discounts []models.InvoiceDiscount, reason string) (*models.Invoice, error) {
+	creditNote := models.Invoice{
+		Type:             "credit_note",
+		OrderID:          invoice.OrderID,
+		InvoiceID:        &invoice.ID,
+		Reason:           reason,
+		CustomerID:       invoice.CustomerID,
+		CustomerName:     invoice.CustomerName,
+		CustomerEmail:    invoice.CustomerEmail,
+		CustomerPhone:    invoice.CustomerPhone,
+		Address:          invoice.Address,
+		Currency:         invoice.Currency,
+		TaxCountry:       invoice.TaxCountry,
+		TaxRate:          invoice.TaxRate,
+		PricesIncludeTax: invoice.PricesIncludeTax,
+		Lines:            append([]models.InvoiceLine(nil), lines...),
+	}
+	for i := range creditNote.Lines {
+		line := &creditNote.Lines[i]
+		line.ID, line.InvoiceID = 0, 0
+		creditNote.Subtotal += line.Total
+		creditNote.DiscountTotal += line.Discount
+		creditNote.NetTotal += line.Net
+		creditNote.TaxTotal += line.Tax
+	}
+	creditNote.Total = creditNote.NetTotal + creditNote.TaxTotal
+	for _, d := range discounts {
+		d.ID, d.InvoiceID = 0, 0
+		creditNote.Discounts = append(creditNote.Discounts, d)
+	}
+
+	var credited models.Money
+	if err := tx.Model(&models.Invoice{}).
+		Select("COALESCE(SUM(total_minor), 0)").
+		Where("invoice_id = ? AND type = ?", invoice.ID, "credit_note").
+		Scan(&credited).Error; err != nil {
+		return nil, err
+	}
+	if credited+creditNote.Total > invoice.Total {
+		return nil, newRequestError(400, fmt.Sprintf("Credit of %s exceeds the %s left to credit on invoice %s",
+			creditNote.Total, invoice.Total-credited, invoice.Number))
+	}
+
+	if err := createInvoice(tx, &creditNote, creditNotePrefix); err != nil {
+		return nil, err
+	}
+	return &creditNote, nil
+}
+
+// createInvoice numbers invoice in the series of prefix and stores it with
+// its lines and discounts
+func createInvoice(tx *gorm.DB, invoice *models.Invoice, prefix string) error {
+	invoice.IssuedAt = time.Now()
+	number, err := nextDocumentNumber(tx, prefix, invoice.IssuedAt)
+	if err != nil {
+		return err
+	}
+	invoice.Number = number
+	return tx.Create(invoice).Error
+}
+
+// nextDocumentNumber takes the next number of the prefix's series for the
+// year of issuedAt. The sequence row is updated in the caller's transaction,
+// which holds the write lock until it commits, so numbers are handed out in
+// order and a rolled back document leaves no gap.
+func nextDocumentNumber(tx *gorm.DB, prefix string, issuedAt time.Time) (string, error) {
+	series := fmt.Sprintf("%s-%d", prefix, issuedAt.Year())
+
+	sequence := models.DocumentSequence{Series: series}
+	if err := tx.FirstOrCreate(&sequence, models.DocumentSequence{Series: series}).Error; err != nil {
+		return "", err
+	}
+	if err := tx.Model(&sequence).
+		Update("last_number", gorm.Expr("last_number + 1")).Error; err != nil {
+		return "", err
+	}
+	if err := tx.First(&sequence, "series = ?", series).Error; err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s-%06d", series, sequence.LastNumber), nil
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"temp_kbtg_backend/models"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestNextDocumentNumber(t *testing.T) {
+	db := newTestDB(t, &models.DocumentSequence{})
+	in2025 := time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC)
+	in2026 := time.Date(2026, 1, 1, 1, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		prefix   string
+		issuedAt time.Time
+		want     string
+	}{
+		{"INV", in2025, "INV-2025-000001"},
+		{"INV", in2025, "INV-2025-000002"},
+		{"CN", in2025, "CN-2025-000001"},   // Each prefix has its own series
+		{"INV", in2026, "INV-2026-000001"}, // and restarts every year
+		{"INV", in2025, "INV-2025-000003"},
+	}
+
+	for _, tt := range tests {
+		got, err := nextDocumentNumber(db, tt.prefix, tt.issuedAt)
+		if err != nil {
+			t.Fatalf("nextDocumentNumber(%s, %d) error = %v", tt.prefix, tt.issuedAt.Year(), err)
+		}
+		if got != tt.want {
+			t.Errorf("nextDocumentNumber(%s, %d) = %s, want %s", tt.prefix, tt.issuedAt.Year(), got, tt.want)
+		}
+	}
+
+	// A rolled back document gives its number back
+	errRollback := errors.New("rollback")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := nextDocumentNumber(tx, "INV", in2025); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if err != errRollback {
+		t.Fatalf("transaction error = %v", err)
+	}
+	got, err := nextDocumentNumber(db, "INV", in2025)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "INV-2025-000004" {
+		t.Errorf("number after rollback = %s, want INV-2025-000004", got)
+	}
+}
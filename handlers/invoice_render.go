@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// invoiceHTML renders an invoiceDocument as a printable HTML page
+var invoiceHTML = htmltemplate.Must(htmltemplate.New("invoice.html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{if eq .Type "invoice"}}Invoice{{else}}Credit Note{{end}} {{.Number}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { padding: 4px 8px; border-bottom: 1px solid #ddd; text-align: left; }
+td.amount, th.amount { text-align: right; }
+</style>
+</head>
+<body>
+<h1>{{if eq .Type "invoice"}}Invoice{{else}}Credit Note{{end}} {{.Number}}</h1>
+<p>
+Issued: {{.IssuedAt.Format "2006-01-02"}}<br>
+Order: #{{.OrderID}}{{if .Reason}}<br>
+Reason: {{.Reason}}{{end}}
+</p>
+
+<h2>Bill to</h2>
+<p>
+{{.CustomerName}}<br>
+{{if .CustomerEmail}}{{.CustomerEmail}}<br>{{end}}
+{{if .CustomerPhone}}{{.CustomerPhone}}<br>{{end}}
+{{if .Address.Address}}{{.Address.Address}}<br>
+{{.Address.City}} {{.Address.PostalCode}}<br>
+{{.Address.Country}}{{end}}
+</p>
+
+<table>
+<tr><th>SKU</th><th>Description</th><th class="amount">Qty</th><th class="amount">Unit price</th><th class="amount">Amount</th><th class="amount">Discount</th><th class="amount">Net</th><th class="amount">Tax</th></tr>
+{{range .Lines}}<tr><td>{{.SKU}}</td><td>{{.Description}}</td><td class="amount">{{.Quantity}}</td><td class="amount">{{.UnitPrice}}</td><td class="amount">{{.Total}}</td><td class="amount">{{.Discount}}</td><td class="amount">{{.Net}}</td><td class="amount">{{.Tax}}</td></tr>
+{{end}}</table>
+{{if .Discounts}}
+<h2>Discounts</h2>
+<table>
+{{range .Discounts}}<tr><td>{{.Code}}</td><td>{{.Description}}</td><td class="amount">-{{.Amount}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Totals ({{.Currency}})</h2>
+<table>
+<tr><td>Subtotal</td><td class="amount">{{.Subtotal}}</td></tr>
+<tr><td>Discounts</td><td class="amount">-{{.DiscountTotal}}</td></tr>
+<tr><td>Net</td><td class="amount">{{.NetTotal}}</td></tr>
+<tr><td>Tax{{if .TaxCountry}} {{.TaxCountry}} {{.TaxRate}}%{{if .PricesIncludeTax}} (included in prices){{end}}{{end}}</td><td class="amount">{{.TaxTotal}}</td></tr>
+<tr><th>{{if eq .Type "invoice"}}Total{{else}}Total credited{{end}}</th><th class="amount">{{.Total}}</th></tr>
+</table>
+{{if eq .Type "invoice"}}
+<h2>Receipt</h2>
+<table>
+{{range .Payments}}<tr><td>{{.CreatedAt.Format "2006-01-02"}}</td><td>{{.Method}}</td><td>{{.Status}}</td><td class="amount">{{.Amount}}</td></tr>
+{{end}}<tr><td colspan="3">Paid</td><td class="amount">{{.Paid}}</td></tr>
+<tr><th colspan="3">Balance due</th><th class="amount">{{.BalanceDue}}</th></tr>
+</table>
+{{end}}
+</body>
+</html>
+`))
+
+// invoiceText renders an invoiceDocument as plain text
+var invoiceText = texttemplate.Must(texttemplate.New("invoice.txt").Parse(
+	`{{if eq .Type "invoice"}}INVOICE{{else}}CREDIT NOTE{{end}} {{.Number}}
+Issued: {{.IssuedAt.Format "2006-01-02"}}
+Order:  #{{.OrderID}}
+{{- if .Reason}}
+Reason: {{.Reason}}{{end}}
+
+Bill to:
+  {{.CustomerName}}
+{{- if .CustomerEmail}}
+  {{.CustomerEmail}}{{end}}
+{{- if .CustomerPhone}}
+  {{.CustomerPhone}}{{end}}
+{{- if .Address.Address}}
+  {{.Address.Address}}
+  {{.Address.City}} {{.Address.PostalCode}}
+  {{.Address.Country}}{{end}}
+
+{{printf "%-30s %5s %12s %12s %12s %12s" "Item" "Qty" "Unit price" "Discount" "Net" "Tax"}}
+{{range .Lines}}{{printf "%-30.30s %5d %12s %12s %12s %12s" .Description .Quantity .UnitPrice .Discount .Net .Tax}}
+{{end}}
+{{- if .Discounts}}
+Discounts:
+{{range .Discounts}}  {{printf "%-20s %-40.40s %12s" .Code .Description .Amount}}
+{{end}}
+{{- end}}
+{{printf "%-20s %12s" "Subtotal" .Subtotal}}
+{{printf "%-20s %12s" "Discounts" .DiscountTotal}}
+{{printf "%-20s %12s" "Net" .NetTotal}}
+{{printf "%-20s %12s" "Tax" .TaxTotal}}{{if .TaxCountry}} ({{.TaxCountry}} {{.TaxRate}}%{{if .PricesIncludeTax}}, included in prices{{end}}){{end}}
+{{printf "%-20s %12s" (print "Total " .Currency) .Total}}
+{{- if eq .Type "invoice"}}
+
+RECEIPT
+{{range .Payments}}{{printf "  %-10s %-10s %-10s %12s" (.CreatedAt.Format "2006-01-02") .Method .Status .Amount}}
+{{end}}{{printf "%-20s %12s" "Paid" .Paid}}
+{{printf "%-20s %12s" "Balance due" .BalanceDue}}
+{{- end}}
+`))
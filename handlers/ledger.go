@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"temp_kbtg_backend/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// pointEntry describes a single balance movement for applyPoints
+type pointEntry struct {
+	UserID     uint
+	PointType  string // Defaults to models.DefaultPointType
+	Change     int
+	EventType  string
+	TransferID *uint
+	OrderID    *uint
+	Reference  string
+	Metadata   string
+
+	// AllowNegative lets a debit take the wallet below zero, e.g. when
+	// clawing back points that were already spent
+	AllowNegative bool
+}
+
+// applyPoints adjusts the balance of the user's wallet for entry.PointType
+// and records the movement in the point ledger. The balance is updated with a
+// single conditional UPDATE so concurrent debits can never overdraw the
+// wallet. Movements on the default wallet are mirrored into User.Balance.
+func applyPoints(tx *gorm.DB, entry pointEntry) (*models.PointLedger, error) {
+	if entry.PointType == "" {
+		entry.PointType = models.DefaultPointType
+	}
+
+	wallet, err := ensureWallet(tx, entry.UserID, entry.PointType)
+	if err != nil {
+		return nil, err
+	}
+
+	query := tx.Model(&models.Wallet{}).Where("id = ?", wallet.ID)
+	if !entry.AllowNegative {
+		query = query.Where("balance + ? >= 0", entry.Change)
+	}
+	result := query.Updates(map[string]interface{}{
+		"balance":    gorm.Expr("balance + ?", entry.Change),
+		"updated_at": time.Now(),
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, newRequestError(400, "Insufficient balance")
+	}
+
+	if err := tx.First(wallet, wallet.ID).Error; err != nil {
+		return nil, err
+	}
+
+	if entry.PointType == models.DefaultPointType {
+		if err := tx.Model(&models.User{}).
+			Where("id = ?", entry.UserID).
+			Update("balance", wallet.Balance).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	ledger := models.PointLedger{
+		UserID:       entry.UserID,
+		Change:       entry.Change,
+		BalanceAfter: wallet.Balance,
+		PointType:    entry.PointType,
+		WalletID:     &wallet.ID,
+		EventType:    entry.EventType,
+		TransferID:   entry.TransferID,
+		OrderID:      entry.OrderID,
+		Reference:    entry.Reference,
+		Metadata:     entry.Metadata,
+		CreatedAt:    time.Now(),
+	}
+	if err := tx.Create(&ledger).Error; err != nil {
+		return nil, err
+	}
+
+	return &ledger, nil
+}
+
+// ensureWallet returns the user's wallet for pointType, creating it on first
+// use. A new default wallet starts from the user's existing balance.
+func ensureWallet(tx *gorm.DB, userID uint, pointType string) (*models.Wallet, error) {
+	var wallet models.Wallet
+	err := tx.Where("user_id = ? AND point_type = ?", userID, pointType).First(&wallet).Error
+	if err == nil {
+		return &wallet, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	var user models.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		return nil, newRequestError(404, "User not found")
+	}
+	if err := findPointType(tx, pointType); err != nil {
+		return nil, err
+	}
+
+	wallet = models.Wallet{
+		UserID:    userID,
+		PointType: pointType,
+	}
+	if pointType == models.DefaultPointType {
+		wallet.Balance = user.Balance
+	}
+	if err := tx.Create(&wallet).Error; err != nil {
+		return nil, err
+	}
+
+	return &wallet, nil
+}
+
+// findPointType checks that code names a configured point type
+func findPointType(tx *gorm.DB, code string) error {
+	var pointType models.PointType
+	if err := tx.Where("code = ?", code).First(&pointType).Error; err != nil {
+		return newRequestError(400, fmt.Sprintf("Unknown point type: %s", code))
+	}
+	return nil
+}
+
+// ledgerMetadata encodes values as the JSON text stored in PointLedger.Metadata
+func ledgerMetadata(values map[string]interface{}) string {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
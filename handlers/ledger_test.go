@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"temp_kbtg_backend/models"
+	"testing"
+)
+
+func TestApplyPoints(t *testing.T) {
+	tests := []struct {
+		name        string
+		entry       pointEntry
+		wantBalance int // Of the wallet after the entry
+		wantStatus  int // Status of the request error; 0 = success
+	}{
+		{
+			name:        "credit",
+			entry:       pointEntry{Change: 50, EventType: "earn"},
+			wantBalance: 150,
+		},
+		{
+			name:        "debit",
+			entry:       pointEntry{Change: -100, EventType: "redeem"},
+			wantBalance: 0,
+		},
+		{
+			name:       "overdraw",
+			entry:      pointEntry{Change: -101, EventType: "redeem"},
+			wantStatus: 400,
+		},
+		{
+			name:        "overdraw allowed for clawbacks",
+			entry:       pointEntry{Change: -150, EventType: "earn_reversal", AllowNegative: true},
+			wantBalance: -50,
+		},
+		{
+			name:        "other point type starts empty",
+			entry:       pointEntry{PointType: "miles", Change: 30, EventType: "earn"},
+			wantBalance: 30,
+		},
+		{
+			name:       "unknown point type",
+			entry:      pointEntry{PointType: "stars", Change: 30, EventType: "earn"},
+			wantStatus: 400,
+		},
+		{
+			name:       "unknown user",
+			entry:      pointEntry{UserID: 99, Change: 30, EventType: "earn"},
+			wantStatus: 404,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, &models.User{}, &models.PointType{}, &models.Wallet{}, &models.PointLedger{})
+			user := models.User{Name: "A", Email: "a@example.com", Balance: 100}
+			for _, record := range []interface{}{
+				&models.PointType{Code: models.DefaultPointType, Name: "Points"},
+				&models.PointType{Code: "miles", Name: "Miles"},
+				&user,
+			} {
+				if err := db.Create(record).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			entry := tt.entry
+			if entry.UserID == 0 {
+				entry.UserID = user.ID
+			}
+			ledger, err := applyPoints(db, entry)
+
+			if tt.wantStatus != 0 {
+				var reqErr *requestError
+				if !errors.As(err, &reqErr) || reqErr.Status != tt.wantStatus {
+					t.Fatalf("applyPoints() error = %v, want status %d", err, tt.wantStatus)
+				}
+				var entries int64
+				db.Model(&models.PointLedger{}).Count(&entries)
+				if entries != 0 {
+					t.Errorf("failed entry recorded %d ledger entries", entries)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyPoints() error = %v", err)
+			}
+
+			if ledger.Change != entry.Change || ledger.BalanceAfter != tt.wantBalance || ledger.EventType != entry.EventType {
+				t.Errorf("ledger = change %d, balance %d, event %s; want %d, %d, %s",
+					ledger.Change, ledger.BalanceAfter, ledger.EventType, entry.Change, tt.wantBalance, entry.EventType)
+			}
+
+			var wallet models.Wallet
+			if err := db.First(&wallet, *ledger.WalletID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if wallet.Balance != tt.wantBalance {
+				t.Errorf("wallet balance = %d, want %d", wallet.Balance, tt.wantBalance)
+			}
+
+			// Only the default wallet is mirrored into the user's balance
+			wantUserBalance := 100
+			if wallet.PointType == models.DefaultPointType {
+				wantUserBalance = tt.wantBalance
+			}
+			if err := db.First(&user, user.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if user.Balance != wantUserBalance {
+				t.Errorf("user balance = %d, want %d", user.Balance, wantUserBalance)
+			}
+		})
+	}
+}
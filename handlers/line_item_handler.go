@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"fmt"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// LineItemRequest represents the request body for changing a line item.
+// Omitted fields keep their current value.
+type LineItemRequest struct {
+	ProductID *uint  `json:"product_id"`
+	SKU       string `json:"sku"`
+	Quantity  int    `json:"quantity"`
+}
+
+// GetOrderItems returns the line items of an order
+func GetOrderItems(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var order models.Order
+
+	if err := database.DB.Preload("Items").First(&order, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Order not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    order.Items,
+	})
+}
+
+// CreateOrderItem adds a line item to an order and recalculates its total
+func CreateOrderItem(c *fiber.Ctx) error {
+	id := c.Params("id")
+	item := new(models.LineItem)
+
+	if err := c.BodyParser(item); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		order, err := findEditableOrder(tx, id)
+		if err != nil {
+			return err
+		}
+
+		item.ID = 0
+		item.OrderID = order.ID
+		if err := prepareLineItem(tx, order, item); err != nil {
+			return err
+		}
+		if err := tx.Create(item).Error; err != nil {
+			return err
+		}
+
+		return recalculateOrderTotal(tx, order)
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to create line item")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    item,
+	})
+}
+
+// UpdateOrderItem changes a line item's quantity or product and
+// recalculates the order total. The item keeps the price it was added at
+// unless it is switched to another product.
+func UpdateOrderItem(c *fiber.Ctx) error {
+	id := c.Params("id")
+	itemID := c.Params("itemId")
+	req := new(LineItemRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	var item models.LineItem
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		order, err := findEditableOrder(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("id = ? AND order_id = ?", itemID, order.ID).First(&item).Error; err != nil {
+			return newRequestError(404, "Line item not found")
+		}
+
+		// Give back the item's current stock, then take what it needs now
+		if item.ProductID != nil {
+			if err := releaseStock(tx, *item.ProductID, item.Quantity); err != nil {
+				return err
+			}
+		}
+		if req.Quantity != 0 {
+			item.Quantity = req.Quantity
+		}
+
+		if req.ProductID != nil || req.SKU != "" {
+			product, err := findOrderableProduct(tx, order, req.ProductID, req.SKU)
+			if err != nil {
+				return err
+			}
+			if item.ProductID == nil || *item.ProductID != product.ID {
+				snapshotProduct(&item, product)
+			}
+		}
+
+		if err := reserveLineItem(tx, &item); err != nil {
+			return err
+		}
+		if err := tx.Save(&item).Error; err != nil {
+			return err
+		}
+
+		return recalculateOrderTotal(tx, order)
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to update line item")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    item,
+	})
+}
+
+// DeleteOrderItem removes a line item and recalculates the order total
+func DeleteOrderItem(c *fiber.Ctx) error {
+	id := c.Params("id")
+	itemID := c.Params("itemId")
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		order, err := findEditableOrder(tx, id)
+		if err != nil {
+			return err
+		}
+
+		var item models.LineItem
+		if err := tx.Where("id = ? AND order_id = ?", itemID, order.ID).First(&item).Error; err != nil {
+			return newRequestError(404, "Line item not found")
+		}
+		if item.ProductID != nil {
+			if err := releaseStock(tx, *item.ProductID, item.Quantity); err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&item).Error; err != nil {
+			return err
+		}
+
+		return recalculateOrderTotal(tx, order)
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to delete line item")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Line item deleted successfully",
+	})
+}
+
+// editableOrderStatuses are the order statuses whose items, coupons and
+// delivery address may still change. Confirming an order invoices it, which
+// fixes what was sold and for how much.
+var editableOrderStatuses = map[string]bool{
+	"pending": true,
+}
+
+// findEditableOrder loads an order whose items may still change
+func findEditableOrder(tx *gorm.DB, id string) (*models.Order, error) {
+	var order models.Order
+	if err := tx.First(&order, id).Error; err != nil {
+		return nil, newRequestError(404, "Order not found")
+	}
+	if !editableOrderStatuses[order.Status] {
+		return nil, newRequestError(400, fmt.Sprintf("Cannot change items of order with status: %s", order.Status))
+	}
+	return &order, nil
+}
+
+// prepareLineItem fills a new line item from the product it refers to and
+// reserves its stock. Client-supplied names, prices and shipped quantities
+// are ignored.
+func prepareLineItem(tx *gorm.DB, order *models.Order, item *models.LineItem) error {
+	product, err := findOrderableProduct(tx, order, item.ProductID, item.SKU)
+	if err != nil {
+		return err
+	}
+	snapshotProduct(item, product)
+	item.Shipped = 0
+	return reserveLineItem(tx, item)
+}
+
+// snapshotProduct copies the product's current details and price onto item
+func snapshotProduct(item *models.LineItem, product *models.Product) {
+	item.ProductID = &product.ID
+	item.SKU = product.SKU
+	item.ProductName = product.Name
+	item.Category = product.Category
+	item.UnitPrice = product.Price
+}
+
+// reserveLineItem validates the item's quantity, takes its stock and
+// computes its total. Items without a product take no stock.
+func reserveLineItem(tx *gorm.DB, item *models.LineItem) error {
+	if item.Quantity <= 0 {
+		return newRequestError(400, "quantity must be greater than 0")
+	}
+
+	if item.ProductID != nil {
+		product := models.Product{ID: *item.ProductID, SKU: item.SKU}
+		if err := reserveStock(tx, &product, item.Quantity); err != nil {
+			return err
+		}
+	}
+
+	item.TotalPrice = item.UnitPrice.Mul(item.Quantity)
+	return nil
+}
+
+// recalculateOrderTotal sets the order subtotal to the sum of its line
+// items, recomputes the discounts of its coupons and the tax of the country
+// it ships to, and sets the total to the gross amount. Orders without line
+// items keep the total they were created with, which is taken to include
+// tax. The new total cannot drop below what has already been paid towards
+// the order.
+func recalculateOrderTotal(tx *gorm.DB, order *models.Order) error {
+	var items []models.LineItem
+	if err := tx.Where("order_id = ?", order.ID).Order("id ASC").Find(&items).Error; err != nil {
+		return err
+	}
+
+	rule, err := orderTaxRule(tx, order)
+	if err != nil {
+		return err
+	}
+
+	var subtotal, discount, net, tax models.Money
+	if len(items) == 0 {
+		if err := tx.Where("order_id = ?", order.ID).Delete(&models.OrderDiscount{}).Error; err != nil {
+			return err
+		}
+		subtotal = order.TotalPrice
+		tax = subtotal.TaxIncluded(rule.Rate)
+		net = subtotal - tax
+	} else {
+		for _, item := range items {
+			subtotal += item.TotalPrice
+		}
+
+		discounts, err := applyOrderDiscounts(tx, order, items, subtotal)
+		if err != nil {
+			return err
+		}
+		for _, d := range discounts {
+			discount += d.Amount
+		}
+
+		for _, line := range taxLines(items, discounts, rule) {
+			if err := tx.Model(&models.LineItem{}).Where("id = ?", line.ID).Updates(map[string]interface{}{
+				"discount_minor": line.Discount,
+				"net_minor":      line.Net,
+				"tax_minor":      line.Tax,
+			}).Error; err != nil {
+				return err
+			}
+			net += line.Net
+			tax += line.Tax
+		}
+	}
+	total := net + tax
+
+	paid, err := orderPaid(tx, order)
+	if err != nil {
+		return err
+	}
+	if total < paid {
+		return newRequestError(400, fmt.Sprintf("Order total %s would be less than the %s already paid", total, paid))
+	}
+
+	order.Subtotal, order.DiscountTotal = subtotal, discount
+	order.NetTotal, order.TaxTotal, order.TotalPrice = net, tax, total
+	order.TaxCountry, order.TaxRate, order.PricesIncludeTax = rule.Country, rule.Rate, rule.PricesIncludeTax
+	return tx.Model(order).Updates(map[string]interface{}{
+		"subtotal_minor":       subtotal,
+		"discount_total_minor": discount,
+		"net_total_minor":      net,
+		"tax_total_minor":      tax,
+		"total_price_minor":    total,
+		"tax_country":          rule.Country,
+		"tax_rate":             rule.Rate,
+		"prices_include_tax":   rule.PricesIncludeTax,
+	}).Error
+}
@@ -1,35 +1,180 @@
 package handlers
 
 import (
+	"strings"
 	"temp_kbtg_backend/database"
 	"temp_kbtg_backend/models"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
-// Get all orders
+// orderSortColumns are the fields orders can be sorted by, and the
+// columns that hold them
+var orderSortColumns = map[string]string{
+	"id":          "id",
+	"order_date":  "order_date",
+	"total_price": "total_price_minor",
+	"created_at":  "created_at",
+}
+
+// GetOrders returns a page of orders with optional filtering and sorting
 func GetOrders(c *fiber.Ctx) error {
+	return listOrders(c, nil)
+}
+
+// GetCustomerOrders returns a page of a customer's orders, most recent
+// first unless sorted otherwise. It takes the same filters as GetOrders.
+func GetCustomerOrders(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var customer models.Customer
+
+	if err := database.DB.First(&customer, id).Error; err != nil {
+		return customerNotFound(c, id)
+	}
+
+	return listOrders(c, &customer.ID)
+}
+
+// listOrders sends the page of orders the request's query asks for,
+// limited to customerID when it is set
+func listOrders(c *fiber.Ctx, customerID *uint) error {
+	page, err := parsePagination(c)
+	if err != nil {
+		return sendError(c, err, "Failed to fetch orders")
+	}
+	filters, err := orderFilters(c, customerID)
+	if err != nil {
+		return sendError(c, err, "Failed to fetch orders")
+	}
+	sort, err := orderSort(c.Query("sort", "-order_date"))
+	if err != nil {
+		return sendError(c, err, "Failed to fetch orders")
+	}
+
+	if err := page.count(database.DB.Model(&models.Order{}).Scopes(filters)); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch orders",
+		})
+	}
+
 	var orders []models.Order
-	
-	if err := database.DB.Find(&orders).Error; err != nil {
+	if err := database.DB.Preload("Items").Preload("Discounts").
+		Scopes(filters, page.scope).Order(sort).Find(&orders).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to fetch orders",
 		})
 	}
 
 	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    orders,
+		"success":    true,
+		"data":       orders,
+		"pagination": page,
 	})
 }
 
+// orderFilters builds the conditions of the request's order filters:
+// customer_id, status (comma separated), from and to on the order date,
+// min_total and max_total on the gross total, and product, part of the
+// name of a product on the order
+func orderFilters(c *fiber.Ctx, customerID *uint) (func(*gorm.DB) *gorm.DB, error) {
+	var conditions []func(*gorm.DB) *gorm.DB
+	where := func(query string, args ...interface{}) {
+		conditions = append(conditions, func(db *gorm.DB) *gorm.DB {
+			return db.Where(query, args...)
+		})
+	}
+
+	if customerID != nil {
+		where("customer_id = ?", *customerID)
+	} else if id := c.Query("customer_id"); id != "" {
+		where("customer_id = ?", id)
+	}
+	if status := c.Query("status"); status != "" {
+		where("status IN ?", strings.Split(status, ","))
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, _, err := parseOrderDate(from)
+		if err != nil {
+			return nil, newRequestError(400, "Invalid from date: "+from)
+		}
+		where("order_date >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, dateOnly, err := parseOrderDate(to)
+		if err != nil {
+			return nil, newRequestError(400, "Invalid to date: "+to)
+		}
+		if dateOnly {
+			where("order_date < ?", t.AddDate(0, 0, 1)) // The whole day
+		} else {
+			where("order_date <= ?", t)
+		}
+	}
+
+	if minTotal := c.Query("min_total"); minTotal != "" {
+		amount, err := models.ParseMoney(minTotal)
+		if err != nil {
+			return nil, newRequestError(400, "Invalid min_total: "+minTotal)
+		}
+		where("total_price_minor >= ?", amount)
+	}
+	if maxTotal := c.Query("max_total"); maxTotal != "" {
+		amount, err := models.ParseMoney(maxTotal)
+		if err != nil {
+			return nil, newRequestError(400, "Invalid max_total: "+maxTotal)
+		}
+		where("total_price_minor <= ?", amount)
+	}
+
+	if product := strings.TrimSpace(c.Query("product")); product != "" {
+		where(`id IN (SELECT order_id FROM line_items WHERE product_name LIKE ? ESCAPE '\')`, "%"+escapeLike(product)+"%")
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		for _, condition := range conditions {
+			db = condition(db)
+		}
+		return db
+	}, nil
+}
+
+// orderSort turns a sort parameter such as "-order_date" into an ORDER BY
+// clause. A leading minus sorts descending; ties are broken by id.
+func orderSort(sort string) (string, error) {
+	direction := "ASC"
+	if strings.HasPrefix(sort, "-") {
+		direction = "DESC"
+		sort = sort[1:]
+	}
+	column, ok := orderSortColumns[sort]
+	if !ok {
+		return "", newRequestError(400, "Cannot sort orders by "+sort)
+	}
+	if column == "id" {
+		return "id " + direction, nil
+	}
+	return column + " " + direction + ", id " + direction, nil
+}
+
+// parseOrderDate parses a date filter given as YYYY-MM-DD (UTC) or RFC 3339
+// and reports whether it was a bare date
+func parseOrderDate(s string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	return t.UTC(), false, err
+}
+
 // Get order by ID
 func GetOrder(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var order models.Order
 
-	if err := database.DB.First(&order, id).Error; err != nil {
+	if err := database.DB.Preload("Items").Preload("Payments").Preload("Discounts").First(&order, id).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Order not found",
 		})
@@ -51,17 +196,77 @@ func CreateOrder(c *fiber.Ctx) error {
 		})
 	}
 
-	// Set order date to now if not provided
+	// Orders always start pending and move on through /orders/:id/transitions
+	if order.Status != "" && order.Status != "pending" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "New orders start as pending; use POST /orders/:id/transitions to change the status",
+		})
+	}
+	order.Status = "pending"
+
+	var audit struct {
+		Actor string `json:"actor"`
+	}
+	if err := c.BodyParser(&audit); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if audit.Actor == "" {
+		audit.Actor = defaultOrderActor
+	}
+
+	order.Currency = strings.ToUpper(order.Currency)
+	if order.Currency == "" {
+		order.Currency = models.DefaultCurrency
+	}
+	if !models.SupportedCurrencies[order.Currency] {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Unsupported currency: " + order.Currency,
+		})
+	}
+
+	// Set order date to now if not provided. Dates are stored in UTC so
+	// they compare correctly in the order filters.
 	if order.OrderDate.IsZero() {
 		order.OrderDate = time.Now()
 	}
+	order.OrderDate = order.OrderDate.UTC()
 
-	if err := database.DB.Create(&order).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to create order",
-		})
+	order.Payments = nil
+	order.Discounts = nil
+	order.DiscountTotal = 0
+	order.ShippingAddress = models.AddressSnapshot{}
+	order.RefundedTotal = 0 // Refunds are only recorded by refunding returns
+	order.RefundStatus = ""
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Inline line items are created with the order and take their stock
+		for i := range order.Items {
+			item := &order.Items[i]
+			item.ID = 0
+			if err := prepareLineItem(tx, order, item); err != nil {
+				return err
+			}
+		}
+
+		if err := snapshotOrderAddress(tx, order); err != nil {
+			return err
+		}
+		if err := tx.Omit("Payments", "Discounts").Create(&order).Error; err != nil {
+			return err
+		}
+		if err := recalculateOrderTotal(tx, order); err != nil {
+			return err
+		}
+		return recordOrderStatus(tx, order.ID, "", order.Status, audit.Actor, "")
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to create order")
 	}
 
+	database.DB.Preload("Items").First(order, order.ID)
+
 	return c.Status(201).JSON(fiber.Map{
 		"success": true,
 		"data":    order,
@@ -79,18 +284,82 @@ func UpdateOrder(c *fiber.Ctx) error {
 		})
 	}
 
+	previousStatus := order.Status
+	customerID := order.CustomerID
+	currency := order.Currency
+	shippingAddress := order.ShippingAddress
+	var previousAddressID *uint
+	if order.DeliveryAddressID != nil {
+		// Copy the value, BodyParser writes through the existing pointer
+		addressID := *order.DeliveryAddressID
+		previousAddressID = &addressID
+	}
+
 	if err := c.BodyParser(&order); err != nil {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Invalid request body",
 		})
 	}
 
-	if err := database.DB.Save(&order).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to update order",
+	if order.Status != previousStatus {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Use POST /orders/:id/transitions to change the order status",
+		})
+	}
+
+	if order.CustomerID != customerID && !editableOrderStatuses[previousStatus] {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot change the customer of order with status: " + previousStatus,
+		})
+	}
+
+	// Payments and line items are priced in the order's currency, so it is
+	// fixed once the order exists
+	order.Currency = currency
+	order.OrderDate = order.OrderDate.UTC()
+
+	// The shipping address snapshot only changes when another delivery
+	// address is chosen, and only before the order is confirmed
+	order.ShippingAddress = shippingAddress
+	addressChanged := order.DeliveryAddressID != nil &&
+		(previousAddressID == nil || *order.DeliveryAddressID != *previousAddressID)
+	if !addressChanged {
+		order.DeliveryAddressID = previousAddressID
+	} else if !editableOrderStatuses[previousStatus] {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot change the delivery address of order with status: " + previousStatus,
 		})
 	}
 
+	// Line items are managed through /orders/:id/items. Once the order is
+	// invoiced its amounts and tax are fixed.
+	editable := editableOrderStatuses[previousStatus]
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if addressChanged {
+			if err := snapshotOrderAddress(tx, &order); err != nil {
+				return err
+			}
+		}
+		// Refunds are only recorded by refunding returns
+		omit := []string{"Items", "Payments", "Discounts", "RefundedTotal", "RefundStatus"}
+		if !editable {
+			omit = append(omit, "Subtotal", "DiscountTotal", "NetTotal", "TaxTotal", "TotalPrice",
+				"TaxCountry", "TaxRate", "PricesIncludeTax")
+		}
+		if err := tx.Omit(omit...).Save(&order).Error; err != nil {
+			return err
+		}
+		if !editable {
+			return nil
+		}
+		return recalculateOrderTotal(tx, &order)
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to update order")
+	}
+
+	database.DB.Preload("Items").Preload("Payments").Preload("Discounts").First(&order, order.ID)
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"data":    order,
@@ -108,12 +377,57 @@ func DeleteOrder(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := database.DB.Delete(&order).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to delete order",
+	// Only orders that were never confirmed can be deleted. Anything further
+	// along is cancelled instead, which credits its invoice and refunds
+	// points paid towards it.
+	if order.Status != "pending" {
+		message := "Only pending orders can be deleted"
+		if orderTransitionAllowed(order.Status, "cancelled") {
+			message += "; cancel the order instead"
+		}
+		return c.Status(409).JSON(fiber.Map{
+			"error": message,
 		})
 	}
 
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Points paid towards the order are refunded by cancelling it
+		var payments int64
+		if err := tx.Model(&models.OrderPayment{}).Where("order_id = ?", order.ID).Count(&payments).Error; err != nil {
+			return err
+		}
+		if payments > 0 {
+			return newRequestError(409, "Cannot delete an order paid with points; cancel it instead, which refunds them")
+		}
+
+		if err := releaseOrderStock(tx, &order); err != nil {
+			return err
+		}
+		if err := releaseOrderCoupons(tx, &order); err != nil {
+			return err
+		}
+		for _, model := range []interface{}{
+			&models.OrderDiscount{}, &models.OrderCoupon{}, &models.OrderStatusHistory{}, &models.LineItem{},
+		} {
+			if err := tx.Where("order_id = ?", order.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		// The status is checked again in case the order was confirmed meanwhile
+		result := tx.Where("status = ?", "pending").Delete(&order)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return newRequestError(409, "Order status changed concurrently, please retry")
+		}
+		return nil
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to delete order")
+	}
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Order deleted successfully",
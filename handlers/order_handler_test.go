@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"fmt"
+	"temp_kbtg_backend/models"
+	"testing"
+	"time"
+)
+
+func TestCreateOrderIgnoresRefunds(t *testing.T) {
+	db := useTestDB(t)
+	createRecords(t, db, &models.Customer{Name: "A", Email: "a@example.com"})
+
+	status, body := sendRequest(t, CreateOrder, "POST", "/orders", "/orders",
+		`{"customer_id": 1, "total_price": 100, "refunded_total": 100, "refund_status": "refunded"}`)
+	if status != 201 {
+		t.Fatalf("CreateOrder returned %d: %v", status, body)
+	}
+
+	var order models.Order
+	if err := db.First(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	if order.RefundedTotal != 0 || order.RefundStatus != "" {
+		t.Errorf("new order has refunded_total %s and refund_status %q, want none", order.RefundedTotal, order.RefundStatus)
+	}
+}
+
+func TestUpdateOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     string
+		body       string
+		wantStatus int
+		wantOrder  func(order models.Order) error
+	}{
+		{
+			name:       "refunds cannot be set on a delivered order",
+			status:     "delivered",
+			body:       `{"refunded_total": 1000, "refund_status": "refunded"}`,
+			wantStatus: 200,
+			wantOrder: func(order models.Order) error {
+				if order.RefundedTotal != 2000 || order.RefundStatus != "partially_refunded" {
+					return fmt.Errorf("refunded_total %s, refund_status %q; want 20.00, partially_refunded",
+						order.RefundedTotal, order.RefundStatus)
+				}
+				return nil
+			},
+		},
+		{
+			name:       "refunds cannot be set on a pending order",
+			status:     "pending",
+			body:       `{"refunded_total": 0, "refund_status": ""}`,
+			wantStatus: 200,
+			wantOrder: func(order models.Order) error {
+				if order.RefundedTotal != 2000 || order.RefundStatus != "partially_refunded" {
+					return fmt.Errorf("refunded_total %s, refund_status %q; want 20.00, partially_refunded",
+						order.RefundedTotal, order.RefundStatus)
+				}
+				return nil
+			},
+		},
+		{
+			name:       "customer can change while pending",
+			status:     "pending",
+			body:       `{"customer_id": 2}`,
+			wantStatus: 200,
+			wantOrder: func(order models.Order) error {
+				if order.CustomerID != 2 {
+					return fmt.Errorf("customer_id %d, want 2", order.CustomerID)
+				}
+				return nil
+			},
+		},
+		{
+			name:       "customer is fixed once processing",
+			status:     "processing",
+			body:       `{"customer_id": 2}`,
+			wantStatus: 400,
+			wantOrder: func(order models.Order) error {
+				if order.CustomerID != 1 {
+					return fmt.Errorf("customer_id %d, want 1", order.CustomerID)
+				}
+				return nil
+			},
+		},
+		{
+			name:       "customer is fixed once delivered",
+			status:     "delivered",
+			body:       `{"customer_id": 2}`,
+			wantStatus: 400,
+			wantOrder: func(order models.Order) error {
+				if order.CustomerID != 1 {
+					return fmt.Errorf("customer_id %d, want 1", order.CustomerID)
+				}
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t)
+			order := models.Order{
+				CustomerID:    1,
+				OrderDate:     time.Now().UTC(),
+				Status:        tt.status,
+				Currency:      models.DefaultCurrency,
+				TotalPrice:    10000,
+				RefundedTotal: 2000,
+				RefundStatus:  "partially_refunded",
+			}
+			createRecords(t, db,
+				&models.Customer{Name: "A", Email: "a@example.com"},
+				&models.Customer{Name: "B", Email: "b@example.com"},
+				&order)
+
+			status, body := sendRequest(t, UpdateOrder, "PUT", "/orders/:id", fmt.Sprintf("/orders/%d", order.ID), tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("UpdateOrder returned %d, want %d: %v", status, tt.wantStatus, body)
+			}
+
+			var updated models.Order
+			if err := db.First(&updated, order.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.wantOrder(updated); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
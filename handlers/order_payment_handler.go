@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// PayWithPointsRequest represents the request body for paying an order with points
+type PayWithPointsRequest struct {
+	Points    int    `json:"points"`
+	PointType string `json:"point_type"` // Defaults to the default point type
+}
+
+// payableOrderStatuses are the order statuses that still accept payments
+var payableOrderStatuses = map[string]bool{
+	"pending":    true,
+	"processing": true,
+}
+
+// PayOrderWithPoints redeems points from the customer's linked user against
+// an order. The payment may cover all or part of the outstanding amount.
+func PayOrderWithPoints(c *fiber.Ctx) error {
+	id := c.Params("id")
+	req := new(PayWithPointsRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Points <= 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "points must be greater than 0",
+		})
+	}
+	if req.PointType == "" {
+		req.PointType = models.DefaultPointType
+	}
+
+	var order models.Order
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&order, id).Error; err != nil {
+			return newRequestError(404, "Order not found")
+		}
+		if !payableOrderStatuses[order.Status] {
+			return newRequestError(400, fmt.Sprintf("Cannot pay for order with status: %s", order.Status))
+		}
+		// Redeem values are in the default currency
+		if order.Currency != models.DefaultCurrency {
+			return newRequestError(400, fmt.Sprintf("Only orders in %s can be paid with points", models.DefaultCurrency))
+		}
+
+		var customer models.Customer
+		if err := tx.First(&customer, order.CustomerID).Error; err != nil || customer.UserID == nil {
+			return newRequestError(400, "Customer has no linked points account")
+		}
+
+		var pointType models.PointType
+		if err := tx.Where("code = ?", req.PointType).First(&pointType).Error; err != nil {
+			return newRequestError(400, fmt.Sprintf("Unknown point type: %s", req.PointType))
+		}
+		if pointType.RedeemValue <= 0 {
+			return newRequestError(400, fmt.Sprintf("Point type %s cannot be redeemed", pointType.Code))
+		}
+
+		outstanding, err := orderOutstanding(tx, &order)
+		if err != nil {
+			return err
+		}
+
+		amount := models.MoneyFromFloat(float64(req.Points) * pointType.RedeemValue)
+		if amount > outstanding {
+			maxPoints := int(math.Floor(outstanding.Float()/pointType.RedeemValue + 1e-9))
+			return newRequestError(400, fmt.Sprintf("Points exceed the outstanding amount (max %d points)", maxPoints))
+		}
+
+		ledger, err := applyPoints(tx, pointEntry{
+			UserID:    *customer.UserID,
+			PointType: pointType.Code,
+			Change:    -req.Points,
+			EventType: "redeem",
+			OrderID:   &order.ID,
+			Reference: fmt.Sprintf("order-%d", order.ID),
+			Metadata: ledgerMetadata(map[string]interface{}{
+				"rate":   pointType.RedeemValue,
+				"amount": amount,
+			}),
+		})
+		if err != nil {
+			return err
+		}
+
+		payment := models.OrderPayment{
+			OrderID:   order.ID,
+			UserID:    *customer.UserID,
+			Method:    "points",
+			PointType: pointType.Code,
+			Points:    req.Points,
+			Rate:      pointType.RedeemValue,
+			Amount:    amount,
+			Status:    "applied",
+			LedgerID:  &ledger.ID,
+		}
+		return tx.Create(&payment).Error
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to pay with points")
+	}
+
+	database.DB.Preload("Payments").First(&order, order.ID)
+	outstanding, _ := orderOutstanding(database.DB, &order)
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"order":       order,
+			"outstanding": outstanding,
+		},
+	})
+}
+
+// orderOutstanding returns how much of the order is not yet covered by
+// applied payments
+func orderOutstanding(tx *gorm.DB, order *models.Order) (models.Money, error) {
+	paid, err := orderPaid(tx, order)
+	if err != nil {
+		return 0, err
+	}
+	if paid >= order.TotalPrice {
+		return 0, nil
+	}
+	return order.TotalPrice - paid, nil
+}
+
+// orderPaid returns the sum of the applied payments on the order
+func orderPaid(tx *gorm.DB, order *models.Order) (models.Money, error) {
+	var paid models.Money
+	err := tx.Model(&models.OrderPayment{}).
+		Select("COALESCE(SUM(amount_minor), 0)").
+		Where("order_id = ? AND status = ?", order.ID, "applied").
+		Scan(&paid).Error
+	return paid, err
+}
+
+// refundOrderPointPayments returns the points of every applied points payment
+// on the order to the paying user
+func refundOrderPointPayments(tx *gorm.DB, order *models.Order) error {
+	var payments []models.OrderPayment
+	if err := tx.Where("order_id = ? AND method = ? AND status = ?", order.ID, "points", "applied").
+		Find(&payments).Error; err != nil {
+		return err
+	}
+
+	for _, payment := range payments {
+		if _, err := applyPoints(tx, pointEntry{
+			UserID:    payment.UserID,
+			PointType: payment.PointType,
+			Change:    payment.Points,
+			EventType: "redeem_refund",
+			OrderID:   &order.ID,
+			Reference: fmt.Sprintf("order-%d", order.ID),
+			Metadata: ledgerMetadata(map[string]interface{}{
+				"order_payment_id": payment.ID,
+				"reason":           "order cancelled",
+			}),
+		}); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&payment).Updates(map[string]interface{}{
+			"status":      "refunded",
+			"refunded_at": now,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"fmt"
+	"temp_kbtg_backend/models"
+	"testing"
+	"time"
+)
+
+func TestPayOrderWithPoints(t *testing.T) {
+	tests := []struct {
+		name        string
+		currency    string
+		points      int
+		wantStatus  int
+		wantBalance int
+	}{
+		{"partial payment", models.DefaultCurrency, 40, 201, 60},
+		{"more than outstanding", models.DefaultCurrency, 60, 400, 100},
+		{"order in another currency", "USD", 40, 400, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t)
+			userID := uint(1)
+			order := models.Order{CustomerID: 1, OrderDate: time.Now().UTC(), Status: "pending", Currency: tt.currency, TotalPrice: 5000}
+			createRecords(t, db,
+				&models.User{Name: "A", Email: "a@example.com", Balance: 100},
+				&models.Customer{Name: "A", Email: "a@example.com", UserID: &userID},
+				&order)
+
+			status, body := sendRequest(t, PayOrderWithPoints, "POST", "/orders/:id/pay-with-points",
+				fmt.Sprintf("/orders/%d/pay-with-points", order.ID), fmt.Sprintf(`{"points": %d}`, tt.points))
+			if status != tt.wantStatus {
+				t.Fatalf("PayOrderWithPoints returned %d, want %d: %v", status, tt.wantStatus, body)
+			}
+
+			var user models.User
+			if err := db.First(&user, userID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if user.Balance != tt.wantBalance {
+				t.Errorf("user balance = %d, want %d", user.Balance, tt.wantBalance)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// defaultOrderActor is recorded when a status change does not name its actor
+const defaultOrderActor = "system"
+
+// orderTransitions is the order lifecycle: the statuses each status may move to
+var orderTransitions = map[string][]string{
+	"pending":    {"processing", "cancelled"},
+	"processing": {"shipped", "cancelled"},
+	"shipped":    {"delivered"},
+	"delivered":  {},
+	"cancelled":  {},
+}
+
+// OrderTransitionRequest represents the request body for changing an order's status
+type OrderTransitionRequest struct {
+	Status string `json:"status"`
+	Actor  string `json:"actor"`
+	Reason string `json:"reason"`
+}
+
+// TransitionOrder moves an order to a new status along the lifecycle
+func TransitionOrder(c *fiber.Ctx) error {
+	id := c.Params("id")
+	req := new(OrderTransitionRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Status == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "status is required",
+		})
+	}
+
+	var order models.Order
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&order, id).Error; err != nil {
+			return newRequestError(404, "Order not found")
+		}
+		return transitionOrder(tx, &order, req.Status, req.Actor, req.Reason)
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to change order status")
+	}
+
+	database.DB.Preload("Items").Preload("Payments").Preload("Discounts").First(&order, order.ID)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    order,
+	})
+}
+
+// GetOrderTransitions returns an order's status history, oldest first, and
+// the statuses it can move to next
+func GetOrderTransitions(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var order models.Order
+
+	if err := database.DB.First(&order, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Order not found",
+		})
+	}
+
+	var history []models.OrderStatusHistory
+	if err := database.DB.Where("order_id = ?", order.ID).Order("id ASC").Find(&history).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch order history",
+		})
+	}
+
+	next := orderTransitions[order.Status]
+	if next == nil {
+		next = []string{}
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"order_id": order.ID,
+			"status":   order.Status,
+			"allowed":  next,
+			"history":  history,
+		},
+	})
+}
+
+// transitionOrder moves order to status if the lifecycle allows it, records
+// the change and applies its side effects. The status is claimed with a
+// conditional update so concurrent transitions cannot both succeed.
+func transitionOrder(tx *gorm.DB, order *models.Order, status, actor, reason string) error {
+	from := order.Status
+	if !orderTransitionAllowed(from, status) {
+		return newRequestError(400, fmt.Sprintf("Cannot move order from %s to %s; allowed: %s",
+			from, status, allowedOrderTransitions(from)))
+	}
+	if actor == "" {
+		actor = defaultOrderActor
+	}
+
+	now := time.Now()
+	result := tx.Model(&models.Order{}).
+		Where("id = ? AND status = ?", order.ID, from).
+		Updates(map[string]interface{}{
+			"status":     status,
+			"updated_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return newRequestError(409, "Order status changed concurrently, please retry")
+	}
+	order.Status = status
+	order.UpdatedAt = now
+
+	if err := recordOrderStatus(tx, order.ID, from, status, actor, reason); err != nil {
+		return err
+	}
+
+	return onOrderStatusChange(tx, order, from)
+}
+
+// recordOrderStatus appends an entry to the order's status history
+func recordOrderStatus(tx *gorm.DB, orderID uint, from, to, actor, reason string) error {
+	return tx.Create(&models.OrderStatusHistory{
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		Actor:      actor,
+		Reason:     reason,
+	}).Error
+}
+
+// orderTransitionAllowed reports whether the lifecycle allows from -> to
+func orderTransitionAllowed(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedOrderTransitions lists the statuses from can move to, for errors
+func allowedOrderTransitions(from string) string {
+	next := append([]string(nil), orderTransitions[from]...)
+	if len(next) == 0 {
+		return "none"
+	}
+	sort.Strings(next)
+	return strings.Join(next, ", ")
+}
+
+// onOrderStatusChange applies the side effects of an order status change
+func onOrderStatusChange(tx *gorm.DB, order *models.Order, previousStatus string) error {
+	if order.Status == previousStatus {
+		return nil
+	}
+
+	if order.Status == "processing" {
+		return issueInvoice(tx, order)
+	}
+	if earningOrderStatuses[order.Status] {
+		return awardOrderPoints(tx, order)
+	}
+	if order.Status == "cancelled" {
+		var shipments int64
+		if err := tx.Model(&models.Shipment{}).Where("order_id = ?", order.ID).Count(&shipments).Error; err != nil {
+			return err
+		}
+		if shipments > 0 {
+			return newRequestError(400, "Cannot cancel an order that has already partly shipped")
+		}
+		if err := creditOrderInvoice(tx, order, "Order cancelled"); err != nil {
+			return err
+		}
+		if err := releaseOrderStock(tx, order); err != nil {
+			return err
+		}
+		if err := releaseOrderCoupons(tx, order); err != nil {
+			return err
+		}
+		return refundOrderPointPayments(tx, order)
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"fmt"
+	"temp_kbtg_backend/models"
+	"testing"
+	"time"
+)
+
+func TestTransitionOrder(t *testing.T) {
+	tests := []struct {
+		name            string
+		from            string
+		to              string
+		shipped         bool // The order has a shipment
+		wantStatus      int
+		wantOrder       string
+		wantInvoices    int
+		wantCreditNotes int
+		wantStock       int // Of the ordered product, 2 of which are on the order
+		wantBalance     int // Of the customer's user, who paid 10 points towards the order
+	}{
+		{
+			name: "confirming issues the invoice", from: "pending", to: "processing",
+			wantStatus: 200, wantOrder: "processing", wantInvoices: 1, wantStock: 5, wantBalance: 90,
+		},
+		{
+			name: "skipping a step", from: "pending", to: "delivered",
+			wantStatus: 400, wantOrder: "pending", wantStock: 5, wantBalance: 90,
+		},
+		{
+			name: "cancelling credits the invoice, restocks and refunds points", from: "processing", to: "cancelled",
+			wantStatus: 200, wantOrder: "cancelled", wantInvoices: 1, wantCreditNotes: 1, wantStock: 7, wantBalance: 100,
+		},
+		{
+			name: "cancelling after a parcel shipped", from: "processing", to: "cancelled", shipped: true,
+			wantStatus: 400, wantOrder: "processing", wantInvoices: 1, wantStock: 5, wantBalance: 90,
+		},
+		{
+			name: "delivering earns points", from: "shipped", to: "delivered", shipped: true,
+			wantStatus: 200, wantOrder: "delivered", wantInvoices: 1, wantStock: 5, wantBalance: 100,
+		},
+		{
+			name: "delivered orders cannot be cancelled", from: "delivered", to: "cancelled", shipped: true,
+			wantStatus: 400, wantOrder: "delivered", wantInvoices: 1, wantStock: 5, wantBalance: 90,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t)
+			userID := uint(1)
+			productID := uint(1)
+			order := models.Order{CustomerID: 1, OrderDate: time.Now().UTC(), Status: tt.from, Currency: models.DefaultCurrency, TotalPrice: 10000}
+			createRecords(t, db,
+				&models.User{Name: "A", Email: "a@example.com", ReferralCode: "A", Balance: 90},
+				&models.Customer{Name: "A", Email: "a@example.com", UserID: &userID},
+				&models.Product{SKU: "PEN", Name: "Pen", Price: 5000, Stock: 5, Active: true},
+				&models.EarnRule{Name: "Base", Rate: 0.1, Active: true},
+				&order)
+			createRecords(t, db,
+				&models.LineItem{OrderID: order.ID, ProductID: &productID, SKU: "PEN", ProductName: "Pen", Quantity: 2, UnitPrice: 5000, TotalPrice: 10000},
+				&models.OrderPayment{OrderID: order.ID, UserID: userID, Method: "points", PointType: models.DefaultPointType, Points: 10, Rate: 1, Amount: 1000, Status: "applied"})
+			if tt.from != "pending" {
+				if err := issueInvoice(db, &order); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.shipped {
+				createRecords(t, db, &models.Shipment{OrderID: order.ID, Carrier: "kerry", TrackingNumber: "TH1", Status: "delivered",
+					StatusAt: time.Now(), ShippedAt: time.Now()})
+			}
+
+			status, body := sendRequest(t, TransitionOrder, "POST", "/orders/:id/transitions", fmt.Sprintf("/orders/%d/transitions", order.ID),
+				fmt.Sprintf(`{"status": %q, "actor": "support"}`, tt.to))
+			if status != tt.wantStatus {
+				t.Fatalf("TransitionOrder returned %d, want %d: %v", status, tt.wantStatus, body)
+			}
+
+			if err := db.First(&order, order.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if order.Status != tt.wantOrder {
+				t.Errorf("order status = %s, want %s", order.Status, tt.wantOrder)
+			}
+			var history []models.OrderStatusHistory
+			db.Where("order_id = ?", order.ID).Find(&history)
+			if tt.wantStatus != 200 {
+				if len(history) != 0 {
+					t.Errorf("refused change recorded %d history entries", len(history))
+				}
+			} else if len(history) != 1 || history[0].FromStatus != tt.from || history[0].ToStatus != tt.to || history[0].Actor != "support" {
+				t.Errorf("status history = %+v, want %s -> %s by support", history, tt.from, tt.to)
+			}
+
+			for docType, want := range map[string]int{"invoice": tt.wantInvoices, "credit_note": tt.wantCreditNotes} {
+				var count int64
+				db.Model(&models.Invoice{}).Where("order_id = ? AND type = ?", order.ID, docType).Count(&count)
+				if int(count) != want {
+					t.Errorf("%d documents of type %s, want %d", count, docType, want)
+				}
+			}
+			var product models.Product
+			if err := db.First(&product, productID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if product.Stock != tt.wantStock {
+				t.Errorf("stock = %d, want %d", product.Stock, tt.wantStock)
+			}
+			var user models.User
+			if err := db.First(&user, userID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if user.Balance != tt.wantBalance {
+				t.Errorf("user balance = %d, want %d", user.Balance, tt.wantBalance)
+			}
+		})
+	}
+}
+
+func TestGetOrderTransitions(t *testing.T) {
+	tests := []struct {
+		status      string
+		wantAllowed string
+	}{
+		{"pending", "[processing cancelled]"},
+		{"processing", "[shipped cancelled]"},
+		{"shipped", "[delivered]"},
+		{"delivered", "[]"},
+		{"cancelled", "[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			db := useTestDB(t)
+			order := models.Order{CustomerID: 1, OrderDate: time.Now().UTC(), Status: tt.status, Currency: models.DefaultCurrency}
+			createRecords(t, db, &order)
+
+			status, body := sendRequest(t, GetOrderTransitions, "GET", "/orders/:id/transitions", fmt.Sprintf("/orders/%d/transitions", order.ID), "")
+			if status != 200 {
+				t.Fatalf("GetOrderTransitions returned %d: %v", status, body)
+			}
+			data := body["data"].(map[string]interface{})
+			if allowed := fmt.Sprint(data["allowed"]); allowed != tt.wantAllowed {
+				t.Errorf("allowed = %s, want %s", allowed, tt.wantAllowed)
+			}
+		})
+	}
+}
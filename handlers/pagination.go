@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// pagination is the page of a listing a request asked for, and once the
+// listing is counted, how many results there are in total
+type pagination struct {
+	Page       int   `json:"page"`
+	PerPage    int   `json:"per_page"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
+}
+
+// parsePagination reads the page and per_page query parameters. Pages start
+// at 1; per_page defaults to 20 and is at most 100.
+func parsePagination(c *fiber.Ctx) (*pagination, error) {
+	p := &pagination{Page: 1, PerPage: defaultPerPage}
+	if page := c.Query("page"); page != "" {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return nil, newRequestError(400, "page must be a positive number")
+		}
+		p.Page = n
+	}
+	if perPage := c.Query("per_page"); perPage != "" {
+		n, err := strconv.Atoi(perPage)
+		if err != nil || n < 1 || n > maxPerPage {
+			return nil, newRequestError(400, "per_page must be between 1 and "+strconv.Itoa(maxPerPage))
+		}
+		p.PerPage = n
+	}
+	return p, nil
+}
+
+// count records the total number of results of query
+func (p *pagination) count(query *gorm.DB) error {
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return err
+	}
+	p.setTotal(total)
+	return nil
+}
+
+// setTotal records the total number of results
+func (p *pagination) setTotal(total int64) {
+	p.Total = total
+	p.TotalPages = int((total + int64(p.PerPage) - 1) / int64(p.PerPage))
+}
+
+// window returns the bounds of the requested page within n results that
+// are already in memory
+func (p *pagination) window(n int) (int, int) {
+	start := min((p.Page-1)*p.PerPage, n)
+	return start, min(start+p.PerPage, n)
+}
+
+// scope limits a query to the requested page
+func (p *pagination) scope(db *gorm.DB) *gorm.DB {
+	return db.Offset((p.Page - 1) * p.PerPage).Limit(p.PerPage)
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	// paymentCodeAlphabet leaves out characters that are easy to misread (0/O, 1/I)
+	paymentCodeAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+	paymentCodeLength   = 8
+
+	// paymentPayloadPrefix identifies and versions the QR payload format
+	paymentPayloadPrefix = "KBTGPAY1"
+
+	defaultPaymentCodeTTLMinutes = 15
+)
+
+// CreatePaymentCodeRequest represents the request body for creating a payment code
+type CreatePaymentCodeRequest struct {
+	Amount           int `json:"amount"` // 0 = open amount
+	ExpiresInMinutes int `json:"expires_in_minutes"`
+}
+
+// PayByCodeRequest represents the request body for paying with a payment code.
+// Either code or payload (the scanned QR content) must be given.
+type PayByCodeRequest struct {
+	FromUserID     uint   `json:"from_user_id"`
+	Code           string `json:"code"`
+	Payload        string `json:"payload"`
+	Amount         int    `json:"amount"`
+	Note           string `json:"note"`
+	IdempotencyKey string `json:"idempotency_key"`
+}
+
+// CreatePaymentCode creates a one-time payment code for a user to receive points
+func CreatePaymentCode(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var user models.User
+
+	if err := database.DB.First(&user, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	req := new(CreatePaymentCodeRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Amount < 0 || req.ExpiresInMinutes < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "amount and expires_in_minutes cannot be negative",
+		})
+	}
+	if req.ExpiresInMinutes == 0 {
+		req.ExpiresInMinutes = defaultPaymentCodeTTLMinutes
+	}
+
+	code, err := generateCode(paymentCodeLength)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to generate payment code",
+		})
+	}
+
+	expiresAt := time.Now().Add(time.Duration(req.ExpiresInMinutes) * time.Minute)
+	paymentCode := models.PaymentCode{
+		Code:      code,
+		UserID:    user.ID,
+		Amount:    req.Amount,
+		Payload:   buildPaymentPayload(code, user.ID, req.Amount, expiresAt),
+		Status:    "active",
+		ExpiresAt: expiresAt,
+	}
+
+	if err := database.DB.Create(&paymentCode).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to create payment code",
+		})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    paymentCode,
+	})
+}
+
+// PayByCode resolves a payment code to its recipient and transfers the points
+func PayByCode(c *fiber.Ctx) error {
+	req := new(PayByCodeRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Payload != "" {
+		code, err := parsePaymentPayload(req.Payload)
+		if err != nil {
+			return sendError(c, err, "Invalid payment payload")
+		}
+		req.Code = code
+	}
+
+	if req.FromUserID == 0 || req.Code == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "from_user_id and code or payload are required",
+		})
+	}
+
+	var paymentCode models.PaymentCode
+	if err := database.DB.Where("code = ?", strings.ToUpper(req.Code)).First(&paymentCode).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Payment code not found",
+		})
+	}
+
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = fmt.Sprintf("paycode-%s", paymentCode.Code)
+	}
+
+	// A retried payment returns the transfer that already used the code
+	var existingTransfer models.Transfer
+	if err := database.DB.Where("idempotency_key = ?", req.IdempotencyKey).First(&existingTransfer).Error; err == nil {
+		if paymentCode.TransferID == nil || *paymentCode.TransferID != existingTransfer.ID ||
+			existingTransfer.FromUserID != req.FromUserID {
+			return c.Status(409).JSON(fiber.Map{
+				"error": "idempotency_key belongs to another transfer",
+			})
+		}
+		database.DB.Preload("FromUser").Preload("ToUser").First(&existingTransfer, existingTransfer.ID)
+		return c.Status(200).JSON(fiber.Map{
+			"success": true,
+			"data":    existingTransfer,
+			"message": "Payment already made (idempotent)",
+		})
+	}
+
+	// Record expiry so the code no longer shows as active
+	if paymentCode.Status == "active" && time.Now().After(paymentCode.ExpiresAt) {
+		database.DB.Model(&paymentCode).Update("status", "expired")
+		paymentCode.Status = "expired"
+	}
+	if paymentCode.Status != "active" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("Payment code is %s", paymentCode.Status),
+		})
+	}
+
+	amount := paymentCode.Amount
+	if amount == 0 {
+		if req.Amount <= 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "amount is required for an open payment code",
+			})
+		}
+		amount = req.Amount
+	} else if req.Amount != 0 && req.Amount != amount {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Amount does not match the payment code",
+		})
+	}
+
+	note := req.Note
+	if note == "" {
+		note = fmt.Sprintf("Payment code %s", paymentCode.Code)
+	}
+
+	var transfer *models.Transfer
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Claim the code first so concurrent payments cannot both use it
+		now := time.Now()
+		result := tx.Model(&models.PaymentCode{}).
+			Where("id = ? AND status = ? AND expires_at > ?", paymentCode.ID, "active", now).
+			Updates(map[string]interface{}{
+				"status":  "used",
+				"used_at": now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return newRequestError(400, "Payment code is no longer active")
+		}
+
+		var err error
+		transfer, err = executeTransfer(tx, &CreateTransferRequest{
+			FromUserID:     req.FromUserID,
+			ToUserID:       paymentCode.UserID,
+			Amount:         amount,
+			Note:           note,
+			IdempotencyKey: req.IdempotencyKey,
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.PaymentCode{}).
+			Where("id = ?", paymentCode.ID).
+			Update("transfer_id", transfer.ID).Error
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to pay by code")
+	}
+
+	database.DB.Preload("FromUser").Preload("ToUser").First(transfer, transfer.ID)
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    transfer,
+	})
+}
+
+// generateCode returns a random code of length characters from
+// paymentCodeAlphabet. Also used for referral and voucher codes.
+func generateCode(length int) (string, error) {
+	var sb strings.Builder
+	alphabetSize := big.NewInt(int64(len(paymentCodeAlphabet)))
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(paymentCodeAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// buildPaymentPayload renders the QR payload:
+// KBTGPAY1|<code>|<user_id>|<amount>|<expires unix>|<crc16>
+func buildPaymentPayload(code string, userID uint, amount int, expiresAt time.Time) string {
+	body := fmt.Sprintf("%s|%s|%d|%d|%d|", paymentPayloadPrefix, code, userID, amount, expiresAt.Unix())
+	return fmt.Sprintf("%s%04X", body, crc16CCITT([]byte(body)))
+}
+
+// parsePaymentPayload verifies a scanned payload's checksum and returns its code
+func parsePaymentPayload(payload string) (string, error) {
+	parts := strings.Split(payload, "|")
+	if len(parts) != 6 || parts[0] != paymentPayloadPrefix {
+		return "", newRequestError(400, "Invalid payment payload")
+	}
+
+	body := payload[:strings.LastIndex(payload, "|")+1]
+	checksum, err := strconv.ParseUint(parts[5], 16, 16)
+	if err != nil || uint16(checksum) != crc16CCITT([]byte(body)) {
+		return "", newRequestError(400, "Payment payload checksum mismatch")
+	}
+
+	return parts[1], nil
+}
+
+// crc16CCITT computes CRC-16/CCITT-FALSE, the checksum used by EMV QR payloads
+func crc16CCITT(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
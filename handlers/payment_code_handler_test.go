@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"temp_kbtg_backend/models"
+	"testing"
+	"time"
+)
+
+func TestPayByCodeRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		first        string // Body of the first payment; empty to skip it
+		retry        string
+		wantStatus   int
+		wantPayments int64 // Made by the payer to the code's owner
+		wantBalance  int   // Of the payer after the retry
+	}{
+		{
+			name:         "retry with the default key",
+			first:        `{"from_user_id": 1, "code": "PAYME123"}`,
+			retry:        `{"from_user_id": 1, "code": "PAYME123"}`,
+			wantStatus:   200,
+			wantPayments: 1,
+			wantBalance:  70,
+		},
+		{
+			name:         "retry with the client's key",
+			first:        `{"from_user_id": 1, "code": "PAYME123", "idempotency_key": "pos-42"}`,
+			retry:        `{"from_user_id": 1, "code": "PAYME123", "idempotency_key": "pos-42"}`,
+			wantStatus:   200,
+			wantPayments: 1,
+			wantBalance:  70,
+		},
+		{
+			name:         "retry by another payer",
+			first:        `{"from_user_id": 1, "code": "PAYME123"}`,
+			retry:        `{"from_user_id": 3, "code": "PAYME123"}`,
+			wantStatus:   409,
+			wantPayments: 1,
+			wantBalance:  70,
+		},
+		{
+			name:        "key of another transfer",
+			retry:       `{"from_user_id": 1, "code": "PAYME123", "idempotency_key": "earlier"}`,
+			wantStatus:  409,
+			wantBalance: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t)
+			createRecords(t, db,
+				&models.User{Name: "A", Email: "a@example.com", ReferralCode: "A", Balance: 100},
+				&models.User{Name: "B", Email: "b@example.com", ReferralCode: "B"},
+				&models.User{Name: "C", Email: "c@example.com", ReferralCode: "C", Balance: 100},
+				&models.PaymentCode{Code: "PAYME123", UserID: 2, Amount: 30, Payload: "-", Status: "active",
+					ExpiresAt: time.Now().Add(time.Hour)},
+				&models.Transfer{FromUserID: 3, ToUserID: 2, Amount: 10, Status: "completed", IdempotencyKey: "earlier"})
+
+			if tt.first != "" {
+				if status, body := sendRequest(t, PayByCode, "POST", "/pay", "/pay", tt.first); status != 201 {
+					t.Fatalf("first payment returned %d: %v", status, body)
+				}
+			}
+			status, body := sendRequest(t, PayByCode, "POST", "/pay", "/pay", tt.retry)
+			if status != tt.wantStatus {
+				t.Fatalf("retry returned %d, want %d: %v", status, tt.wantStatus, body)
+			}
+
+			var payments int64
+			db.Model(&models.Transfer{}).Where("from_user_id = ? AND to_user_id = ?", 1, 2).Count(&payments)
+			if payments != tt.wantPayments {
+				t.Errorf("%d payments made, want %d", payments, tt.wantPayments)
+			}
+			var payer models.User
+			if err := db.First(&payer, 1).Error; err != nil {
+				t.Fatal(err)
+			}
+			if payer.Balance != tt.wantBalance {
+				t.Errorf("payer balance = %d, want %d", payer.Balance, tt.wantBalance)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ProductRequest represents the request body for creating or updating a
+// product. Stock is only set on create; afterwards it changes through
+// POST /products/:id/stock so concurrent orders are never overwritten.
+type ProductRequest struct {
+	SKU      string       `json:"sku"`
+	Name     string       `json:"name"`
+	Category string       `json:"category"`
+	Price    models.Money `json:"price"`
+	Currency string       `json:"currency"`
+	Stock    int          `json:"stock"`
+	Active   *bool        `json:"active"`
+}
+
+// StockAdjustmentRequest represents the request body for adjusting stock
+type StockAdjustmentRequest struct {
+	Adjustment int `json:"adjustment"` // Units to add, or remove when negative
+}
+
+// GetProducts returns all products with optional filtering
+func GetProducts(c *fiber.Ctx) error {
+	var products []models.Product
+
+	query := database.DB
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if active := c.Query("active"); active != "" {
+		query = query.Where("active = ?", active == "true")
+	}
+	if c.Query("in_stock") == "true" {
+		query = query.Where("stock > 0")
+	}
+
+	if err := query.Order("sku ASC").Find(&products).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch products",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    products,
+	})
+}
+
+// GetProduct returns a single product by ID
+func GetProduct(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var product models.Product
+
+	if err := database.DB.First(&product, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Product not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    product,
+	})
+}
+
+// CreateProduct adds a product to the catalog
+func CreateProduct(c *fiber.Ctx) error {
+	req := new(ProductRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Stock < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "stock cannot be negative",
+		})
+	}
+
+	product := models.Product{Active: true, Stock: req.Stock}
+	if err := saveProduct(&product, req); err != nil {
+		return sendError(c, err, "Failed to create product")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    product,
+	})
+}
+
+// UpdateProduct updates a product's details. Orders already placed keep the
+// name and price they were placed with.
+func UpdateProduct(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var product models.Product
+
+	if err := database.DB.First(&product, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Product not found",
+		})
+	}
+
+	req := new(ProductRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := saveProduct(&product, req); err != nil {
+		return sendError(c, err, "Failed to update product")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    product,
+	})
+}
+
+// AdjustProductStock adds or removes stock, e.g. for deliveries or stock counts
+func AdjustProductStock(c *fiber.Ctx) error {
+	id := c.Params("id")
+	req := new(StockAdjustmentRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Adjustment == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "adjustment cannot be 0",
+		})
+	}
+
+	var product models.Product
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&product, id).Error; err != nil {
+			return newRequestError(404, "Product not found")
+		}
+
+		if req.Adjustment < 0 {
+			if err := reserveStock(tx, &product, -req.Adjustment); err != nil {
+				return err
+			}
+		} else if err := releaseStock(tx, product.ID, req.Adjustment); err != nil {
+			return err
+		}
+
+		return tx.First(&product, product.ID).Error
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to adjust stock")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    product,
+	})
+}
+
+// DeleteProduct deletes a product that has never been ordered. Ordered
+// products are kept for order history and should be deactivated instead.
+func DeleteProduct(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.First(&product, id).Error; err != nil {
+			return newRequestError(404, "Product not found")
+		}
+
+		var ordered int64
+		if err := tx.Model(&models.LineItem{}).Where("product_id = ?", product.ID).Count(&ordered).Error; err != nil {
+			return err
+		}
+		if ordered > 0 {
+			return newRequestError(409, "Product has been ordered; set active to false instead")
+		}
+
+		return tx.Delete(&product).Error
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to delete product")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Product deleted successfully",
+	})
+}
+
+// saveProduct validates req, copies it onto product and stores it
+func saveProduct(product *models.Product, req *ProductRequest) error {
+	req.SKU = strings.ToUpper(strings.TrimSpace(req.SKU))
+	req.Name = strings.TrimSpace(req.Name)
+	if req.SKU == "" || req.Name == "" {
+		return newRequestError(400, "sku and name are required")
+	}
+	if req.Price < 0 {
+		return newRequestError(400, "price cannot be negative")
+	}
+
+	req.Currency = strings.ToUpper(req.Currency)
+	if req.Currency == "" {
+		req.Currency = models.DefaultCurrency
+	}
+	if !models.SupportedCurrencies[req.Currency] {
+		return newRequestError(400, "Unsupported currency: "+req.Currency)
+	}
+
+	product.SKU = req.SKU
+	product.Name = req.Name
+	product.Category = req.Category
+	product.Price = req.Price
+	product.Currency = req.Currency
+	if req.Active != nil {
+		product.Active = *req.Active
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var clash int64
+		if err := tx.Model(&models.Product{}).
+			Where("sku = ? AND id <> ?", product.SKU, product.ID).
+			Count(&clash).Error; err != nil {
+			return err
+		}
+		if clash > 0 {
+			return newRequestError(409, fmt.Sprintf("A product with SKU %s already exists", product.SKU))
+		}
+
+		if product.ID == 0 {
+			return tx.Create(product).Error
+		}
+		// Stock is left alone so orders placed meanwhile are not undone
+		if err := tx.Omit("Stock").Save(product).Error; err != nil {
+			return err
+		}
+		return tx.First(product, product.ID).Error
+	})
+}
+
+// findOrderableProduct looks up the product a line item refers to, by ID or
+// SKU, and checks it can be added to order
+func findOrderableProduct(tx *gorm.DB, order *models.Order, productID *uint, sku string) (*models.Product, error) {
+	var product models.Product
+	switch {
+	case productID != nil:
+		if err := tx.First(&product, *productID).Error; err != nil {
+			return nil, newRequestError(400, fmt.Sprintf("Product %d not found", *productID))
+		}
+	case sku != "":
+		sku = strings.ToUpper(strings.TrimSpace(sku))
+		if err := tx.Where("sku = ?", sku).First(&product).Error; err != nil {
+			return nil, newRequestError(400, fmt.Sprintf("Product %s not found", sku))
+		}
+	default:
+		return nil, newRequestError(400, "Each line item needs a product_id or sku")
+	}
+
+	if !product.Active {
+		return nil, newRequestError(400, fmt.Sprintf("Product %s is not available", product.SKU))
+	}
+	if product.Currency != order.Currency {
+		return nil, newRequestError(400, fmt.Sprintf("Product %s is priced in %s but the order is in %s",
+			product.SKU, product.Currency, order.Currency))
+	}
+	return &product, nil
+}
+
+// reserveStock takes quantity units of product out of stock. The decrement
+// only applies while enough stock is left, so concurrent orders cannot
+// oversell.
+func reserveStock(tx *gorm.DB, product *models.Product, quantity int) error {
+	result := tx.Model(&models.Product{}).
+		Where("id = ? AND stock >= ?", product.ID, quantity).
+		Update("stock", gorm.Expr("stock - ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		var available int
+		tx.Model(&models.Product{}).Select("stock").Where("id = ?", product.ID).Scan(&available)
+		return newRequestError(409, fmt.Sprintf("Insufficient stock for %s: %d available, %d requested",
+			product.SKU, available, quantity))
+	}
+	return nil
+}
+
+// releaseStock puts quantity units of a product back into stock
+func releaseStock(tx *gorm.DB, productID uint, quantity int) error {
+	return tx.Model(&models.Product{}).
+		Where("id = ?", productID).
+		Update("stock", gorm.Expr("stock + ?", quantity)).Error
+}
+
+// releaseOrderStock puts the stock taken by an order's line items back
+func releaseOrderStock(tx *gorm.DB, order *models.Order) error {
+	var items []models.LineItem
+	if err := tx.Where("order_id = ? AND product_id IS NOT NULL", order.ID).Find(&items).Error; err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := releaseStock(tx, *item.ProductID, item.Quantity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
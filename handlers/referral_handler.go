@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const referralCodeLength = 8
+
+// publicEmailDomains are shared mail providers, so matching domains there
+// says nothing about two sign-ups belonging to the same person or company
+var publicEmailDomains = map[string]bool{
+	"gmail.com":      true,
+	"googlemail.com": true,
+	"hotmail.com":    true,
+	"outlook.com":    true,
+	"live.com":       true,
+	"yahoo.com":      true,
+	"icloud.com":     true,
+	"proton.me":      true,
+	"protonmail.com": true,
+}
+
+// GetUserReferrals returns a user's referral code, who referred them and the
+// users they referred with each referral's status
+func GetUserReferrals(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var user models.User
+
+	if err := database.DB.First(&user, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if err := ensureReferralCode(database.DB, &user); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch referrals",
+		})
+	}
+
+	var referrals []models.Referral
+	if err := database.DB.Preload("Referee").
+		Where("referrer_id = ?", user.ID).
+		Order("created_at DESC").
+		Find(&referrals).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch referrals",
+		})
+	}
+
+	var referredBy *models.Referral
+	var referral models.Referral
+	if err := database.DB.Preload("Referrer").Where("referee_id = ?", user.ID).First(&referral).Error; err == nil {
+		referredBy = &referral
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"user_id":       user.ID,
+			"referral_code": user.ReferralCode,
+			"referred_by":   referredBy,
+			"referrals":     referrals,
+		},
+	})
+}
+
+// GetReferralConfig returns the referral reward configuration
+func GetReferralConfig(c *fiber.Ctx) error {
+	var config models.ReferralConfig
+
+	if err := database.DB.First(&config).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch referral config",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    config,
+	})
+}
+
+// UpdateReferralConfig updates the referral reward configuration. Pending
+// referrals are paid at the values in force when they qualify.
+func UpdateReferralConfig(c *fiber.Ctx) error {
+	var config models.ReferralConfig
+
+	if err := database.DB.First(&config).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch referral config",
+		})
+	}
+
+	configID := config.ID
+	if err := c.BodyParser(&config); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	config.ID = configID
+
+	if config.ReferrerPoints < 0 || config.RefereePoints < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "referrer_points and referee_points cannot be negative",
+		})
+	}
+	if config.PointType == "" {
+		config.PointType = models.DefaultPointType
+	}
+	if err := findPointType(database.DB, config.PointType); err != nil {
+		return sendError(c, err, "Failed to update referral config")
+	}
+
+	if err := database.DB.Save(&config).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to update referral config",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    config,
+	})
+}
+
+// ensureReferralCode gives a user without a referral code a fresh one
+func ensureReferralCode(tx *gorm.DB, user *models.User) error {
+	if user.ReferralCode != "" {
+		return nil
+	}
+
+	code, err := generateCode(referralCodeLength)
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(user).Update("referral_code", code).Error; err != nil {
+		return err
+	}
+	user.ReferralCode = code
+	return nil
+}
+
+// recordReferral links a newly created user to the owner of code. Referrals
+// that fail the anti-abuse checks are kept as rejected so they show up in
+// the referrer's list.
+func recordReferral(tx *gorm.DB, referee *models.User, code string) error {
+	var referrer models.User
+	if err := tx.Where("referral_code = ?", strings.ToUpper(code)).First(&referrer).Error; err != nil {
+		return newRequestError(400, "Invalid referral code")
+	}
+
+	referral := models.Referral{
+		ReferrerID: referrer.ID,
+		RefereeID:  referee.ID,
+		Code:       referrer.ReferralCode,
+		Status:     "pending",
+	}
+	if reason := referralAbuseReason(&referrer, referee); reason != "" {
+		referral.Status = "rejected"
+		referral.RejectReason = reason
+	}
+
+	return tx.Create(&referral).Error
+}
+
+// referralAbuseReason returns why a referral should be rejected, or "" if it
+// looks genuine
+func referralAbuseReason(referrer, referee *models.User) string {
+	if referrer.ID == referee.ID || normalizeEmail(referrer.Email) == normalizeEmail(referee.Email) {
+		return "Self-referral"
+	}
+
+	referrerDomain := emailDomain(referrer.Email)
+	if referrerDomain != "" && referrerDomain == emailDomain(referee.Email) && !publicEmailDomains[referrerDomain] {
+		return fmt.Sprintf("Referrer and referee share the email domain %s", referrerDomain)
+	}
+
+	return ""
+}
+
+// qualifyReferral pays the referral rewards the first time a referred user
+// completes a qualifying action ("order" or "transfer")
+func qualifyReferral(tx *gorm.DB, userID uint, action string) error {
+	var referral models.Referral
+	if err := tx.Where("referee_id = ? AND status = ?", userID, "pending").First(&referral).Error; err != nil {
+		return nil
+	}
+
+	var config models.ReferralConfig
+	if err := tx.First(&config).Error; err != nil || !config.Active {
+		return nil
+	}
+
+	now := time.Now()
+	result := tx.Model(&models.Referral{}).
+		Where("id = ? AND status = ?", referral.ID, "pending").
+		Updates(map[string]interface{}{
+			"status":            "rewarded",
+			"qualifying_action": action,
+			"referrer_points":   config.ReferrerPoints,
+			"referee_points":    config.RefereePoints,
+			"rewarded_at":       now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	rewards := []struct {
+		userID uint
+		points int
+		role   string
+	}{
+		{referral.ReferrerID, config.ReferrerPoints, "referrer"},
+		{referral.RefereeID, config.RefereePoints, "referee"},
+	}
+	for _, reward := range rewards {
+		if reward.points == 0 {
+			continue
+		}
+		if _, err := applyPoints(tx, pointEntry{
+			UserID:    reward.userID,
+			PointType: config.PointType,
+			Change:    reward.points,
+			EventType: "earn",
+			Reference: fmt.Sprintf("referral-%d", referral.ID),
+			Metadata: ledgerMetadata(map[string]interface{}{
+				"referral_id": referral.ID,
+				"role":        reward.role,
+				"action":      action,
+			}),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// normalizeEmail lowercases an address and drops +tags, and dots for Gmail,
+// so aliases of one mailbox compare equal
+func normalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+
+	local, domain := email[:at], email[at+1:]
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[:plus]
+	}
+	if domain == "gmail.com" || domain == "googlemail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+	return local + "@" + domain
+}
+
+// emailDomain returns the lowercased domain of an address
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(email[at+1:]))
+}
@@ -0,0 +1,593 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// returnableOrderStatuses are the order statuses whose shipped items may be
+// returned
+var returnableOrderStatuses = map[string]bool{
+	"shipped":   true,
+	"delivered": true,
+}
+
+// CreateReturnRequest represents the request body for requesting a return
+type CreateReturnRequest struct {
+	Reason string              `json:"reason"`
+	Items  []ReturnItemRequest `json:"items"`
+}
+
+// ReturnItemRequest is a quantity of a line item to return
+type ReturnItemRequest struct {
+	LineItemID uint `json:"line_item_id"`
+	Quantity   int  `json:"quantity"`
+}
+
+// ReturnActionRequest represents the request body for approving, rejecting
+// or receiving a return
+type ReturnActionRequest struct {
+	Actor string `json:"actor"`
+	Note  string `json:"note"`
+}
+
+// RefundReturnRequest represents the request body for refunding a return
+type RefundReturnRequest struct {
+	Method    string `json:"method"`     // "money" or "points"
+	PointType string `json:"point_type"` // Defaults to the default point type
+	Actor     string `json:"actor"`
+	Note      string `json:"note"`
+}
+
+// GetReturns returns all returns with optional filtering
+func GetReturns(c *fiber.Ctx) error {
+	var returns []models.OrderReturn
+
+	query := database.DB.Preload("Items")
+
+	// Optional filters
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if orderID := c.Query("order_id"); orderID != "" {
+		query = query.Where("order_id = ?", orderID)
+	}
+
+	if err := query.Order("created_at DESC").Find(&returns).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch returns",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    returns,
+	})
+}
+
+// GetReturn returns a single return with its items
+func GetReturn(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var ret models.OrderReturn
+
+	if err := database.DB.Preload("Items").First(&ret, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Return not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    ret,
+	})
+}
+
+// GetOrderReturns returns the returns requested for an order
+func GetOrderReturns(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var order models.Order
+
+	if err := database.DB.First(&order, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Order not found",
+		})
+	}
+
+	var returns []models.OrderReturn
+	if err := database.DB.Preload("Items").Where("order_id = ?", order.ID).Order("id ASC").Find(&returns).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch returns",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    returns,
+	})
+}
+
+// CreateOrderReturn requests the return of shipped line items. The units are
+// set aside on their line items so they cannot be returned twice.
+func CreateOrderReturn(c *fiber.Ctx) error {
+	id := c.Params("id")
+	req := new(CreateReturnRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Reason == "" || len(req.Items) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "reason and items are required",
+		})
+	}
+
+	var ret models.OrderReturn
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.First(&order, id).Error; err != nil {
+			return newRequestError(404, "Order not found")
+		}
+		if !returnableOrderStatuses[order.Status] {
+			return newRequestError(400, fmt.Sprintf("Cannot return items of order with status: %s", order.Status))
+		}
+
+		var lineItems []models.LineItem
+		if err := tx.Where("order_id = ?", order.ID).Find(&lineItems).Error; err != nil {
+			return err
+		}
+		lines := make(map[uint]models.LineItem, len(lineItems))
+		for _, line := range lineItems {
+			lines[line.ID] = line
+		}
+
+		ret = models.OrderReturn{
+			OrderID:    order.ID,
+			CustomerID: order.CustomerID,
+			Status:     "requested",
+			Reason:     req.Reason,
+		}
+		for _, r := range req.Items {
+			line, ok := lines[r.LineItemID]
+			if !ok {
+				return newRequestError(400, fmt.Sprintf("Line item %d is not on this order", r.LineItemID))
+			}
+			if r.Quantity <= 0 {
+				return newRequestError(400, "quantity must be greater than 0")
+			}
+			delete(lines, r.LineItemID)
+
+			if err := claimReturnedQuantity(tx, &line, r.Quantity); err != nil {
+				return err
+			}
+			item, err := returnItem(tx, &line, r.Quantity)
+			if err != nil {
+				return err
+			}
+			ret.Items = append(ret.Items, item)
+			ret.Amount += item.Net + item.Tax
+		}
+
+		return tx.Create(&ret).Error
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to create return")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    ret,
+	})
+}
+
+// ApproveReturn accepts a requested return; the customer can send the items back
+func ApproveReturn(c *fiber.Ctx) error {
+	action, err := parseReturnAction(c)
+	if err != nil {
+		return sendError(c, err, "Invalid request body")
+	}
+	return changeReturn(c, action, "approve", []string{"requested"}, "approved",
+		func(tx *gorm.DB, ret *models.OrderReturn, now time.Time) (map[string]interface{}, error) {
+			return map[string]interface{}{"approved_at": now}, nil
+		})
+}
+
+// RejectReturn turns down a return that has not been received; its units
+// can be returned again
+func RejectReturn(c *fiber.Ctx) error {
+	action, err := parseReturnAction(c)
+	if err != nil {
+		return sendError(c, err, "Invalid request body")
+	}
+	return changeReturn(c, action, "reject", []string{"requested", "approved"}, "rejected",
+		func(tx *gorm.DB, ret *models.OrderReturn, now time.Time) (map[string]interface{}, error) {
+			for _, item := range ret.Items {
+				if err := tx.Model(&models.LineItem{}).Where("id = ?", item.LineItemID).
+					Update("returned_quantity", gorm.Expr("returned_quantity - ?", item.Quantity)).Error; err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		})
+}
+
+// ReceiveReturn records that the returned items arrived and puts them back
+// into stock
+func ReceiveReturn(c *fiber.Ctx) error {
+	action, err := parseReturnAction(c)
+	if err != nil {
+		return sendError(c, err, "Invalid request body")
+	}
+	return changeReturn(c, action, "receive", []string{"approved"}, "received",
+		func(tx *gorm.DB, ret *models.OrderReturn, now time.Time) (map[string]interface{}, error) {
+			for _, item := range ret.Items {
+				var line models.LineItem
+				if err := tx.First(&line, item.LineItemID).Error; err != nil {
+					return nil, err
+				}
+				if line.ProductID == nil {
+					continue
+				}
+				if err := releaseStock(tx, *line.ProductID, item.Quantity); err != nil {
+					return nil, err
+				}
+			}
+			return map[string]interface{}{"received_at": now}, nil
+		})
+}
+
+// RefundReturn refunds a received return, either as a record of a money
+// refund or as points credited to the customer's linked user at the point
+// type's redeem value. A credit note is issued for the returned items and
+// the order's refunded total is updated.
+func RefundReturn(c *fiber.Ctx) error {
+	req := new(RefundReturnRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Method != "money" && req.Method != "points" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "method must be either money or points",
+		})
+	}
+	if req.PointType == "" {
+		req.PointType = models.DefaultPointType
+	}
+
+	action := ReturnActionRequest{Actor: req.Actor, Note: req.Note}
+	return changeReturn(c, action, "refund", []string{"received"}, "refunded",
+		func(tx *gorm.DB, ret *models.OrderReturn, now time.Time) (map[string]interface{}, error) {
+			updates := map[string]interface{}{
+				"refund_method": req.Method,
+				"refunded_at":   now,
+			}
+
+			if req.Method == "points" {
+				ledger, points, err := refundReturnPoints(tx, ret, req.PointType)
+				if err != nil {
+					return nil, err
+				}
+				updates["refund_points"] = points
+				updates["refund_point_type"] = req.PointType
+				updates["ledger_id"] = ledger.ID
+			}
+
+			creditNote, err := creditReturn(tx, ret)
+			if err != nil {
+				return nil, err
+			}
+			if creditNote != nil {
+				updates["credit_note_id"] = creditNote.ID
+			}
+
+			if err := recordOrderRefund(tx, ret.OrderID, ret.Amount); err != nil {
+				return nil, err
+			}
+			return updates, reverseReturnedPoints(tx, ret)
+		})
+}
+
+// parseReturnAction reads the optional actor and note of a return action
+func parseReturnAction(c *fiber.Ctx) (ReturnActionRequest, error) {
+	var action ReturnActionRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&action); err != nil {
+			return action, newRequestError(400, "Invalid request body")
+		}
+	}
+	return action, nil
+}
+
+// changeReturn moves the return in the :id param from one of the from
+// statuses to status, applying apply's side effects in the same transaction.
+// The status is claimed with a conditional update so concurrent actions
+// cannot both succeed.
+func changeReturn(c *fiber.Ctx, action ReturnActionRequest, verb string, from []string, status string,
+	apply func(tx *gorm.DB, ret *models.OrderReturn, now time.Time) (map[string]interface{}, error)) error {
+	id := c.Params("id")
+
+	var ret models.OrderReturn
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Items").First(&ret, id).Error; err != nil {
+			return newRequestError(404, "Return not found")
+		}
+
+		allowed := false
+		for _, s := range from {
+			allowed = allowed || ret.Status == s
+		}
+		if !allowed {
+			return newRequestError(400, fmt.Sprintf("Cannot %s return with status: %s", verb, ret.Status))
+		}
+
+		now := time.Now()
+		updates, err := apply(tx, &ret, now)
+		if err != nil {
+			return err
+		}
+		if updates == nil {
+			updates = map[string]interface{}{}
+		}
+		updates["status"] = status
+		updates["updated_by"] = action.Actor
+		updates["updated_at"] = now
+		if action.Note != "" {
+			updates["note"] = action.Note
+		}
+
+		result := tx.Model(&models.OrderReturn{}).
+			Where("id = ? AND status = ?", ret.ID, ret.Status).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return newRequestError(409, "Return status changed concurrently, please retry")
+		}
+		return nil
+	})
+	if err != nil {
+		return sendError(c, err, fmt.Sprintf("Failed to %s return", verb))
+	}
+
+	database.DB.Preload("Items").First(&ret, ret.ID)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    ret,
+	})
+}
+
+// claimReturnedQuantity sets quantity units of line aside for a return. The
+// conditional update keeps concurrent returns from returning more units than
+// were shipped.
+func claimReturnedQuantity(tx *gorm.DB, line *models.LineItem, quantity int) error {
+	result := tx.Model(&models.LineItem{}).
+		Where("id = ? AND returned_quantity + ? <= shipped_quantity", line.ID, quantity).
+		Update("returned_quantity", gorm.Expr("returned_quantity + ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if err := tx.First(line, line.ID).Error; err != nil {
+			return err
+		}
+		return newRequestError(409, fmt.Sprintf("Only %d of line item %d can be returned, %d requested",
+			line.Shipped-line.Returned, line.ID, quantity))
+	}
+	return nil
+}
+
+// returnItem values quantity units of line at their share of the line's
+// discount, net amount and tax. The return that brings the line's last
+// units back takes whatever earlier returns left, so the returns of a line
+// never add up to more or less than the line.
+func returnItem(tx *gorm.DB, line *models.LineItem, quantity int) (models.ReturnItem, error) {
+	item := models.ReturnItem{
+		LineItemID:  line.ID,
+		SKU:         line.SKU,
+		ProductName: line.ProductName,
+		Quantity:    quantity,
+		UnitPrice:   line.UnitPrice,
+	}
+
+	if line.Returned+quantity < line.Quantity {
+		units, of := models.Money(quantity), models.Money(line.Quantity)
+		item.Discount = line.Discount.Share(units, of)
+		item.Net = line.Net.Share(units, of)
+		item.Tax = line.Tax.Share(units, of)
+		return item, nil
+	}
+
+	var earlier struct {
+		Discount models.Money
+		Net      models.Money
+		Tax      models.Money
+	}
+	if err := tx.Model(&models.ReturnItem{}).
+		Select("COALESCE(SUM(return_items.discount_minor), 0) AS discount, "+
+			"COALESCE(SUM(return_items.net_minor), 0) AS net, COALESCE(SUM(return_items.tax_minor), 0) AS tax").
+		Joins("JOIN order_returns ON order_returns.id = return_items.return_id").
+		Where("return_items.line_item_id = ? AND order_returns.status <> ?", line.ID, "rejected").
+		Scan(&earlier).Error; err != nil {
+		return item, err
+	}
+	item.Discount = line.Discount - earlier.Discount
+	item.Net = line.Net - earlier.Net
+	item.Tax = line.Tax - earlier.Tax
+	return item, nil
+}
+
+// refundReturnPoints credits the value of a return to the customer's linked
+// user as points of pointType, rounded up to a whole point. Only returns of
+// orders in the default currency, which redeem values are in, qualify.
+func refundReturnPoints(tx *gorm.DB, ret *models.OrderReturn, pointType string) (*models.PointLedger, int, error) {
+	var order models.Order
+	if err := tx.First(&order, ret.OrderID).Error; err != nil {
+		return nil, 0, err
+	}
+	if order.Currency != models.DefaultCurrency {
+		return nil, 0, newRequestError(400, fmt.Sprintf("Only returns of orders in %s can be refunded as points", models.DefaultCurrency))
+	}
+
+	var customer models.Customer
+	if err := tx.First(&customer, ret.CustomerID).Error; err != nil {
+		return nil, 0, err
+	}
+	if customer.UserID == nil {
+		return nil, 0, newRequestError(400, "Customer has no linked user to credit points to")
+	}
+
+	var pt models.PointType
+	if err := tx.Where("code = ?", pointType).First(&pt).Error; err != nil {
+		return nil, 0, newRequestError(400, fmt.Sprintf("Unknown point type: %s", pointType))
+	}
+	if pt.RedeemValue <= 0 {
+		return nil, 0, newRequestError(400, fmt.Sprintf("Point type %s has no redeem value", pt.Code))
+	}
+
+	points := int(math.Ceil(ret.Amount.Float()/pt.RedeemValue - 1e-9))
+	ledger, err := applyPoints(tx, pointEntry{
+		UserID:    *customer.UserID,
+		PointType: pt.Code,
+		Change:    points,
+		EventType: "return_refund",
+		OrderID:   &ret.OrderID,
+		Reference: fmt.Sprintf("return-%d", ret.ID),
+		Metadata: ledgerMetadata(map[string]interface{}{
+			"return_id": ret.ID,
+			"rate":      pt.RedeemValue,
+			"amount":    ret.Amount,
+		}),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return ledger, points, nil
+}
+
+// reverseReturnedPoints takes back the points the order earned on the
+// refunded items of ret, in proportion to their value. The share is worked
+// out on everything refunded so far, so rounding never adds up across
+// returns and refunding the whole order takes back all it earned.
+func reverseReturnedPoints(tx *gorm.DB, ret *models.OrderReturn) error {
+	var order models.Order
+	if err := tx.First(&order, ret.OrderID).Error; err != nil {
+		return err
+	}
+	if order.TotalPrice <= 0 {
+		return nil
+	}
+	share := func(points int) int {
+		if order.RefundedTotal >= order.TotalPrice {
+			return points
+		}
+		return int(int64(points) * int64(order.RefundedTotal) / int64(order.TotalPrice))
+	}
+
+	type earnedPoints struct {
+		UserID    uint
+		PointType string
+		Earned    int
+		Reversed  int
+	}
+	var rows []earnedPoints
+	if err := tx.Model(&models.PointLedger{}).
+		Select("user_id, point_type, "+
+			"SUM(CASE WHEN event_type = 'earn' THEN change ELSE 0 END) AS earned, "+
+			"-SUM(CASE WHEN event_type = 'earn_reversal' THEN change ELSE 0 END) AS reversed").
+		Where("order_id = ? AND event_type IN ?", order.ID, []string{"earn", "earn_reversal"}).
+		Group("user_id, point_type").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		points := share(row.Earned) - row.Reversed
+		if points <= 0 {
+			continue
+		}
+
+		if _, err := applyPoints(tx, pointEntry{
+			UserID:    row.UserID,
+			PointType: row.PointType,
+			Change:    -points,
+			EventType: "earn_reversal",
+			OrderID:   &order.ID,
+			Reference: fmt.Sprintf("return-%d", ret.ID),
+			Metadata: ledgerMetadata(map[string]interface{}{
+				"reason":    "items returned",
+				"return_id": ret.ID,
+			}),
+			AllowNegative: true,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return reverseCampaignAwards(tx, order.ID, func(award models.CampaignAward) int {
+		return share(award.Points) - award.Reversed
+	})
+}
+
+// creditReturn issues a credit note for the items of a return against the
+// order's invoice. Orders invoiced before invoicing existed get none.
+func creditReturn(tx *gorm.DB, ret *models.OrderReturn) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := tx.Where("order_id = ? AND type = ?", ret.OrderID, "invoice").First(&invoice).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]models.InvoiceLine, 0, len(ret.Items))
+	for _, item := range ret.Items {
+		lineItemID := item.LineItemID
+		lines = append(lines, models.InvoiceLine{
+			LineItemID:  &lineItemID,
+			SKU:         item.SKU,
+			Description: item.ProductName,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			Total:       item.UnitPrice.Mul(item.Quantity),
+			Discount:    item.Discount,
+			Net:         item.Net,
+			Tax:         item.Tax,
+		})
+	}
+
+	return issueCreditNote(tx, &invoice, lines, nil, fmt.Sprintf("Return #%d: %s", ret.ID, ret.Reason))
+}
+
+// recordOrderRefund adds amount to the order's refunded total and marks the
+// order partially or fully refunded
+func recordOrderRefund(tx *gorm.DB, orderID uint, amount models.Money) error {
+	if err := tx.Model(&models.Order{}).Where("id = ?", orderID).
+		Update("refunded_total_minor", gorm.Expr("refunded_total_minor + ?", amount)).Error; err != nil {
+		return err
+	}
+
+	var order models.Order
+	if err := tx.First(&order, orderID).Error; err != nil {
+		return err
+	}
+	status := "partially_refunded"
+	if order.RefundedTotal >= order.TotalPrice {
+		status = "refunded"
+	}
+	return tx.Model(&order).Update("refund_status", status).Error
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"fmt"
+	"temp_kbtg_backend/models"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// createReturnOrder stores a delivered order of two pens worth 100.00
+// including VAT, both shipped, with 10 points earned by the customer's user
+func createReturnOrder(t *testing.T, currency string) (*gorm.DB, models.Order) {
+	t.Helper()
+	db := useTestDB(t)
+	userID := uint(1)
+	productID := uint(1)
+	order := models.Order{CustomerID: 1, OrderDate: time.Now().UTC(), Status: "delivered", Currency: currency, TotalPrice: 10000}
+	createRecords(t, db,
+		&models.User{Name: "A", Email: "a@example.com", ReferralCode: "A"},
+		&models.Customer{Name: "A", Email: "a@example.com", UserID: &userID},
+		&models.Product{SKU: "PEN", Name: "Pen", Price: 5000, Stock: 5, Active: true},
+		&order)
+	createRecords(t, db, &models.LineItem{OrderID: order.ID, ProductID: &productID, SKU: "PEN", ProductName: "Pen",
+		Quantity: 2, Shipped: 2, UnitPrice: 5000, TotalPrice: 10000, Net: 9346, Tax: 654})
+	if err := issueInvoice(db, &order); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyPoints(db, pointEntry{UserID: userID, Change: 10, EventType: "earn", OrderID: &order.ID}); err != nil {
+		t.Fatal(err)
+	}
+	return db, order
+}
+
+func TestCreateOrderReturn(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       string // Of the order
+		returned     int    // Units already on returns
+		items        string
+		wantStatus   int
+		wantAmount   models.Money
+		wantReturned int
+	}{
+		{name: "one unit", status: "delivered", items: `[{"line_item_id": 1, "quantity": 1}]`, wantStatus: 201, wantAmount: 5000, wantReturned: 1},
+		{name: "shipped order", status: "shipped", items: `[{"line_item_id": 1, "quantity": 2}]`, wantStatus: 201, wantAmount: 10000, wantReturned: 2},
+		{name: "last unit takes what is left", status: "delivered", returned: 1, items: `[{"line_item_id": 1, "quantity": 1}]`, wantStatus: 201, wantAmount: 5000, wantReturned: 2},
+		{name: "more than shipped", status: "delivered", items: `[{"line_item_id": 1, "quantity": 3}]`, wantStatus: 409},
+		{name: "already returned", status: "delivered", returned: 2, items: `[{"line_item_id": 1, "quantity": 1}]`, wantStatus: 409, wantReturned: 2},
+		{name: "line of another order", status: "delivered", items: `[{"line_item_id": 9, "quantity": 1}]`, wantStatus: 400},
+		{name: "order not shipped", status: "processing", items: `[{"line_item_id": 1, "quantity": 1}]`, wantStatus: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, order := createReturnOrder(t, models.DefaultCurrency)
+			if err := db.Model(&order).Update("status", tt.status).Error; err != nil {
+				t.Fatal(err)
+			}
+			if tt.returned > 0 {
+				sendRequest(t, CreateOrderReturn, "POST", "/orders/:id/returns", fmt.Sprintf("/orders/%d/returns", order.ID),
+					fmt.Sprintf(`{"reason": "Broken", "items": [{"line_item_id": 1, "quantity": %d}]}`, tt.returned))
+			}
+
+			status, body := sendRequest(t, CreateOrderReturn, "POST", "/orders/:id/returns", fmt.Sprintf("/orders/%d/returns", order.ID),
+				fmt.Sprintf(`{"reason": "Broken", "items": %s}`, tt.items))
+			if status != tt.wantStatus {
+				t.Fatalf("CreateOrderReturn returned %d, want %d: %v", status, tt.wantStatus, body)
+			}
+			if status == 201 {
+				if amount := body["data"].(map[string]interface{})["amount"]; amount != tt.wantAmount.Float() {
+					t.Errorf("return amount = %v, want %s", amount, tt.wantAmount)
+				}
+			}
+
+			var line models.LineItem
+			if err := db.First(&line, 1).Error; err != nil {
+				t.Fatal(err)
+			}
+			if line.Returned != tt.wantReturned {
+				t.Errorf("returned units = %d, want %d", line.Returned, tt.wantReturned)
+			}
+		})
+	}
+}
+
+func TestRefundReturn(t *testing.T) {
+	tests := []struct {
+		name        string
+		currency    string
+		method      string
+		wantStatus  int
+		wantBalance int // 10 earned, less 5 taken back for half the order, plus any points refund
+		wantRefund  models.Money
+	}{
+		{name: "money", currency: models.DefaultCurrency, method: "money", wantStatus: 200, wantBalance: 5, wantRefund: 5000},
+		{name: "points", currency: models.DefaultCurrency, method: "points", wantStatus: 200, wantBalance: 55, wantRefund: 5000},
+		{name: "points for an order in another currency", currency: "USD", method: "points", wantStatus: 400, wantBalance: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, order := createReturnOrder(t, tt.currency)
+
+			status, body := sendRequest(t, CreateOrderReturn, "POST", "/orders/:id/returns", fmt.Sprintf("/orders/%d/returns", order.ID),
+				`{"reason": "Broken", "items": [{"line_item_id": 1, "quantity": 1}]}`)
+			if status != 201 {
+				t.Fatalf("CreateOrderReturn returned %d: %v", status, body)
+			}
+			for _, step := range []struct {
+				action  string
+				handler fiber.Handler
+			}{
+				{"approve", ApproveReturn},
+				{"receive", ReceiveReturn},
+			} {
+				if status, body := sendRequest(t, step.handler, "POST", "/returns/:id/"+step.action, "/returns/1/"+step.action, ""); status != 200 {
+					t.Fatalf("%s returned %d: %v", step.action, status, body)
+				}
+			}
+
+			status, body = sendRequest(t, RefundReturn, "POST", "/returns/:id/refund", "/returns/1/refund",
+				fmt.Sprintf(`{"method": %q}`, tt.method))
+			if status != tt.wantStatus {
+				t.Fatalf("RefundReturn returned %d, want %d: %v", status, tt.wantStatus, body)
+			}
+
+			var ret models.OrderReturn
+			if err := db.First(&ret, 1).Error; err != nil {
+				t.Fatal(err)
+			}
+			if refunded := tt.wantStatus == 200; (ret.Status == "refunded") != refunded || (ret.CreditNoteID != nil) != refunded {
+				t.Errorf("return %s with credit note %v, want refunded = %v", ret.Status, ret.CreditNoteID, refunded)
+			}
+			if err := db.First(&order, order.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if order.RefundedTotal != tt.wantRefund {
+				t.Errorf("order refunded_total = %s, want %s", order.RefundedTotal, tt.wantRefund)
+			}
+			var product models.Product
+			if err := db.First(&product, 1).Error; err != nil {
+				t.Fatal(err)
+			}
+			if product.Stock != 6 {
+				t.Errorf("stock = %d, want the received pen back in stock", product.Stock)
+			}
+			var user models.User
+			if err := db.First(&user, 1).Error; err != nil {
+				t.Fatal(err)
+			}
+			if user.Balance != tt.wantBalance {
+				t.Errorf("user balance = %d, want %d", user.Balance, tt.wantBalance)
+			}
+		})
+	}
+}
+
+func TestRejectReturn(t *testing.T) {
+	db, order := createReturnOrder(t, models.DefaultCurrency)
+	path := fmt.Sprintf("/orders/%d/returns", order.ID)
+	body := `{"reason": "Changed my mind", "items": [{"line_item_id": 1, "quantity": 2}]}`
+
+	if status, resp := sendRequest(t, CreateOrderReturn, "POST", "/orders/:id/returns", path, body); status != 201 {
+		t.Fatalf("CreateOrderReturn returned %d: %v", status, resp)
+	}
+	if status, resp := sendRequest(t, RejectReturn, "POST", "/returns/:id/reject", "/returns/1/reject", `{"note": "Used"}`); status != 200 {
+		t.Fatalf("RejectReturn returned %d: %v", status, resp)
+	}
+	if status, resp := sendRequest(t, ReceiveReturn, "POST", "/returns/:id/receive", "/returns/1/receive", ""); status != 400 {
+		t.Errorf("receiving a rejected return returned %d, want 400: %v", status, resp)
+	}
+
+	// The rejected units can be returned again
+	if status, resp := sendRequest(t, CreateOrderReturn, "POST", "/orders/:id/returns", path, body); status != 201 {
+		t.Fatalf("returning rejected units returned %d: %v", status, resp)
+	}
+	var line models.LineItem
+	if err := db.First(&line, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if line.Returned != 2 {
+		t.Errorf("returned units = %d, want 2", line.Returned)
+	}
+}
@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// shipmentStatuses are the tracking statuses a shipment can report. A
+// delivered shipment stays delivered.
+var shipmentStatuses = map[string]bool{
+	"shipped":          true,
+	"in_transit":       true,
+	"out_for_delivery": true,
+	"delivered":        true,
+	"exception":        true,
+	"returned":         true,
+}
+
+// ShipmentRequest represents the request body for shipping order items
+type ShipmentRequest struct {
+	Carrier        string                `json:"carrier"`
+	TrackingNumber string                `json:"tracking_number"`
+	Items          []ShipmentItemRequest `json:"items"` // Empty ships everything not yet shipped
+	Actor          string                `json:"actor"`
+}
+
+// ShipmentItemRequest is a quantity of a line item to pack in a shipment
+type ShipmentItemRequest struct {
+	LineItemID uint `json:"line_item_id"`
+	Quantity   int  `json:"quantity"`
+}
+
+// CarrierEventRequest represents a tracking update pushed by a carrier
+type CarrierEventRequest struct {
+	Carrier        string     `json:"carrier"`
+	TrackingNumber string     `json:"tracking_number"`
+	Status         string     `json:"status"`
+	OccurredAt     *time.Time `json:"occurred_at"` // Defaults to now
+	Location       string     `json:"location"`
+	Description    string     `json:"description"`
+}
+
+// GetOrderShipments returns the shipments of an order with their items and
+// tracking events
+func GetOrderShipments(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var order models.Order
+
+	if err := database.DB.First(&order, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Order not found",
+		})
+	}
+
+	var shipments []models.Shipment
+	if err := preloadShipment(database.DB).
+		Where("order_id = ?", order.ID).Order("id ASC").Find(&shipments).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch shipments",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    shipments,
+	})
+}
+
+// CreateOrderShipment ships some or all of the remaining items of a
+// confirmed order. Once every item has shipped the order moves to shipped.
+func CreateOrderShipment(c *fiber.Ctx) error {
+	id := c.Params("id")
+	req := new(ShipmentRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	carrier := normalizeCarrier(req.Carrier)
+	tracking := normalizeTrackingNumber(req.TrackingNumber)
+	if carrier == "" || tracking == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "carrier and tracking_number are required",
+		})
+	}
+
+	var shipment models.Shipment
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.First(&order, id).Error; err != nil {
+			return newRequestError(404, "Order not found")
+		}
+		if order.Status != "processing" {
+			return newRequestError(400, fmt.Sprintf("Cannot ship order with status: %s", order.Status))
+		}
+
+		var clash int64
+		if err := tx.Model(&models.Shipment{}).
+			Where("carrier = ? AND tracking_number = ?", carrier, tracking).
+			Count(&clash).Error; err != nil {
+			return err
+		}
+		if clash > 0 {
+			return newRequestError(409, fmt.Sprintf("Tracking number %s of %s is already in use", tracking, carrier))
+		}
+
+		items, err := shipmentItems(tx, &order, req.Items)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := claimShippedQuantity(tx, item.LineItemID, item.Quantity); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		shipment = models.Shipment{
+			OrderID:        order.ID,
+			Carrier:        carrier,
+			TrackingNumber: tracking,
+			Status:         "shipped",
+			StatusAt:       now,
+			ShippedAt:      now,
+			Items:          items,
+			Events:         []models.ShipmentEvent{{Status: "shipped", OccurredAt: now}},
+		}
+		if err := tx.Create(&shipment).Error; err != nil {
+			return err
+		}
+
+		var unshipped int64
+		if err := tx.Model(&models.LineItem{}).
+			Where("order_id = ? AND shipped_quantity < quantity", order.ID).
+			Count(&unshipped).Error; err != nil {
+			return err
+		}
+		if unshipped > 0 {
+			return nil
+		}
+		return transitionOrder(tx, &order, "shipped", req.Actor, "All items shipped")
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to create shipment")
+	}
+
+	preloadShipment(database.DB).First(&shipment, shipment.ID)
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    shipment,
+	})
+}
+
+// IngestShipmentEvent records a tracking update pushed by a carrier. The
+// shipment takes the status of its latest update, and the order moves to
+// delivered once all of its items have shipped and every shipment is
+// delivered. Updates a carrier resends are accepted and ignored.
+func IngestShipmentEvent(c *fiber.Ctx) error {
+	req := new(CarrierEventRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	carrier := normalizeCarrier(req.Carrier)
+	tracking := normalizeTrackingNumber(req.TrackingNumber)
+	status := strings.ToLower(strings.TrimSpace(req.Status))
+	if carrier == "" || tracking == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "carrier and tracking_number are required",
+		})
+	}
+	if !shipmentStatuses[status] {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Unknown shipment status: " + req.Status,
+		})
+	}
+
+	occurredAt := time.Now().UTC()
+	if req.OccurredAt != nil {
+		occurredAt = req.OccurredAt.UTC()
+	}
+
+	var shipment models.Shipment
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("carrier = ? AND tracking_number = ?", carrier, tracking).
+			First(&shipment).Error; err != nil {
+			return newRequestError(404, "Shipment not found")
+		}
+
+		var seen int64
+		if err := tx.Model(&models.ShipmentEvent{}).
+			Where("shipment_id = ? AND status = ? AND occurred_at = ?", shipment.ID, status, occurredAt).
+			Count(&seen).Error; err != nil {
+			return err
+		}
+		if seen > 0 {
+			return nil
+		}
+
+		if err := tx.Create(&models.ShipmentEvent{
+			ShipmentID:  shipment.ID,
+			Status:      status,
+			OccurredAt:  occurredAt,
+			Location:    req.Location,
+			Description: req.Description,
+		}).Error; err != nil {
+			return err
+		}
+
+		// Updates can arrive out of order; an older one only adds history
+		if shipment.Status == "delivered" || occurredAt.Before(shipment.StatusAt) {
+			return nil
+		}
+		updates := map[string]interface{}{
+			"status":    status,
+			"status_at": occurredAt,
+		}
+		if status == "delivered" {
+			updates["delivered_at"] = occurredAt
+		}
+		if err := tx.Model(&shipment).Updates(updates).Error; err != nil {
+			return err
+		}
+		if status != "delivered" {
+			return nil
+		}
+
+		return deliverShippedOrder(tx, shipment.OrderID, carrier)
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to record shipment event")
+	}
+
+	preloadShipment(database.DB).First(&shipment, shipment.ID)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    shipment,
+	})
+}
+
+// shipmentItems works out what a new shipment of order contains. Without
+// requested items it takes everything that has not shipped yet.
+func shipmentItems(tx *gorm.DB, order *models.Order, requested []ShipmentItemRequest) ([]models.ShipmentItem, error) {
+	var lineItems []models.LineItem
+	if err := tx.Where("order_id = ?", order.ID).Order("id ASC").Find(&lineItems).Error; err != nil {
+		return nil, err
+	}
+
+	var items []models.ShipmentItem
+	if len(requested) == 0 {
+		for _, line := range lineItems {
+			if line.Shipped < line.Quantity {
+				items = append(items, models.ShipmentItem{LineItemID: line.ID, Quantity: line.Quantity - line.Shipped})
+			}
+		}
+		// Orders without line items ship as a whole
+		if len(items) == 0 && len(lineItems) > 0 {
+			return nil, newRequestError(400, "All items of the order have already shipped")
+		}
+		return items, nil
+	}
+
+	onOrder := make(map[uint]bool, len(lineItems))
+	for _, line := range lineItems {
+		onOrder[line.ID] = true
+	}
+	seen := make(map[uint]bool, len(requested))
+	for _, r := range requested {
+		if !onOrder[r.LineItemID] {
+			return nil, newRequestError(400, fmt.Sprintf("Line item %d is not on this order", r.LineItemID))
+		}
+		if seen[r.LineItemID] {
+			return nil, newRequestError(400, fmt.Sprintf("Line item %d is listed more than once", r.LineItemID))
+		}
+		if r.Quantity <= 0 {
+			return nil, newRequestError(400, "quantity must be greater than 0")
+		}
+		seen[r.LineItemID] = true
+		items = append(items, models.ShipmentItem{LineItemID: r.LineItemID, Quantity: r.Quantity})
+	}
+	return items, nil
+}
+
+// claimShippedQuantity adds quantity to the shipped units of a line item.
+// The conditional update keeps concurrent shipments from shipping more
+// units than were ordered.
+func claimShippedQuantity(tx *gorm.DB, lineItemID uint, quantity int) error {
+	result := tx.Model(&models.LineItem{}).
+		Where("id = ? AND shipped_quantity + ? <= quantity", lineItemID, quantity).
+		Update("shipped_quantity", gorm.Expr("shipped_quantity + ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	var item models.LineItem
+	if err := tx.First(&item, lineItemID).Error; err != nil {
+		return err
+	}
+	return newRequestError(409, fmt.Sprintf("Only %d of line item %d left to ship, %d requested",
+		item.Quantity-item.Shipped, lineItemID, quantity))
+}
+
+// deliverShippedOrder moves a shipped order to delivered once every one of
+// its shipments has been delivered
+func deliverShippedOrder(tx *gorm.DB, orderID uint, carrier string) error {
+	var order models.Order
+	if err := tx.First(&order, orderID).Error; err != nil {
+		return err
+	}
+	if order.Status != "shipped" {
+		return nil
+	}
+
+	var undelivered int64
+	if err := tx.Model(&models.Shipment{}).
+		Where("order_id = ? AND status <> ?", order.ID, "delivered").
+		Count(&undelivered).Error; err != nil {
+		return err
+	}
+	if undelivered > 0 {
+		return nil
+	}
+	return transitionOrder(tx, &order, "delivered", "carrier:"+carrier, "All shipments delivered")
+}
+
+// preloadShipment loads a shipment's items and its events in the order they
+// happened
+func preloadShipment(tx *gorm.DB) *gorm.DB {
+	return tx.Preload("Items").Preload("Events", func(db *gorm.DB) *gorm.DB {
+		return db.Order("occurred_at ASC, id ASC")
+	})
+}
+
+// normalizeCarrier returns the carrier code shipments are stored under
+func normalizeCarrier(carrier string) string {
+	return strings.ToLower(strings.TrimSpace(carrier))
+}
+
+// normalizeTrackingNumber returns the tracking number shipments are stored under
+func normalizeTrackingNumber(number string) string {
+	return strings.ToUpper(strings.TrimSpace(number))
+}
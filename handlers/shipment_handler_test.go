@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"fmt"
+	"temp_kbtg_backend/models"
+	"testing"
+	"time"
+)
+
+func TestCreateOrderShipment(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      string // Of the order
+		body        string
+		wantStatus  int
+		wantOrder   string
+		wantShipped [2]int // Shipped units of the pen and mug lines
+	}{
+		{
+			name:        "everything left",
+			status:      "processing",
+			body:        `{"carrier": " Kerry ", "tracking_number": "th1"}`,
+			wantStatus:  201,
+			wantOrder:   "shipped",
+			wantShipped: [2]int{3, 1},
+		},
+		{
+			name:        "some items",
+			status:      "processing",
+			body:        `{"carrier": "kerry", "tracking_number": "TH1", "items": [{"line_item_id": 1, "quantity": 2}]}`,
+			wantStatus:  201,
+			wantOrder:   "processing",
+			wantShipped: [2]int{2, 0},
+		},
+		{
+			name:       "more than ordered",
+			status:     "processing",
+			body:       `{"carrier": "kerry", "tracking_number": "TH1", "items": [{"line_item_id": 1, "quantity": 4}]}`,
+			wantStatus: 409,
+			wantOrder:  "processing",
+		},
+		{
+			name:       "item of another order",
+			status:     "processing",
+			body:       `{"carrier": "kerry", "tracking_number": "TH1", "items": [{"line_item_id": 99, "quantity": 1}]}`,
+			wantStatus: 400,
+			wantOrder:  "processing",
+		},
+		{
+			name:       "tracking number in use",
+			status:     "processing",
+			body:       `{"carrier": "kerry", "tracking_number": "TH0"}`,
+			wantStatus: 409,
+			wantOrder:  "processing",
+		},
+		{
+			name:       "order not confirmed",
+			status:     "pending",
+			body:       `{"carrier": "kerry", "tracking_number": "TH1"}`,
+			wantStatus: 400,
+			wantOrder:  "pending",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t)
+			order := models.Order{CustomerID: 1, OrderDate: time.Now().UTC(), Status: tt.status, Currency: models.DefaultCurrency}
+			createRecords(t, db, &order)
+			createRecords(t, db,
+				&models.LineItem{OrderID: order.ID, SKU: "PEN", ProductName: "Pen", Quantity: 3, UnitPrice: 2000, TotalPrice: 6000},
+				&models.LineItem{OrderID: order.ID, SKU: "MUG", ProductName: "Mug", Quantity: 1, UnitPrice: 5000, TotalPrice: 5000},
+				&models.Shipment{OrderID: 99, Carrier: "kerry", TrackingNumber: "TH0", Status: "shipped", StatusAt: time.Now(), ShippedAt: time.Now()})
+
+			status, body := sendRequest(t, CreateOrderShipment, "POST", "/orders/:id/shipments",
+				fmt.Sprintf("/orders/%d/shipments", order.ID), tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("CreateOrderShipment returned %d, want %d: %v", status, tt.wantStatus, body)
+			}
+
+			if err := db.First(&order, order.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if order.Status != tt.wantOrder {
+				t.Errorf("order status = %s, want %s", order.Status, tt.wantOrder)
+			}
+			var items []models.LineItem
+			if err := db.Where("order_id = ?", order.ID).Order("id ASC").Find(&items).Error; err != nil {
+				t.Fatal(err)
+			}
+			if shipped := [2]int{items[0].Shipped, items[1].Shipped}; shipped != tt.wantShipped {
+				t.Errorf("shipped units = %v, want %v", shipped, tt.wantShipped)
+			}
+		})
+	}
+}
+
+func TestIngestShipmentEvent(t *testing.T) {
+	shippedAt := time.Date(2025, 10, 1, 9, 0, 0, 0, time.UTC)
+	event := func(tracking, status string, hours int) string {
+		return fmt.Sprintf(`{"carrier": "KERRY", "tracking_number": %q, "status": %q, "occurred_at": %q}`,
+			tracking, status, shippedAt.Add(time.Duration(hours)*time.Hour).Format(time.RFC3339))
+	}
+
+	tests := []struct {
+		name         string
+		events       []string
+		wantStatus   int // Of the last event
+		wantShipment string
+		wantEvents   int
+		wantOrder    string
+	}{
+		{
+			name:         "delivering every parcel delivers the order",
+			events:       []string{event("TH1", "in_transit", 2), event("TH1", "delivered", 5), event("TH2", "delivered", 6)},
+			wantStatus:   200,
+			wantShipment: "delivered",
+			wantEvents:   3,
+			wantOrder:    "delivered",
+		},
+		{
+			name:         "order waits for its other parcel",
+			events:       []string{event("TH1", "delivered", 5)},
+			wantStatus:   200,
+			wantShipment: "delivered",
+			wantEvents:   2,
+			wantOrder:    "shipped",
+		},
+		{
+			name:         "late update only adds history",
+			events:       []string{event("TH1", "out_for_delivery", 4), event("TH1", "in_transit", 2)},
+			wantStatus:   200,
+			wantShipment: "out_for_delivery",
+			wantEvents:   3,
+			wantOrder:    "shipped",
+		},
+		{
+			name:         "delivered shipment stays delivered",
+			events:       []string{event("TH1", "delivered", 5), event("TH1", "returned", 8)},
+			wantStatus:   200,
+			wantShipment: "delivered",
+			wantEvents:   3,
+			wantOrder:    "shipped",
+		},
+		{
+			name:         "resent update is recorded once",
+			events:       []string{event("TH1", "in_transit", 2), event("TH1", "in_transit", 2)},
+			wantStatus:   200,
+			wantShipment: "in_transit",
+			wantEvents:   2,
+			wantOrder:    "shipped",
+		},
+		{
+			name:         "unknown tracking number",
+			events:       []string{event("TH9", "delivered", 5)},
+			wantStatus:   404,
+			wantShipment: "shipped",
+			wantEvents:   1,
+			wantOrder:    "shipped",
+		},
+		{
+			name:         "unknown status",
+			events:       []string{event("TH1", "lost", 5)},
+			wantStatus:   400,
+			wantShipment: "shipped",
+			wantEvents:   1,
+			wantOrder:    "shipped",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t)
+			order := models.Order{CustomerID: 1, OrderDate: shippedAt, Status: "shipped", Currency: models.DefaultCurrency}
+			createRecords(t, db, &order)
+			shipment := models.Shipment{OrderID: order.ID, Carrier: "kerry", TrackingNumber: "TH1", Status: "shipped", StatusAt: shippedAt, ShippedAt: shippedAt,
+				Events: []models.ShipmentEvent{{Status: "shipped", OccurredAt: shippedAt}}}
+			createRecords(t, db, &shipment,
+				&models.Shipment{OrderID: order.ID, Carrier: "kerry", TrackingNumber: "TH2", Status: "shipped", StatusAt: shippedAt, ShippedAt: shippedAt})
+
+			var status int
+			var body map[string]interface{}
+			for _, e := range tt.events {
+				status, body = sendRequest(t, IngestShipmentEvent, "POST", "/shipments/events", "/shipments/events", e)
+			}
+			if status != tt.wantStatus {
+				t.Fatalf("IngestShipmentEvent returned %d, want %d: %v", status, tt.wantStatus, body)
+			}
+
+			if err := preloadShipment(db).First(&shipment, shipment.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if shipment.Status != tt.wantShipment || len(shipment.Events) != tt.wantEvents {
+				t.Errorf("shipment %s with %d events, want %s with %d", shipment.Status, len(shipment.Events), tt.wantShipment, tt.wantEvents)
+			}
+			if err := db.First(&order, order.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if order.Status != tt.wantOrder {
+				t.Errorf("order status = %s, want %s", order.Status, tt.wantOrder)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"fmt"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"gorm.io/gorm"
+)
+
+// CreateSplitRequest represents the request body for creating a split bill
+type CreateSplitRequest struct {
+	PayerUserID  uint                      `json:"payer_user_id"`
+	TotalAmount  int                       `json:"total_amount"`
+	Mode         string                    `json:"mode"` // "equal" or "custom"
+	Note         string                    `json:"note"`
+	Participants []SplitParticipantRequest `json:"participants"`
+}
+
+// SplitParticipantRequest is one participant of a split bill. Amount is only
+// used in custom mode.
+type SplitParticipantRequest struct {
+	UserID uint `json:"user_id"`
+	Amount int  `json:"amount"`
+}
+
+// PaySplitRequest represents the request body for paying a split bill share
+type PaySplitRequest struct {
+	UserID uint `json:"user_id"`
+}
+
+// GetSplit returns a split bill with per-participant status
+func GetSplit(c *fiber.Ctx) error {
+	splitID := c.Params("id")
+
+	split, err := findSplit(database.DB, splitID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Split bill not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    split,
+	})
+}
+
+// CreateSplit splits a payer's cost between several users
+func CreateSplit(c *fiber.Ctx) error {
+	req := new(CreateSplitRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Mode == "" {
+		req.Mode = "equal"
+	}
+	if req.PayerUserID == 0 || len(req.Participants) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "payer_user_id and participants are required",
+		})
+	}
+	if req.Mode != "equal" && req.Mode != "custom" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "mode must be either equal or custom",
+		})
+	}
+
+	shares, total, err := splitShares(req)
+	if err != nil {
+		return sendError(c, err, "Failed to create split bill")
+	}
+
+	var split models.SplitBill
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&models.User{}, req.PayerUserID).Error; err != nil {
+			return newRequestError(404, "Payer not found")
+		}
+
+		now := time.Now()
+		split = models.SplitBill{
+			SplitID:     utils.UUIDv4(),
+			PayerUserID: req.PayerUserID,
+			TotalAmount: total,
+			Mode:        req.Mode,
+			Note:        req.Note,
+			Status:      "open",
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if err := tx.Create(&split).Error; err != nil {
+			return err
+		}
+
+		for i, p := range req.Participants {
+			if err := tx.First(&models.User{}, p.UserID).Error; err != nil {
+				return newRequestError(404, fmt.Sprintf("Participant %d not found", p.UserID))
+			}
+
+			participant := models.SplitParticipant{
+				SplitBillID: split.ID,
+				UserID:      p.UserID,
+				Amount:      shares[i],
+				Status:      "pending",
+			}
+			// The payer's own share needs no transfer
+			if p.UserID == req.PayerUserID {
+				participant.Status = "paid"
+				participant.PaidAt = &now
+			}
+			if err := tx.Create(&participant).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to create split bill")
+	}
+
+	created, err := findSplit(database.DB, split.SplitID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to load split bill",
+		})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    created,
+	})
+}
+
+// PaySplit settles one participant's share by transferring it to the payer
+func PaySplit(c *fiber.Ctx) error {
+	splitID := c.Params("id")
+	req := new(PaySplitRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.UserID == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "user_id is required",
+		})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var split models.SplitBill
+		if err := tx.Where("split_id = ?", splitID).First(&split).Error; err != nil {
+			return newRequestError(404, "Split bill not found")
+		}
+
+		var participant models.SplitParticipant
+		if err := tx.Where("split_bill_id = ? AND user_id = ?", split.ID, req.UserID).First(&participant).Error; err != nil {
+			return newRequestError(404, "User is not a participant of this split bill")
+		}
+		if participant.Status == "paid" {
+			return newRequestError(400, "Share has already been paid")
+		}
+
+		transfer, err := executeTransfer(tx, &CreateTransferRequest{
+			FromUserID:     participant.UserID,
+			ToUserID:       split.PayerUserID,
+			Amount:         participant.Amount,
+			Note:           fmt.Sprintf("Split bill %s", split.SplitID),
+			IdempotencyKey: fmt.Sprintf("split-%s-%d", split.SplitID, participant.UserID),
+		})
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		result := tx.Model(&models.SplitParticipant{}).
+			Where("id = ? AND status = ?", participant.ID, "pending").
+			Updates(map[string]interface{}{
+				"status":      "paid",
+				"transfer_id": transfer.ID,
+				"paid_at":     now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return newRequestError(400, "Share has already been paid")
+		}
+
+		// Settle the split once every share is paid
+		var pending int64
+		if err := tx.Model(&models.SplitParticipant{}).
+			Where("split_bill_id = ? AND status = ?", split.ID, "pending").
+			Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending == 0 {
+			return tx.Model(&split).Updates(map[string]interface{}{
+				"status":     "settled",
+				"settled_at": now,
+				"updated_at": now,
+			}).Error
+		}
+		return tx.Model(&split).Update("updated_at", now).Error
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to pay split bill share")
+	}
+
+	split, err := findSplit(database.DB, splitID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to load split bill",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    split,
+	})
+}
+
+// splitShares works out each participant's share and the bill total.
+// Equal splits hand the remainder out one point at a time from the first
+// participant so the shares always add up to the total.
+func splitShares(req *CreateSplitRequest) ([]int, int, error) {
+	seen := make(map[uint]bool)
+	othersOwe := false
+	for _, p := range req.Participants {
+		if p.UserID == 0 {
+			return nil, 0, newRequestError(400, "Each participant needs a user_id")
+		}
+		if seen[p.UserID] {
+			return nil, 0, newRequestError(400, "Participants must be unique")
+		}
+		seen[p.UserID] = true
+		if p.UserID != req.PayerUserID {
+			othersOwe = true
+		}
+	}
+	if !othersOwe {
+		return nil, 0, newRequestError(400, "At least one participant other than the payer is required")
+	}
+
+	shares := make([]int, len(req.Participants))
+
+	if req.Mode == "equal" {
+		count := len(req.Participants)
+		if req.TotalAmount < count {
+			return nil, 0, newRequestError(400, "total_amount must be at least one point per participant")
+		}
+		for i := range shares {
+			shares[i] = req.TotalAmount / count
+			if i < req.TotalAmount%count {
+				shares[i]++
+			}
+		}
+		return shares, req.TotalAmount, nil
+	}
+
+	total := 0
+	for i, p := range req.Participants {
+		if p.Amount <= 0 {
+			return nil, 0, newRequestError(400, "Each participant amount must be greater than 0")
+		}
+		shares[i] = p.Amount
+		total += p.Amount
+	}
+	if req.TotalAmount != 0 && req.TotalAmount != total {
+		return nil, 0, newRequestError(400, "Participant amounts must add up to total_amount")
+	}
+
+	return shares, total, nil
+}
+
+// findSplit loads a split bill with its participants and progress summary
+func findSplit(db *gorm.DB, splitID string) (*models.SplitBill, error) {
+	var split models.SplitBill
+	if err := db.Preload("Payer").Preload("Participants.User").
+		Where("split_id = ?", splitID).
+		First(&split).Error; err != nil {
+		return nil, err
+	}
+
+	split.ParticipantCount = len(split.Participants)
+	for _, p := range split.Participants {
+		if p.Status == "paid" {
+			split.PaidCount++
+		}
+	}
+
+	return &split, nil
+}
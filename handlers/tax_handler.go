@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// defaultTaxCountry is the country taxed when an order has no shipping address
+const defaultTaxCountry = "TH"
+
+// TaxRuleRequest represents the request body for creating or updating a tax rule
+type TaxRuleRequest struct {
+	Country          string  `json:"country"`
+	Name             string  `json:"name"`
+	Rate             float64 `json:"rate"`
+	PricesIncludeTax bool    `json:"prices_include_tax"`
+	Active           *bool   `json:"active"`
+}
+
+// lineTax is the tax breakdown of one line item
+type lineTax struct {
+	ID       uint
+	Discount models.Money
+	Net      models.Money
+	Tax      models.Money
+}
+
+// GetTaxRules returns all tax rules
+func GetTaxRules(c *fiber.Ctx) error {
+	var rules []models.TaxRule
+
+	if err := database.DB.Order("country ASC").Find(&rules).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch tax rules",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    rules,
+	})
+}
+
+// CreateTaxRule creates the tax rule of a country
+func CreateTaxRule(c *fiber.Ctx) error {
+	req := new(TaxRuleRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	rule := models.TaxRule{Active: true}
+	if err := saveTaxRule(&rule, req); err != nil {
+		return sendError(c, err, "Failed to create tax rule")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    rule,
+	})
+}
+
+// UpdateTaxRule updates a tax rule. Open orders pick up the change the next
+// time their totals are recalculated.
+func UpdateTaxRule(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var rule models.TaxRule
+
+	if err := database.DB.First(&rule, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Tax rule not found",
+		})
+	}
+
+	req := new(TaxRuleRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := saveTaxRule(&rule, req); err != nil {
+		return sendError(c, err, "Failed to update tax rule")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    rule,
+	})
+}
+
+// DeleteTaxRule deletes a tax rule; orders to its country are then untaxed
+func DeleteTaxRule(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var rule models.TaxRule
+
+	if err := database.DB.First(&rule, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Tax rule not found",
+		})
+	}
+
+	if err := database.DB.Delete(&rule).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to delete tax rule",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Tax rule deleted successfully",
+	})
+}
+
+// saveTaxRule validates req, copies it onto rule and stores it
+func saveTaxRule(rule *models.TaxRule, req *TaxRuleRequest) error {
+	country := countryCode(req.Country)
+	if len(country) != 2 || req.Name == "" {
+		return newRequestError(400, "country must be an ISO 3166-1 alpha-2 code and name is required")
+	}
+	if req.Rate < 0 || req.Rate >= 100 {
+		return newRequestError(400, "rate must be between 0 and 100")
+	}
+
+	rule.Country = country
+	rule.Name = req.Name
+	rule.Rate = req.Rate
+	rule.PricesIncludeTax = req.PricesIncludeTax
+	if req.Active != nil {
+		rule.Active = *req.Active
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var clash int64
+		if err := tx.Model(&models.TaxRule{}).
+			Where("country = ? AND id <> ?", rule.Country, rule.ID).
+			Count(&clash).Error; err != nil {
+			return err
+		}
+		if clash > 0 {
+			return newRequestError(409, fmt.Sprintf("A tax rule for %s already exists", rule.Country))
+		}
+		return tx.Save(rule).Error
+	})
+}
+
+// orderTaxRule returns the tax rule of the country the order ships to.
+// Orders without a shipping address are taxed as domestic; countries
+// without an active rule are untaxed.
+func orderTaxRule(tx *gorm.DB, order *models.Order) (*models.TaxRule, error) {
+	country := countryCode(order.ShippingAddress.Country)
+	if country == "" {
+		country = defaultTaxCountry
+	}
+
+	var rule models.TaxRule
+	err := tx.Where("country = ? AND active = ?", strings.ToUpper(country), true).First(&rule).Error
+	if err == gorm.ErrRecordNotFound {
+		return &models.TaxRule{Country: country}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// taxLines works out the tax of every line item. Each line is taxed on its
+// total less its own discounts and its share of the order discounts, which
+// are spread over the lines in proportion to what is left of them; the last
+// line takes the rounding remainder so the shares add up exactly.
+func taxLines(items []models.LineItem, discounts []models.OrderDiscount, rule *models.TaxRule) []lineTax {
+	lines := make([]lineTax, len(items))
+	index := make(map[uint]int, len(items))
+	for i, item := range items {
+		lines[i].ID = item.ID
+		index[item.ID] = i
+	}
+
+	var orderDiscount models.Money
+	for _, d := range discounts {
+		if d.LineItemID == nil {
+			orderDiscount += d.Amount
+		} else if i, ok := index[*d.LineItemID]; ok {
+			lines[i].Discount += d.Amount
+		}
+	}
+
+	var remaining models.Money
+	for i, item := range items {
+		remaining += item.TotalPrice - lines[i].Discount
+	}
+	allocated := models.Money(0)
+	for i, item := range items {
+		share := orderDiscount.Share(item.TotalPrice-lines[i].Discount, remaining)
+		if i == len(items)-1 {
+			share = orderDiscount - allocated
+		}
+		allocated += share
+		lines[i].Discount += share
+
+		base := item.TotalPrice - lines[i].Discount
+		if rule.PricesIncludeTax {
+			lines[i].Tax = base.TaxIncluded(rule.Rate)
+			lines[i].Net = base - lines[i].Tax
+		} else {
+			lines[i].Tax = base.Percent(rule.Rate)
+			lines[i].Net = base
+		}
+	}
+	return lines
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"reflect"
+	"temp_kbtg_backend/models"
+	"testing"
+)
+
+func TestTaxLines(t *testing.T) {
+	lineID := uint(2)
+	items := []models.LineItem{
+		{ID: 1, TotalPrice: 10000},
+		{ID: 2, TotalPrice: 20000},
+	}
+	vatIncluded := &models.TaxRule{Rate: 7, PricesIncludeTax: true}
+	vatExcluded := &models.TaxRule{Rate: 7}
+
+	tests := []struct {
+		name      string
+		items     []models.LineItem
+		discounts []models.OrderDiscount
+		rule      *models.TaxRule
+		want      []lineTax
+	}{
+		{
+			name:  "prices include tax",
+			items: items,
+			rule:  vatIncluded,
+			want: []lineTax{
+				{ID: 1, Net: 9346, Tax: 654},
+				{ID: 2, Net: 18692, Tax: 1308},
+			},
+		},
+		{
+			name:  "tax added to prices",
+			items: items,
+			rule:  vatExcluded,
+			want: []lineTax{
+				{ID: 1, Net: 10000, Tax: 700},
+				{ID: 2, Net: 20000, Tax: 1400},
+			},
+		},
+		{
+			name:  "untaxed country",
+			items: items,
+			rule:  &models.TaxRule{Country: "US"},
+			want: []lineTax{
+				{ID: 1, Net: 10000},
+				{ID: 2, Net: 20000},
+			},
+		},
+		{
+			name:      "line discount stays on its line",
+			items:     items,
+			discounts: []models.OrderDiscount{{LineItemID: &lineID, Amount: 5000}},
+			rule:      vatExcluded,
+			want: []lineTax{
+				{ID: 1, Net: 10000, Tax: 700},
+				{ID: 2, Discount: 5000, Net: 15000, Tax: 1050},
+			},
+		},
+		{
+			name:      "order discount spread by what is left of each line",
+			items:     items,
+			discounts: []models.OrderDiscount{{LineItemID: &lineID, Amount: 10000}, {Amount: 1000}},
+			rule:      vatExcluded,
+			want: []lineTax{
+				{ID: 1, Discount: 500, Net: 9500, Tax: 665},
+				{ID: 2, Discount: 10500, Net: 9500, Tax: 665},
+			},
+		},
+		{
+			name: "last line takes the rounding remainder",
+			items: []models.LineItem{
+				{ID: 1, TotalPrice: 100},
+				{ID: 2, TotalPrice: 100},
+				{ID: 3, TotalPrice: 100},
+			},
+			discounts: []models.OrderDiscount{{Amount: 100}},
+			rule:      vatExcluded,
+			want: []lineTax{
+				{ID: 1, Discount: 33, Net: 67, Tax: 5},
+				{ID: 2, Discount: 33, Net: 67, Tax: 5},
+				{ID: 3, Discount: 34, Net: 66, Tax: 5},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := taxLines(tt.items, tt.discounts, tt.rule)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("taxLines() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
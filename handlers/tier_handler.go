@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// tierWindow is how far back points and orders count towards a tier
+const tierWindow = 12 // months
+
+// tierStats is a user's qualifying activity over the tier window
+type tierStats struct {
+	PointsEarned int `json:"points_earned"`
+	OrderCount   int `json:"order_count"`
+}
+
+// GetTiers returns all tiers from lowest to highest rank
+func GetTiers(c *fiber.Ctx) error {
+	var tiers []models.Tier
+
+	if err := database.DB.Order("rank ASC").Find(&tiers).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch tiers",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    tiers,
+	})
+}
+
+// UpdateTier updates a tier's thresholds and benefits. The code cannot be
+// changed; users move between tiers on the next recompute.
+func UpdateTier(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var tier models.Tier
+
+	if err := database.DB.First(&tier, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Tier not found",
+		})
+	}
+
+	code := tier.Code
+	if err := c.BodyParser(&tier); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	tier.Code = code
+
+	if tier.Name == "" || tier.MinPointsEarned < 0 || tier.MinOrders < 0 ||
+		tier.EarnMultiplier < 0 || tier.DailyTransferLimit < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Name is required and thresholds, multiplier and limit cannot be negative",
+		})
+	}
+
+	var clash int64
+	database.DB.Model(&models.Tier{}).Where("rank = ? AND id <> ?", tier.Rank, tier.ID).Count(&clash)
+	if clash > 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Another tier already has this rank",
+		})
+	}
+
+	if err := database.DB.Save(&tier).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to update tier",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    tier,
+	})
+}
+
+// GetUserTier returns a user's current tier, their qualifying activity, the
+// next tier up and their tier history
+func GetUserTier(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var user models.User
+
+	if err := database.DB.First(&user, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	var tier *models.Tier
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		tier, err = userTier(tx, &user)
+		return err
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch tier",
+		})
+	}
+
+	stats, err := userTierStats(database.DB, user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch tier",
+		})
+	}
+
+	var next *models.Tier
+	if tier != nil {
+		var candidate models.Tier
+		if err := database.DB.Where("rank > ?", tier.Rank).Order("rank ASC").First(&candidate).Error; err == nil {
+			next = &candidate
+		}
+	}
+
+	var history []models.UserTierHistory
+	database.DB.Where("user_id = ?", user.ID).Order("changed_at DESC").Find(&history)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"user_id":    user.ID,
+			"tier":       tier,
+			"qualifying": stats,
+			"next_tier":  next,
+			"history":    history,
+		},
+	})
+}
+
+// RecomputeTiers re-evaluates every user's tier. Run periodically so users
+// move down as old activity leaves the rolling window.
+func RecomputeTiers() {
+	var users []models.User
+
+	result := database.DB.FindInBatches(&users, 100, func(batch *gorm.DB, _ int) error {
+		for i := range users {
+			user := users[i]
+			err := database.DB.Transaction(func(tx *gorm.DB) error {
+				_, err := recomputeUserTier(tx, &user)
+				return err
+			})
+			if err != nil {
+				log.Printf("Failed to recompute tier for user %d: %v", user.ID, err)
+			}
+		}
+		return nil
+	})
+	if result.Error != nil {
+		log.Printf("Failed to recompute tiers: %v", result.Error)
+	}
+}
+
+// userTier returns the user's stored tier, assigning one first if the user
+// has not been through a recompute yet. Returns nil if no tiers exist.
+func userTier(tx *gorm.DB, user *models.User) (*models.Tier, error) {
+	if user.TierCode == "" {
+		return recomputeUserTier(tx, user)
+	}
+
+	var tier models.Tier
+	if err := tx.Where("code = ?", user.TierCode).First(&tier).Error; err != nil {
+		return recomputeUserTier(tx, user)
+	}
+	return &tier, nil
+}
+
+// recomputeUserTier assigns the highest tier the user qualifies for and
+// records the change in the tier history
+func recomputeUserTier(tx *gorm.DB, user *models.User) (*models.Tier, error) {
+	var tiers []models.Tier
+	if err := tx.Order("rank DESC").Find(&tiers).Error; err != nil {
+		return nil, err
+	}
+
+	stats, err := userTierStats(tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var tier *models.Tier
+	for i := range tiers {
+		if qualifiesForTier(&tiers[i], stats) {
+			tier = &tiers[i]
+			break
+		}
+	}
+	if tier == nil {
+		return nil, nil
+	}
+	if tier.Code == user.TierCode {
+		return tier, nil
+	}
+
+	result := tx.Model(&models.User{}).
+		Where("id = ? AND COALESCE(tier_code, '') = ?", user.ID, user.TierCode).
+		Update("tier_code", tier.Code)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Changed concurrently; keep whatever the other writer assigned
+		return tier, nil
+	}
+
+	if err := tx.Create(&models.UserTierHistory{
+		UserID:       user.ID,
+		FromTier:     user.TierCode,
+		ToTier:       tier.Code,
+		PointsEarned: stats.PointsEarned,
+		OrderCount:   stats.OrderCount,
+		ChangedAt:    time.Now(),
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	user.TierCode = tier.Code
+	return tier, nil
+}
+
+// qualifiesForTier reports whether stats meet either of the tier's
+// thresholds. A tier without thresholds is the entry tier everyone holds.
+func qualifiesForTier(tier *models.Tier, stats tierStats) bool {
+	if tier.MinPointsEarned == 0 && tier.MinOrders == 0 {
+		return true
+	}
+	if tier.MinPointsEarned > 0 && stats.PointsEarned >= tier.MinPointsEarned {
+		return true
+	}
+	return tier.MinOrders > 0 && stats.OrderCount >= tier.MinOrders
+}
+
+// userTierStats sums the default points a user earned and counts the
+// fulfilled orders of their linked customers over the tier window
+func userTierStats(tx *gorm.DB, userID uint) (tierStats, error) {
+	var stats tierStats
+	since := time.Now().AddDate(0, -tierWindow, 0)
+
+	if err := tx.Model(&models.PointLedger{}).
+		Select("COALESCE(SUM(change), 0)").
+		Where("user_id = ? AND point_type = ? AND event_type IN ? AND created_at >= ?",
+			userID, models.DefaultPointType, []string{"earn", "earn_reversal"}, since).
+		Scan(&stats.PointsEarned).Error; err != nil {
+		return stats, err
+	}
+
+	statuses := make([]string, 0, len(earningOrderStatuses))
+	for status := range earningOrderStatuses {
+		statuses = append(statuses, status)
+	}
+
+	var orders int64
+	if err := tx.Model(&models.Order{}).
+		Joins("JOIN customers ON customers.id = orders.customer_id").
+		Where("customers.user_id = ? AND orders.status IN ? AND orders.order_date >= ?", userID, statuses, since).
+		Count(&orders).Error; err != nil {
+		return stats, err
+	}
+	stats.OrderCount = int(orders)
+
+	return stats, nil
+}
+
+// checkTierTransferLimit rejects a transfer that would take the sender past
+// their tier's daily limit for the point type
+func checkTierTransferLimit(tx *gorm.DB, user *models.User, pointType string, amount int) error {
+	tier, err := userTier(tx, user)
+	if err != nil {
+		return err
+	}
+	if tier == nil || tier.DailyTransferLimit == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var sent int
+	if err := tx.Model(&models.Transfer{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("from_user_id = ? AND point_type = ? AND status IN ? AND created_at >= ?",
+			user.ID, pointType, []string{"processing", "completed"}, startOfDay).
+		Scan(&sent).Error; err != nil {
+		return err
+	}
+
+	if sent+amount > tier.DailyTransferLimit {
+		return newRequestError(400, fmt.Sprintf("Daily transfer limit of %d exceeded for %s tier (%d remaining today)",
+			tier.DailyTransferLimit, tier.Name, max(tier.DailyTransferLimit-sent, 0)))
+	}
+
+	return nil
+}
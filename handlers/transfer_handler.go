@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"temp_kbtg_backend/database"
 	"temp_kbtg_backend/models"
@@ -17,6 +18,11 @@ type CreateTransferRequest struct {
 	Amount         int    `json:"amount"`
 	Note           string `json:"note"`
 	IdempotencyKey string `json:"idempotency_key"`
+	PointType      string `json:"point_type"` // Defaults to the default point type
+
+	// Escrow holds the points until POST /transfers/:id/release
+	Escrow             bool `json:"escrow"`
+	EscrowTimeoutHours int  `json:"escrow_timeout_hours"`
 }
 
 // GetTransfers returns all transfers with optional filtering
@@ -32,6 +38,9 @@ func GetTransfers(c *fiber.Ctx) error {
 	if status := c.Query("status"); status != "" {
 		query = query.Where("status = ?", status)
 	}
+	if pointType := c.Query("point_type"); pointType != "" {
+		query = query.Where("point_type = ?", pointType)
+	}
 
 	if err := query.Order("created_at DESC").Find(&transfers).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -74,60 +83,74 @@ func CreateTransfer(c *fiber.Ctx) error {
 		})
 	}
 
+	// Check for duplicate idempotency key (idempotent request)
+	var existingTransfer models.Transfer
+	if req.IdempotencyKey != "" {
+		if err := database.DB.Where("idempotency_key = ?", req.IdempotencyKey).First(&existingTransfer).Error; err == nil {
+			// Return existing transfer
+			return c.Status(200).JSON(fiber.Map{
+				"success": true,
+				"data":    existingTransfer,
+				"message": "Transfer already exists (idempotent)",
+			})
+		}
+	}
+
+	var transfer *models.Transfer
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		transfer, err = executeTransfer(tx, req)
+		return err
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to create transfer")
+	}
+
+	// Load relations for response
+	database.DB.Preload("FromUser").Preload("ToUser").First(transfer, transfer.ID)
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    transfer,
+	})
+}
+
+// executeTransfer validates req and moves the points inside tx. A regular
+// transfer completes immediately; an escrow transfer takes the points from
+// the sender and stays "processing" until it is released or refunded.
+func executeTransfer(tx *gorm.DB, req *CreateTransferRequest) (*models.Transfer, error) {
 	// Validate required fields
 	if req.FromUserID == 0 || req.ToUserID == 0 || req.Amount <= 0 || req.IdempotencyKey == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Missing required fields or invalid amount",
-		})
+		return nil, newRequestError(400, "Missing required fields or invalid amount")
 	}
 
 	// Check if users are the same
 	if req.FromUserID == req.ToUserID {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Cannot transfer to the same user",
-		})
+		return nil, newRequestError(400, "Cannot transfer to the same user")
 	}
 
-	// Check for duplicate idempotency key (idempotent request)
-	var existingTransfer models.Transfer
-	if err := database.DB.Where("idempotency_key = ?", req.IdempotencyKey).First(&existingTransfer).Error; err == nil {
-		// Return existing transfer
-		return c.Status(200).JSON(fiber.Map{
-			"success": true,
-			"data":    existingTransfer,
-			"message": "Transfer already exists (idempotent)",
-		})
+	if req.EscrowTimeoutHours < 0 {
+		return nil, newRequestError(400, "escrow_timeout_hours must be positive")
 	}
 
-	// Start transaction
-	tx := database.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
+	if req.PointType == "" {
+		req.PointType = models.DefaultPointType
+	}
+	if err := findPointType(tx, req.PointType); err != nil {
+		return nil, err
+	}
 
 	// Verify both users exist
 	var fromUser, toUser models.User
 	if err := tx.First(&fromUser, req.FromUserID).Error; err != nil {
-		tx.Rollback()
-		return c.Status(404).JSON(fiber.Map{
-			"error": "From user not found",
-		})
+		return nil, newRequestError(404, "From user not found")
 	}
 	if err := tx.First(&toUser, req.ToUserID).Error; err != nil {
-		tx.Rollback()
-		return c.Status(404).JSON(fiber.Map{
-			"error": "To user not found",
-		})
+		return nil, newRequestError(404, "To user not found")
 	}
 
-	// Check if from_user has sufficient balance
-	if fromUser.Balance < req.Amount {
-		tx.Rollback()
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Insufficient balance",
-		})
+	if err := checkTierTransferLimit(tx, &fromUser, req.PointType, req.Amount); err != nil {
+		return nil, err
 	}
 
 	// Create transfer record with status "processing"
@@ -135,71 +158,57 @@ func CreateTransfer(c *fiber.Ctx) error {
 		FromUserID:     req.FromUserID,
 		ToUserID:       req.ToUserID,
 		Amount:         req.Amount,
+		PointType:      req.PointType,
 		Status:         "processing",
 		Note:           req.Note,
 		IdempotencyKey: req.IdempotencyKey,
+		IsEscrow:       req.Escrow,
 		CreatedAt:      time.Now(),
 		UpdatedAt:      time.Now(),
 	}
 
-	if err := tx.Create(&transfer).Error; err != nil {
-		tx.Rollback()
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to create transfer",
-		})
+	if req.Escrow {
+		timeout := req.EscrowTimeoutHours
+		if timeout == 0 {
+			timeout = defaultEscrowTimeoutHours
+		}
+		expiresAt := time.Now().Add(time.Duration(timeout) * time.Hour)
+		transfer.EscrowExpiresAt = &expiresAt
 	}
 
-	// Deduct from sender
-	fromUser.Balance -= req.Amount
-	if err := tx.Save(&fromUser).Error; err != nil {
-		tx.Rollback()
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to update sender balance",
-		})
+	if err := tx.Create(&transfer).Error; err != nil {
+		return nil, err
 	}
 
-	// Add to receiver
-	toUser.Balance += req.Amount
-	if err := tx.Save(&toUser).Error; err != nil {
-		tx.Rollback()
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to update receiver balance",
-		})
+	if req.Escrow {
+		if err := holdEscrow(tx, &transfer); err != nil {
+			return nil, err
+		}
+		return &transfer, nil
 	}
 
-	// Create ledger entries
-	// 1. Deduct from sender
-	ledgerOut := models.PointLedger{
-		UserID:       req.FromUserID,
-		Change:       -req.Amount,
-		BalanceAfter: fromUser.Balance,
-		EventType:    "transfer_out",
-		TransferID:   &transfer.ID,
-		Reference:    req.IdempotencyKey,
-		CreatedAt:    time.Now(),
-	}
-	if err := tx.Create(&ledgerOut).Error; err != nil {
-		tx.Rollback()
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to create ledger entry for sender",
-		})
+	// Deduct from sender
+	if _, err := applyPoints(tx, pointEntry{
+		UserID:     req.FromUserID,
+		PointType:  transfer.PointType,
+		Change:     -req.Amount,
+		EventType:  "transfer_out",
+		TransferID: &transfer.ID,
+		Reference:  req.IdempotencyKey,
+	}); err != nil {
+		return nil, err
 	}
 
-	// 2. Add to receiver
-	ledgerIn := models.PointLedger{
-		UserID:       req.ToUserID,
-		Change:       req.Amount,
-		BalanceAfter: toUser.Balance,
-		EventType:    "transfer_in",
-		TransferID:   &transfer.ID,
-		Reference:    req.IdempotencyKey,
-		CreatedAt:    time.Now(),
-	}
-	if err := tx.Create(&ledgerIn).Error; err != nil {
-		tx.Rollback()
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to create ledger entry for receiver",
-		})
+	// Add to receiver
+	if _, err := applyPoints(tx, pointEntry{
+		UserID:     req.ToUserID,
+		PointType:  transfer.PointType,
+		Change:     req.Amount,
+		EventType:  "transfer_in",
+		TransferID: &transfer.ID,
+		Reference:  req.IdempotencyKey,
+	}); err != nil {
+		return nil, err
 	}
 
 	// Update transfer status to "completed"
@@ -208,26 +217,79 @@ func CreateTransfer(c *fiber.Ctx) error {
 	transfer.CompletedAt = &completedAt
 	transfer.UpdatedAt = time.Now()
 	if err := tx.Save(&transfer).Error; err != nil {
-		tx.Rollback()
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to complete transfer",
-		})
+		return nil, err
 	}
 
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to commit transaction",
-		})
+	if err := onTransferCompleted(tx, &transfer); err != nil {
+		return nil, err
 	}
 
-	// Load relations for response
-	database.DB.Preload("FromUser").Preload("ToUser").First(&transfer, transfer.ID)
+	return &transfer, nil
+}
 
-	return c.Status(201).JSON(fiber.Map{
-		"success": true,
-		"data":    transfer,
+// onTransferCompleted runs the rewards triggered by a completed transfer
+func onTransferCompleted(tx *gorm.DB, transfer *models.Transfer) error {
+	if err := applyCampaigns(tx, campaignEvent{
+		Trigger:    "transfer",
+		UserID:     transfer.FromUserID,
+		TransferID: &transfer.ID,
+	}); err != nil {
+		return err
+	}
+
+	return qualifyReferral(tx, transfer.FromUserID, "transfer")
+}
+
+// reverseTransfer takes the points of a completed transfer back from the
+// receiver and returns them to the sender, marking the transfer reversed
+func reverseTransfer(tx *gorm.DB, transfer *models.Transfer, reason string) error {
+	result := tx.Model(&models.Transfer{}).
+		Where("id = ? AND status = ?", transfer.ID, "completed").
+		Updates(map[string]interface{}{
+			"status":      "reversed",
+			"fail_reason": reason,
+			"updated_at":  time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return newRequestError(400, fmt.Sprintf("Cannot reverse transfer with status: %s", transfer.Status))
+	}
+
+	metadata := ledgerMetadata(map[string]interface{}{
+		"reason": reason,
 	})
+
+	if _, err := applyPoints(tx, pointEntry{
+		UserID:     transfer.ToUserID,
+		PointType:  transfer.PointType,
+		Change:     -transfer.Amount,
+		EventType:  "reversal_out",
+		TransferID: &transfer.ID,
+		Reference:  transfer.IdempotencyKey,
+		Metadata:   metadata,
+	}); err != nil {
+		var reqErr *requestError
+		if errors.As(err, &reqErr) && reqErr.Status == 400 {
+			return newRequestError(400, "Receiver has insufficient balance to reverse the transfer")
+		}
+		return err
+	}
+
+	if _, err := applyPoints(tx, pointEntry{
+		UserID:     transfer.FromUserID,
+		PointType:  transfer.PointType,
+		Change:     transfer.Amount,
+		EventType:  "reversal_in",
+		TransferID: &transfer.ID,
+		Reference:  transfer.IdempotencyKey,
+		Metadata:   metadata,
+	}); err != nil {
+		return err
+	}
+
+	return tx.First(transfer, transfer.ID).Error
 }
 
 // CancelTransfer cancels a pending or processing transfer
@@ -250,6 +312,14 @@ func CancelTransfer(c *fiber.Ctx) error {
 		})
 	}
 
+	// Escrow transfers are settled by release, timeout or dispute
+	if transfer.IsEscrow {
+		tx.Rollback()
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Escrow transfers cannot be cancelled",
+		})
+	}
+
 	// Only allow cancellation of pending or processing transfers
 	if transfer.Status != "pending" && transfer.Status != "processing" {
 		tx.Rollback()
@@ -260,35 +330,33 @@ func CancelTransfer(c *fiber.Ctx) error {
 
 	// If transfer was processing, need to reverse the points
 	if transfer.Status == "processing" {
-		var fromUser, toUser models.User
-		if err := tx.First(&fromUser, transfer.FromUserID).Error; err != nil {
-			tx.Rollback()
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to find sender",
-			})
-		}
-		if err := tx.First(&toUser, transfer.ToUserID).Error; err != nil {
-			tx.Rollback()
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to find receiver",
-			})
-		}
-
-		// Reverse the transfer
-		fromUser.Balance += transfer.Amount
-		toUser.Balance -= transfer.Amount
+		metadata := ledgerMetadata(map[string]interface{}{
+			"reason": "Transfer cancelled",
+		})
 
-		if err := tx.Save(&fromUser).Error; err != nil {
+		if _, err := applyPoints(tx, pointEntry{
+			UserID:     transfer.ToUserID,
+			PointType:  transfer.PointType,
+			Change:     -transfer.Amount,
+			EventType:  "reversal_out",
+			TransferID: &transfer.ID,
+			Reference:  transfer.IdempotencyKey,
+			Metadata:   metadata,
+		}); err != nil {
 			tx.Rollback()
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to update sender balance",
-			})
+			return sendError(c, err, "Failed to update receiver balance")
 		}
-		if err := tx.Save(&toUser).Error; err != nil {
+		if _, err := applyPoints(tx, pointEntry{
+			UserID:     transfer.FromUserID,
+			PointType:  transfer.PointType,
+			Change:     transfer.Amount,
+			EventType:  "reversal_in",
+			TransferID: &transfer.ID,
+			Reference:  transfer.IdempotencyKey,
+			Metadata:   metadata,
+		}); err != nil {
 			tx.Rollback()
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to update receiver balance",
-			})
+			return sendError(c, err, "Failed to update sender balance")
 		}
 	}
 
@@ -326,6 +394,9 @@ func GetUserLedger(c *fiber.Ctx) error {
 	if eventType := c.Query("event_type"); eventType != "" {
 		query = query.Where("event_type = ?", eventType)
 	}
+	if pointType := c.Query("point_type"); pointType != "" {
+		query = query.Where("point_type = ?", pointType)
+	}
 
 	if err := query.Order("created_at DESC").Find(&ledgers).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -5,6 +5,7 @@ import (
 	"temp_kbtg_backend/models"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 // Get all users
@@ -57,16 +58,61 @@ func CreateUser(c *fiber.Ctx) error {
 		})
 	}
 
-	// Set default balance if not provided
-	if user.Balance == 0 {
-		user.Balance = 0
+	if user.Balance < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Balance cannot be negative",
+		})
+	}
+
+	// Code of the user who referred this one, if any
+	var signup struct {
+		ReferredBy string `json:"referred_by"`
+	}
+	if err := c.BodyParser(&signup); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
 	}
 
-	if err := database.DB.Create(&user).Error; err != nil {
+	// The opening balance goes through the ledger like any other movement
+	openingBalance := user.Balance
+	user.Balance = 0
+	user.TierCode = ""
+
+	code, err := generateCode(referralCodeLength)
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to create user",
 		})
 	}
+	user.ReferralCode = code
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if signup.ReferredBy != "" {
+			if err := recordReferral(tx, user, signup.ReferredBy); err != nil {
+				return err
+			}
+		}
+		if openingBalance == 0 {
+			return nil
+		}
+
+		if _, err := applyPoints(tx, pointEntry{
+			UserID:    user.ID,
+			Change:    openingBalance,
+			EventType: "adjust",
+			Metadata:  ledgerMetadata(map[string]interface{}{"reason": "opening balance"}),
+		}); err != nil {
+			return err
+		}
+		return tx.First(&user, user.ID).Error
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to create user")
+	}
 
 	return c.Status(201).JSON(fiber.Map{
 		"success": true,
@@ -85,16 +131,40 @@ func UpdateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	currentBalance := user.Balance
+	tierCode, referralCode := user.TierCode, user.ReferralCode
+
 	if err := c.BodyParser(&user); err != nil {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Invalid request body",
 		})
 	}
-
-	if err := database.DB.Save(&user).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to update user",
-		})
+	user.TierCode, user.ReferralCode = tierCode, referralCode
+
+	// A changed balance is recorded as an adjustment of the default wallet
+	newBalance := user.Balance
+	user.Balance = currentBalance
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Balance").Save(&user).Error; err != nil {
+			return err
+		}
+		if newBalance == currentBalance {
+			return nil
+		}
+
+		if _, err := applyPoints(tx, pointEntry{
+			UserID:    user.ID,
+			Change:    newBalance - currentBalance,
+			EventType: "adjust",
+			Metadata:  ledgerMetadata(map[string]interface{}{"reason": "balance updated"}),
+		}); err != nil {
+			return err
+		}
+		return tx.First(&user, user.ID).Error
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to update user")
 	}
 
 	return c.JSON(fiber.Map{
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	voucherCodeLength  = 12
+	maxVoucherQuantity = 10000
+)
+
+// CreateVoucherBatchRequest represents the request body for generating a voucher batch
+type CreateVoucherBatchRequest struct {
+	Name      string    `json:"name"`
+	PointType string    `json:"point_type"`
+	Points    int       `json:"points"`
+	Quantity  int       `json:"quantity"`
+	MaxUses   int       `json:"max_uses"` // Defaults to 1
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// RedeemVoucherRequest represents the request body for redeeming a voucher
+type RedeemVoucherRequest struct {
+	UserID uint   `json:"user_id"`
+	Code   string `json:"code"`
+}
+
+// VoucherBatchReport summarises the codes of one batch
+type VoucherBatchReport struct {
+	BatchID     uint      `json:"batch_id"`
+	Name        string    `json:"name"`
+	PointType   string    `json:"point_type"`
+	Points      int       `json:"points"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Issued      int       `json:"issued"`      // Codes generated
+	Redeemed    int       `json:"redeemed"`    // Codes redeemed at least once
+	Redemptions int       `json:"redemptions"` // Total redemptions across all codes
+	Expired     int       `json:"expired"`     // Codes that expired without being redeemed
+	PointsSpent int       `json:"points_spent"`
+}
+
+// GetVoucherBatches returns all voucher batches without their codes
+func GetVoucherBatches(c *fiber.Ctx) error {
+	var batches []models.VoucherBatch
+
+	if err := database.DB.Order("created_at DESC").Find(&batches).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch voucher batches",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    batches,
+	})
+}
+
+// GetVoucherBatch returns a single voucher batch with its codes
+func GetVoucherBatch(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var batch models.VoucherBatch
+
+	if err := database.DB.Preload("Vouchers").First(&batch, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Voucher batch not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    batch,
+	})
+}
+
+// CreateVoucherBatch generates a batch of unique voucher codes
+func CreateVoucherBatch(c *fiber.Ctx) error {
+	req := new(CreateVoucherBatchRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Name == "" || req.Points <= 0 || req.ExpiresAt.IsZero() {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "name, points and expires_at are required",
+		})
+	}
+	if req.Quantity <= 0 || req.Quantity > maxVoucherQuantity {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("quantity must be between 1 and %d", maxVoucherQuantity),
+		})
+	}
+	if !req.ExpiresAt.After(time.Now()) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "expires_at must be in the future",
+		})
+	}
+	if req.MaxUses < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "max_uses cannot be negative",
+		})
+	}
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+	if req.PointType == "" {
+		req.PointType = models.DefaultPointType
+	}
+
+	batch := models.VoucherBatch{
+		Name:      req.Name,
+		PointType: req.PointType,
+		Points:    req.Points,
+		Quantity:  req.Quantity,
+		MaxUses:   req.MaxUses,
+		ExpiresAt: req.ExpiresAt.UTC(), // Compared with now in SQL by the report
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := findPointType(tx, batch.PointType); err != nil {
+			return err
+		}
+		if err := tx.Omit("Vouchers").Create(&batch).Error; err != nil {
+			return err
+		}
+
+		seen := make(map[string]bool, req.Quantity)
+		vouchers := make([]models.Voucher, 0, req.Quantity)
+		for len(vouchers) < req.Quantity {
+			code, err := generateCode(voucherCodeLength)
+			if err != nil {
+				return err
+			}
+			if seen[code] {
+				continue
+			}
+			seen[code] = true
+			vouchers = append(vouchers, models.Voucher{
+				BatchID:   batch.ID,
+				Code:      code,
+				MaxUses:   batch.MaxUses,
+				ExpiresAt: batch.ExpiresAt,
+			})
+		}
+
+		if err := tx.CreateInBatches(&vouchers, 500).Error; err != nil {
+			return err
+		}
+		batch.Vouchers = vouchers
+		return nil
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to create voucher batch")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    batch,
+	})
+}
+
+// RedeemVoucher credits the user with the voucher's points. The used count is
+// claimed with a conditional update and each user can redeem a code once, so
+// concurrent redemptions never exceed the code's usage limit.
+func RedeemVoucher(c *fiber.Ctx) error {
+	req := new(RedeemVoucherRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.UserID == 0 || req.Code == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "user_id and code are required",
+		})
+	}
+	code := strings.ToUpper(strings.TrimSpace(req.Code))
+
+	var ledger *models.PointLedger
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var voucher models.Voucher
+		if err := tx.Where("code = ?", code).First(&voucher).Error; err != nil {
+			return newRequestError(404, "Voucher not found")
+		}
+		if !voucher.ExpiresAt.After(time.Now()) {
+			return newRequestError(400, "Voucher has expired")
+		}
+
+		var batch models.VoucherBatch
+		if err := tx.First(&batch, voucher.BatchID).Error; err != nil {
+			return err
+		}
+
+		var user models.User
+		if err := tx.First(&user, req.UserID).Error; err != nil {
+			return newRequestError(404, "User not found")
+		}
+
+		var previous int64
+		tx.Model(&models.VoucherRedemption{}).
+			Where("voucher_id = ? AND user_id = ?", voucher.ID, user.ID).
+			Count(&previous)
+		if previous > 0 {
+			return newRequestError(409, "Voucher already redeemed by this user")
+		}
+
+		result := tx.Model(&models.Voucher{}).
+			Where("id = ? AND used_count < max_uses", voucher.ID).
+			Update("used_count", gorm.Expr("used_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return newRequestError(409, "Voucher has already been fully redeemed")
+		}
+
+		var err error
+		ledger, err = applyPoints(tx, pointEntry{
+			UserID:    user.ID,
+			PointType: batch.PointType,
+			Change:    batch.Points,
+			EventType: "earn",
+			Reference: fmt.Sprintf("voucher-%s", voucher.Code),
+			Metadata: ledgerMetadata(map[string]interface{}{
+				"voucher_id":       voucher.ID,
+				"voucher_batch_id": batch.ID,
+			}),
+		})
+		if err != nil {
+			return err
+		}
+
+		// The unique index on (voucher_id, user_id) backs up the check above
+		return tx.Create(&models.VoucherRedemption{
+			VoucherID: voucher.ID,
+			UserID:    user.ID,
+			LedgerID:  ledger.ID,
+		}).Error
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to redeem voucher")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    ledger,
+	})
+}
+
+// GetVoucherReport returns issued, redeemed and expired counts per batch
+func GetVoucherReport(c *fiber.Ctx) error {
+	var report []VoucherBatchReport
+
+	if err := database.DB.Model(&models.VoucherBatch{}).
+		Select(`voucher_batches.id AS batch_id, voucher_batches.name, voucher_batches.point_type,
+			voucher_batches.points, voucher_batches.expires_at,
+			COUNT(vouchers.id) AS issued,
+			COALESCE(SUM(CASE WHEN vouchers.used_count > 0 THEN 1 ELSE 0 END), 0) AS redeemed,
+			COALESCE(SUM(vouchers.used_count), 0) AS redemptions,
+			COALESCE(SUM(CASE WHEN vouchers.used_count = 0 AND vouchers.expires_at <= ? THEN 1 ELSE 0 END), 0) AS expired`,
+			time.Now().UTC()).
+		Joins("LEFT JOIN vouchers ON vouchers.batch_id = voucher_batches.id").
+		Group("voucher_batches.id").
+		Order("voucher_batches.created_at DESC").
+		Scan(&report).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch voucher report",
+		})
+	}
+
+	for i := range report {
+		report[i].PointsSpent = report[i].Redemptions * report[i].Points
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    report,
+	})
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"fmt"
+	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"gorm.io/gorm"
+)
+
+// ConvertPointsRequest represents the request body for converting between point types
+type ConvertPointsRequest struct {
+	FromPointType string `json:"from_point_type"`
+	ToPointType   string `json:"to_point_type"`
+	Amount        int    `json:"amount"` // Amount of from_point_type to convert
+}
+
+// GetPointTypes returns all configured point types
+func GetPointTypes(c *fiber.Ctx) error {
+	var pointTypes []models.PointType
+
+	if err := database.DB.Order("id").Find(&pointTypes).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch point types",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    pointTypes,
+	})
+}
+
+// CreatePointType adds a new point type
+func CreatePointType(c *fiber.Ctx) error {
+	pointType := new(models.PointType)
+
+	if err := c.BodyParser(pointType); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if pointType.Code == "" || pointType.Name == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Code and name are required",
+		})
+	}
+	if pointType.RedeemValue < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "redeem_value cannot be negative",
+		})
+	}
+
+	if err := database.DB.Create(&pointType).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to create point type",
+		})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"data":    pointType,
+	})
+}
+
+// UpdatePointType updates a point type's name and redeem value. The code
+// cannot change because wallets and ledger entries refer to it.
+func UpdatePointType(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var pointType models.PointType
+
+	if err := database.DB.First(&pointType, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Point type not found",
+		})
+	}
+
+	code := pointType.Code
+	if err := c.BodyParser(&pointType); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	pointType.Code = code
+
+	if pointType.Name == "" || pointType.RedeemValue < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Name is required and redeem_value cannot be negative",
+		})
+	}
+
+	if err := database.DB.Save(&pointType).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to update point type",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    pointType,
+	})
+}
+
+// GetExchangeRates returns all configured exchange rates
+func GetExchangeRates(c *fiber.Ctx) error {
+	var rates []models.ExchangeRate
+
+	if err := database.DB.Find(&rates).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch exchange rates",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    rates,
+	})
+}
+
+// SetExchangeRate creates or replaces the exchange rate for a pair of point types
+func SetExchangeRate(c *fiber.Ctx) error {
+	req := new(models.ExchangeRate)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.FromPointType == "" || req.ToPointType == "" || req.FromAmount <= 0 || req.ToAmount <= 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Missing required fields or invalid amounts",
+		})
+	}
+	if req.FromPointType == req.ToPointType {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Cannot set an exchange rate between the same point type",
+		})
+	}
+
+	var rate models.ExchangeRate
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := findPointType(tx, req.FromPointType); err != nil {
+			return err
+		}
+		if err := findPointType(tx, req.ToPointType); err != nil {
+			return err
+		}
+
+		tx.Where("from_point_type = ? AND to_point_type = ?", req.FromPointType, req.ToPointType).First(&rate)
+		rate.FromPointType = req.FromPointType
+		rate.ToPointType = req.ToPointType
+		rate.FromAmount = req.FromAmount
+		rate.ToAmount = req.ToAmount
+		return tx.Save(&rate).Error
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to set exchange rate")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    rate,
+	})
+}
+
+// GetUserWallets returns a user's wallets, including the default wallet
+func GetUserWallets(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var user models.User
+
+	if err := database.DB.First(&user, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	var wallets []models.Wallet
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := ensureWallet(tx, user.ID, models.DefaultPointType); err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Order("id").Find(&wallets).Error
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to fetch wallets")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    wallets,
+	})
+}
+
+// ConvertPoints converts points between two of a user's wallets at the
+// configured exchange rate, writing a ledger entry on each side
+func ConvertPoints(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var user models.User
+
+	if err := database.DB.First(&user, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	req := new(ConvertPointsRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.FromPointType == "" || req.ToPointType == "" || req.Amount <= 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Missing required fields or invalid amount",
+		})
+	}
+
+	var rate models.ExchangeRate
+	if err := database.DB.Where("from_point_type = ? AND to_point_type = ?", req.FromPointType, req.ToPointType).
+		First(&rate).Error; err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("No exchange rate from %s to %s", req.FromPointType, req.ToPointType),
+		})
+	}
+
+	// Only whole points can be credited, so reject amounts that would leave a remainder
+	if (req.Amount*rate.ToAmount)%rate.FromAmount != 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("amount must be a multiple of %d", rate.FromAmount/gcd(rate.FromAmount, rate.ToAmount)),
+		})
+	}
+	converted := req.Amount * rate.ToAmount / rate.FromAmount
+
+	reference := fmt.Sprintf("convert-%s", utils.UUIDv4())
+	metadata := ledgerMetadata(map[string]interface{}{
+		"from_point_type": req.FromPointType,
+		"to_point_type":   req.ToPointType,
+		"from_amount":     rate.FromAmount,
+		"to_amount":       rate.ToAmount,
+	})
+
+	var entries []*models.PointLedger
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		out, err := applyPoints(tx, pointEntry{
+			UserID:    user.ID,
+			PointType: req.FromPointType,
+			Change:    -req.Amount,
+			EventType: "convert_out",
+			Reference: reference,
+			Metadata:  metadata,
+		})
+		if err != nil {
+			return err
+		}
+
+		in, err := applyPoints(tx, pointEntry{
+			UserID:    user.ID,
+			PointType: req.ToPointType,
+			Change:    converted,
+			EventType: "convert_in",
+			Reference: reference,
+			Metadata:  metadata,
+		})
+		if err != nil {
+			return err
+		}
+
+		entries = []*models.PointLedger{out, in}
+		return nil
+	})
+	if err != nil {
+		return sendError(c, err, "Failed to convert points")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"reference": reference,
+			"debited":   req.Amount,
+			"credited":  converted,
+			"ledger":    entries,
+		},
+	})
+}
+
+// gcd returns the greatest common divisor of two positive integers
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
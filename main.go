@@ -3,7 +3,9 @@ package main
 import (
 	"log"
 	"temp_kbtg_backend/database"
+	"temp_kbtg_backend/handlers"
 	"temp_kbtg_backend/routes"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -50,6 +52,11 @@ func main() {
 	// Setup API routes
 	routes.SetupRoutes(app)
 
+	// Background jobs
+	runEvery(time.Minute, handlers.RefundExpiredEscrows)
+	runEvery(time.Hour, handlers.RecomputeTiers)
+	runEvery(10*time.Minute, handlers.ExpireCarts)
+
 	// Start server on port 3000
 	log.Printf("Server starting on http://localhost:3000")
 	log.Printf("API endpoints available at http://localhost:3000/api/v1")
@@ -57,3 +64,14 @@ func main() {
 		log.Fatalf("Error starting server: %v", err)
 	}
 }
+
+// runEvery starts a goroutine that calls job on every tick of interval
+func runEvery(interval time.Duration, job func()) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			job()
+		}
+	}()
+}
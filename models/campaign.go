@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// Campaign is a time-boxed promotion that awards bonus points on earn events
+//
+// Types:
+//   - order_multiplier: order earn points are multiplied by Multiplier
+//   - first_transfer: BonusPoints for a user's first completed transfer
+//   - segment_bonus: BonusPoints once per user, on their first earn event,
+//     for the eligible segment
+type Campaign struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"size:100;not null" json:"name"`
+	Type        string    `gorm:"size:30;not null;check:type IN ('order_multiplier','first_transfer','segment_bonus')" json:"type"`
+	PointType   string    `gorm:"size:20;not null;default:'points'" json:"point_type"`
+	Multiplier  float64   `gorm:"not null;default:1" json:"multiplier,omitempty"`   // order_multiplier only, 2 = double points
+	BonusPoints int       `gorm:"not null;default:0" json:"bonus_points,omitempty"` // first_transfer and segment_bonus
+	StartsAt    time.Time `gorm:"not null" json:"starts_at"`
+	EndsAt      time.Time `gorm:"not null" json:"ends_at"`
+	Active      bool      `gorm:"not null" json:"active"`
+
+	// Eligibility
+	MinOrderTotal    Money  `gorm:"column:min_order_total_minor;not null;default:0" json:"min_order_total"`
+	Tiers            string `gorm:"size:100" json:"tiers,omitempty"`               // Comma separated tier codes; empty = every tier
+	MaxAwardsPerUser int    `gorm:"not null;default:0" json:"max_awards_per_user"` // 0 = unlimited
+
+	// Budget
+	BudgetPoints int `gorm:"not null;default:0" json:"budget_points"` // 0 = uncapped
+	SpentPoints  int `gorm:"not null;default:0" json:"spent_points"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Relations
+	Members []CampaignMember `gorm:"foreignKey:CampaignID" json:"members,omitempty"`
+}
+
+// CampaignMember limits a campaign to a listed segment of users. Campaigns
+// without members are open to every user.
+type CampaignMember struct {
+	ID         uint `gorm:"primaryKey" json:"id"`
+	CampaignID uint `gorm:"not null;uniqueIndex:idx_campaign_member" json:"campaign_id"`
+	UserID     uint `gorm:"not null;uniqueIndex:idx_campaign_member" json:"user_id"`
+}
+
+// CampaignAward records each bonus paid out by a campaign
+type CampaignAward struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	CampaignID uint      `gorm:"not null;index:idx_campaign_awards_campaign_user" json:"campaign_id"`
+	UserID     uint      `gorm:"not null;index:idx_campaign_awards_campaign_user" json:"user_id"`
+	LedgerID   uint      `gorm:"not null" json:"ledger_id"`
+	Points     int       `gorm:"not null" json:"points"`
+	OrderID    *uint     `json:"order_id,omitempty"`
+	TransferID *uint     `json:"transfer_id,omitempty"`
+	Reversed   int       `gorm:"column:reversed_points;not null;default:0" json:"reversed_points"` // Clawed back since, e.g. when the order was cancelled
+	CreatedAt  time.Time `json:"created_at"`
+}
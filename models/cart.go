@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// Cart collects the products a customer is about to order. Items are priced
+// at the current catalog price every time the cart is read or changed;
+// stock is only taken when the cart is checked out into an order. A
+// customer has at most one active cart.
+type Cart struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	CustomerID    uint       `gorm:"not null;index:idx_carts_customer;uniqueIndex:idx_carts_active_customer,where:status = 'active'" json:"customer_id"`
+	Currency      string     `gorm:"size:3;not null;default:'THB'" json:"currency"`
+	Status        string     `gorm:"size:20;not null;default:'active';check:status IN ('active','checked_out','expired')" json:"status"`
+	Subtotal      Money      `gorm:"column:subtotal_minor;not null;default:0" json:"subtotal"`
+	DiscountTotal Money      `gorm:"column:discount_total_minor;not null;default:0" json:"discount_total"`
+	Total         Money      `gorm:"column:total_minor;not null;default:0" json:"total"` // Before tax, which is worked out at checkout
+	OrderID       *uint      `json:"order_id,omitempty"`                                 // Order the cart was checked out into
+	ExpiresAt     time.Time  `gorm:"not null;index:idx_carts_expires" json:"expires_at"`
+	CheckedOutAt  *time.Time `json:"checked_out_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// Relations
+	Items     []CartItem     `gorm:"foreignKey:CartID" json:"items"`
+	Coupons   []CartCoupon   `gorm:"foreignKey:CartID" json:"coupons"`
+	Discounts []CartDiscount `gorm:"-" json:"discounts"` // Worked out when the cart is priced
+}
+
+// CartItem is a product in a cart. Unavailable items, whose product was
+// deactivated or repriced in another currency, are not counted in the
+// totals and must be removed before checkout.
+type CartItem struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	CartID      uint   `gorm:"not null;uniqueIndex:idx_cart_items_product" json:"cart_id"`
+	ProductID   uint   `gorm:"not null;uniqueIndex:idx_cart_items_product" json:"product_id"`
+	SKU         string `gorm:"size:64" json:"sku"`
+	ProductName string `gorm:"size:100;not null" json:"product_name"`
+	Category    string `gorm:"size:50" json:"category,omitempty"`
+	Quantity    int    `gorm:"not null;check:quantity > 0" json:"quantity"`
+	UnitPrice   Money  `gorm:"column:unit_price_minor;not null;default:0" json:"unit_price"`
+	TotalPrice  Money  `gorm:"column:total_price_minor;not null;default:0" json:"total_price"`
+	Discount    Money  `gorm:"column:discount_minor;not null;default:0" json:"discount"` // Line coupon discounts
+	Available   bool   `gorm:"not null" json:"available"`
+}
+
+// CartCoupon is a coupon code entered on a cart. Its usage and customer
+// limits are only checked, and a use only taken, at checkout.
+type CartCoupon struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	CartID   uint   `gorm:"not null;uniqueIndex:idx_cart_coupons_coupon" json:"cart_id"`
+	CouponID uint   `gorm:"not null;uniqueIndex:idx_cart_coupons_coupon" json:"coupon_id"`
+	Code     string `gorm:"size:32;not null" json:"code"`
+}
+
+// CartDiscount is a discount a cart's coupons currently give
+type CartDiscount struct {
+	Code        string `json:"code"`
+	Scope       string `json:"scope"`
+	CartItemID  *uint  `json:"cart_item_id,omitempty"`
+	Description string `json:"description"`
+	Amount      Money  `json:"amount"`
+}
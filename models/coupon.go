@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// Coupon is a discount code that can be applied to orders. Percentage
+// coupons take PercentOff percent off, fixed coupons take AmountOff off.
+// Order-scoped coupons discount the order subtotal; line-scoped coupons
+// discount the line items matching SKU or Category (every item when both
+// are empty), and a fixed line discount is taken off each unit.
+type Coupon struct {
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	Code             string     `gorm:"size:32;not null;uniqueIndex" json:"code"`
+	Description      string     `gorm:"size:255" json:"description,omitempty"`
+	Type             string     `gorm:"size:20;not null;check:type IN ('percentage','fixed')" json:"type"`
+	Scope            string     `gorm:"size:20;not null;default:'order';check:scope IN ('order','line')" json:"scope"`
+	PercentOff       float64    `gorm:"not null;default:0;check:percent_off >= 0 AND percent_off <= 100" json:"percent_off"`
+	AmountOff        Money      `gorm:"column:amount_off_minor;not null;default:0" json:"amount_off"`
+	Currency         string     `gorm:"size:3;not null;default:'THB'" json:"currency"`                    // Currency of AmountOff, MinOrderTotal and MaxDiscount
+	MaxDiscount      Money      `gorm:"column:max_discount_minor;not null;default:0" json:"max_discount"` // Caps the coupon's discount per order; 0 = no cap
+	MinOrderTotal    Money      `gorm:"column:min_order_total_minor;not null;default:0" json:"min_order_total"`
+	SKU              string     `gorm:"size:64" json:"sku,omitempty"`                 // Line scope: only items with this SKU
+	Category         string     `gorm:"size:50" json:"category,omitempty"`            // Line scope: only items in this category
+	UsageLimit       int        `gorm:"not null;default:0" json:"usage_limit"`        // Orders the coupon can be used on; 0 = unlimited
+	UsedCount        int        `gorm:"not null;default:0" json:"used_count"`         // Orders it is applied to, excluding cancelled ones
+	PerCustomerLimit int        `gorm:"not null;default:0" json:"per_customer_limit"` // Orders per customer; 0 = unlimited
+	StartsAt         *time.Time `json:"starts_at,omitempty"`
+	EndsAt           *time.Time `json:"ends_at,omitempty"`
+	Active           bool       `gorm:"not null" json:"active"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// OrderCoupon records a coupon applied to an order. Coupons are evaluated
+// in the order they were applied; cancelled orders keep the record but no
+// longer count towards the coupon's limits.
+type OrderCoupon struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	OrderID    uint      `gorm:"not null;uniqueIndex:idx_order_coupons_order" json:"order_id"`
+	CouponID   uint      `gorm:"not null;uniqueIndex:idx_order_coupons_order;index:idx_order_coupons_coupon" json:"coupon_id"`
+	CustomerID uint      `gorm:"not null" json:"customer_id"`
+	Code       string    `gorm:"size:32;not null" json:"code"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// OrderDiscount is one discount amount taken off an order by a coupon,
+// either off the whole order or off a single line item. Discounts are
+// recomputed whenever the order's items change.
+type OrderDiscount struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	OrderID     uint   `gorm:"not null;index:idx_order_discounts_order" json:"order_id"`
+	CouponID    uint   `gorm:"not null" json:"coupon_id"`
+	Code        string `gorm:"size:32;not null" json:"code"`
+	Scope       string `gorm:"size:20;not null" json:"scope"`
+	LineItemID  *uint  `json:"line_item_id,omitempty"` // Set for line discounts
+	Description string `gorm:"size:255" json:"description"`
+	Amount      Money  `gorm:"column:amount_minor;not null;default:0" json:"amount"`
+}
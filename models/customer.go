@@ -1,41 +1,137 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 type Customer struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Name      string    `gorm:"size:100;not null" json:"name"`
-	Email     string    `gorm:"size:100;unique;not null" json:"email"`
-	Phone     string    `gorm:"size:20" json:"phone"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	Name            string    `gorm:"size:100;not null" json:"name"`
+	Email           string    `gorm:"size:100;unique;not null" json:"email"`
+	Phone           string    `gorm:"size:20" json:"phone"`
+	PhoneNormalized string    `gorm:"size:20;index:idx_customers_phone_normalized" json:"-"` // Phone as NormalizePhone returns it, for search
+	UserID          *uint     `gorm:"index" json:"user_id,omitempty"`                        // Points account that earns from this customer's orders
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// NormalizePhone reduces a phone number to its digits in Thai national
+// format, so "+66 81-234-5678" and "081 234 5678" both become "0812345678".
+// Numbers with another country code keep it.
+func NormalizePhone(phone string) string {
+	var b strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	digits := strings.TrimPrefix(b.String(), "00") // International dialling prefix
+	if strings.HasPrefix(digits, "66") && (len(digits) == 10 || len(digits) == 11) {
+		digits = "0" + digits[2:]
+	}
+	return digits
 }
 
 type DeliveryAddress struct {
 	ID         uint   `gorm:"primaryKey" json:"id"`
-	CustomerID uint   `gorm:"not null" json:"customer_id"`
+	CustomerID uint   `gorm:"not null;index:idx_delivery_addresses_customer;uniqueIndex:idx_delivery_addresses_default,where:is_default" json:"customer_id"` // At most one default per customer
 	Address    string `gorm:"size:255;not null" json:"address"`
 	City       string `gorm:"size:100" json:"city"`
 	PostalCode string `gorm:"size:20" json:"postal_code"`
 	Country    string `gorm:"size:100" json:"country"`
-	IsDefault  bool   `gorm:"default:false" json:"is_default"`
+	// Part of the default index so GORM doesn't also make customer_id a
+	// UNIQUE column, which it does for single-column unique indexes
+	IsDefault bool `gorm:"default:false;uniqueIndex:idx_delivery_addresses_default,where:is_default" json:"is_default"`
+}
+
+// AddressSnapshot is a copy of a delivery address taken when an order is
+// placed, so later edits to the address don't rewrite order history
+type AddressSnapshot struct {
+	Address    string `gorm:"size:255" json:"address"`
+	City       string `gorm:"size:100" json:"city"`
+	PostalCode string `gorm:"size:20" json:"postal_code"`
+	Country    string `gorm:"size:100" json:"country"`
 }
 
 type Order struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	CustomerID    uint      `gorm:"not null" json:"customer_id"`
+	OrderDate     time.Time `gorm:"not null" json:"order_date"`
+	Status        string    `gorm:"size:50;default:'pending'" json:"status"`
+	Subtotal      Money     `gorm:"column:subtotal_minor;not null;default:0" json:"subtotal"`             // Sum of the line items
+	DiscountTotal Money     `gorm:"column:discount_total_minor;not null;default:0" json:"discount_total"` // Sum of the applied discounts
+	NetTotal      Money     `gorm:"column:net_total_minor;not null;default:0" json:"net_total"`           // Total before tax
+	TaxTotal      Money     `gorm:"column:tax_total_minor;not null;default:0" json:"tax_total"`           // Sum of the line taxes
+	TotalPrice    Money     `gorm:"column:total_price_minor;not null;default:0" json:"total_price"`       // Gross: net total plus tax
+	Currency      string    `gorm:"size:3;not null;default:'THB'" json:"currency"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	// Tax rule applied, taken from the country the order ships to
+	TaxCountry       string  `gorm:"size:2" json:"tax_country,omitempty"`
+	TaxRate          float64 `gorm:"not null;default:0" json:"tax_rate"`
+	PricesIncludeTax bool    `gorm:"not null;default:false" json:"prices_include_tax"`
+
+	// Refunds of returned items; RefundStatus is partially_refunded or refunded
+	RefundedTotal Money  `gorm:"column:refunded_total_minor;not null;default:0" json:"refunded_total"`
+	RefundStatus  string `gorm:"size:20" json:"refund_status,omitempty"`
+
+	// Delivery address the order ships to, copied when it is set
+	DeliveryAddressID *uint           `json:"delivery_address_id,omitempty"`
+	ShippingAddress   AddressSnapshot `gorm:"embedded;embeddedPrefix:shipping_" json:"shipping_address"`
+
+	// Relations
+	Items     []LineItem      `gorm:"foreignKey:OrderID" json:"items,omitempty"`
+	Payments  []OrderPayment  `gorm:"foreignKey:OrderID" json:"payments,omitempty"`
+	Discounts []OrderDiscount `gorm:"foreignKey:OrderID" json:"discounts,omitempty"`
+}
+
+// OrderStatusHistory records every status change of an order
+type OrderStatusHistory struct {
 	ID         uint      `gorm:"primaryKey" json:"id"`
-	CustomerID uint      `gorm:"not null" json:"customer_id"`
-	OrderDate  time.Time `gorm:"not null" json:"order_date"`
-	Status     string    `gorm:"size:50;default:'pending'" json:"status"`
-	TotalPrice float64   `gorm:"type:decimal(10,2);default:0" json:"total_price"`
+	OrderID    uint      `gorm:"not null;index:idx_order_status_history_order" json:"order_id"`
+	FromStatus string    `gorm:"size:50" json:"from_status,omitempty"` // Empty when the order was created
+	ToStatus   string    `gorm:"size:50;not null" json:"to_status"`
+	Actor      string    `gorm:"size:100;not null" json:"actor"`
+	Reason     string    `gorm:"size:255" json:"reason,omitempty"`
 	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
 }
 
+// OrderPayment records part of an order paid with points
+type OrderPayment struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	OrderID    uint       `gorm:"not null;index:idx_order_payments_order" json:"order_id"`
+	UserID     uint       `gorm:"not null" json:"user_id"` // Points account that paid
+	Method     string     `gorm:"size:20;not null;default:'points'" json:"method"`
+	PointType  string     `gorm:"size:20;not null" json:"point_type"`
+	Points     int        `gorm:"not null;check:points > 0" json:"points"`
+	Rate       float64    `gorm:"not null" json:"rate"` // Currency value of one point at the time of payment
+	Amount     Money      `gorm:"column:amount_minor;not null;default:0" json:"amount"`
+	Status     string     `gorm:"size:20;not null;default:'applied';check:status IN ('applied','refunded')" json:"status"`
+	LedgerID   *uint      `json:"ledger_id,omitempty"`
+	RefundedAt *time.Time `json:"refunded_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// LineItem is one product on an order. The product's SKU, name, category
+// and price are copied onto the item when it is added, so later catalog
+// changes don't reprice existing orders.
 type LineItem struct {
-	ID          uint    `gorm:"primaryKey" json:"id"`
-	OrderID     uint    `gorm:"not null" json:"order_id"`
-	ProductName string  `gorm:"size:100;not null" json:"product_name"`
-	Quantity    int     `gorm:"not null" json:"quantity"`
-	UnitPrice   float64 `gorm:"type:decimal(10,2);not null" json:"unit_price"`
-	TotalPrice  float64 `gorm:"type:decimal(10,2)" json:"total_price"`
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	OrderID     uint   `gorm:"not null;index:idx_line_items_order" json:"order_id"`
+	ProductID   *uint  `gorm:"index:idx_line_items_product" json:"product_id,omitempty"` // Empty on items added before the catalog existed
+	SKU         string `gorm:"size:64" json:"sku,omitempty"`
+	ProductName string `gorm:"size:100;not null" json:"product_name"`
+	Category    string `gorm:"size:50" json:"category,omitempty"`
+	Quantity    int    `gorm:"not null" json:"quantity"`
+	UnitPrice   Money  `gorm:"column:unit_price_minor;not null;default:0" json:"unit_price"`
+	TotalPrice  Money  `gorm:"column:total_price_minor;not null;default:0" json:"total_price"`       // Quantity x UnitPrice, computed by the server
+	Shipped     int    `gorm:"column:shipped_quantity;not null;default:0" json:"shipped_quantity"`   // Units packed in shipments so far
+	Returned    int    `gorm:"column:returned_quantity;not null;default:0" json:"returned_quantity"` // Units on returns that were not rejected
+
+	// Tax breakdown, computed by the server after discounts
+	Discount Money `gorm:"column:discount_minor;not null;default:0" json:"discount"` // Line discounts plus this line's share of order discounts
+	Net      Money `gorm:"column:net_minor;not null;default:0" json:"net"`
+	Tax      Money `gorm:"column:tax_minor;not null;default:0" json:"tax"`
 }
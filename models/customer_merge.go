@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// CustomerMerge records a duplicate customer merged into another. The
+// duplicate's row is deleted; its orders, addresses and other records move
+// to the surviving customer, and lookups of its ID redirect there.
+type CustomerMerge struct {
+	ID       uint `gorm:"primaryKey" json:"id"`
+	SourceID uint `gorm:"not null;uniqueIndex:idx_customer_merges_source" json:"source_id"` // Duplicate that was merged away
+	TargetID uint `gorm:"not null;index:idx_customer_merges_target" json:"target_id"`       // Customer it was merged into
+
+	// The duplicate as it was before the merge
+	Name   string `gorm:"size:100;not null" json:"name"`
+	Email  string `gorm:"size:100;not null" json:"email"`
+	Phone  string `gorm:"size:20" json:"phone,omitempty"`
+	UserID *uint  `json:"user_id,omitempty"` // Moved to the target, which had none or the same; other merges are refused
+
+	// Records moved to the target
+	Orders    int `gorm:"not null;default:0" json:"orders"`
+	Addresses int `gorm:"not null;default:0" json:"addresses"`
+
+	Actor     string    `gorm:"size:100;not null" json:"actor"`
+	Reason    string    `gorm:"size:255" json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"0812345678", "0812345678"},
+		{"081-234-5678", "0812345678"},
+		{"081 234 5678", "0812345678"},
+		{"+66 81-234-5678", "0812345678"},
+		{"+66812345678", "0812345678"},
+		{"0066 81 234 5678", "0812345678"},
+		{"+66 2 123 4567", "021234567"}, // Bangkok landline
+		{"(02) 123-4567", "021234567"},
+		{"+1 415 555 0100", "14155550100"},
+		{"66", "66"},
+		{"", ""},
+		{"n/a", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizePhone(tt.in); got != tt.want {
+			t.Errorf("NormalizePhone(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
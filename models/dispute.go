@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Dispute represents a claim that a transfer was unauthorized or mistaken
+type Dispute struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	TransferID     uint       `gorm:"not null;index:idx_disputes_transfer" json:"transfer_id"`
+	OpenedByUserID uint       `gorm:"not null" json:"opened_by_user_id"`
+	Reason         string     `gorm:"size:20;not null;check:reason IN ('unauthorized','mistaken','other')" json:"reason"`
+	Description    string     `gorm:"type:text" json:"description,omitempty"`
+	Status         string     `gorm:"size:20;not null;default:'open';check:status IN ('open','under_review','resolved_refund','resolved_rejected')" json:"status"`
+	Resolution     string     `gorm:"type:text" json:"resolution,omitempty"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt      time.Time  `gorm:"not null" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"not null" json:"updated_at"`
+
+	// Relations
+	Transfer *Transfer     `gorm:"foreignKey:TransferID" json:"transfer,omitempty"`
+	Notes    []DisputeNote `gorm:"foreignKey:DisputeID" json:"notes,omitempty"`
+}
+
+// DisputeNote is a piece of evidence or a support comment on a dispute
+type DisputeNote struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	DisputeID uint      `gorm:"not null;index:idx_dispute_notes_dispute" json:"dispute_id"`
+	Author    string    `gorm:"size:100;not null" json:"author"`
+	Note      string    `gorm:"type:text;not null" json:"note"`
+	CreatedAt time.Time `gorm:"not null" json:"created_at"`
+}
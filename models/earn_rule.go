@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// EarnRule configures how many points an order earns. Every active rule is
+// applied, so separate rules can award different point types.
+type EarnRule struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	PointType string    `gorm:"size:20;not null;default:'points'" json:"point_type"`
+	Rate      float64   `gorm:"not null;check:rate >= 0" json:"rate"`                       // Points per 1.00 of spend
+	MinSpend  Money     `gorm:"column:min_spend_minor;not null;default:0" json:"min_spend"` // Orders below this earn nothing
+	Active    bool      `gorm:"not null" json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Relations
+	CategoryMultipliers []EarnRuleCategory `gorm:"foreignKey:EarnRuleID" json:"category_multipliers"`
+}
+
+// EarnRuleCategory multiplies the rate for line items of one category
+type EarnRuleCategory struct {
+	ID         uint    `gorm:"primaryKey" json:"id"`
+	EarnRuleID uint    `gorm:"not null;uniqueIndex:idx_earn_rule_category" json:"earn_rule_id"`
+	Category   string  `gorm:"size:50;not null;uniqueIndex:idx_earn_rule_category" json:"category"`
+	Multiplier float64 `gorm:"not null;check:multiplier >= 0" json:"multiplier"`
+}
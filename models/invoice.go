@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// Invoice is a finance document issued for an order: an invoice when the
+// order is confirmed, or a credit note reversing all or part of it. It is a
+// snapshot; later changes to the order, customer or address don't alter it.
+// Amounts on credit notes are positive and are credited to the customer.
+type Invoice struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	Number    string `gorm:"size:20;not null;uniqueIndex" json:"number"` // e.g. INV-2025-000001
+	Type      string `gorm:"size:20;not null;check:type IN ('invoice','credit_note')" json:"type"`
+	OrderID   uint   `gorm:"not null;index:idx_invoices_order;uniqueIndex:idx_invoices_order_invoice,where:type = 'invoice'" json:"order_id"` // One invoice per order
+	InvoiceID *uint  `json:"invoice_id,omitempty"`                                                                                            // Invoice a credit note reverses
+	Reason    string `gorm:"size:255" json:"reason,omitempty"`
+
+	// Customer and address as they were when the document was issued
+	CustomerID    uint            `gorm:"not null" json:"customer_id"`
+	CustomerName  string          `gorm:"size:100;not null" json:"customer_name"`
+	CustomerEmail string          `gorm:"size:100" json:"customer_email"`
+	CustomerPhone string          `gorm:"size:20" json:"customer_phone,omitempty"`
+	Address       AddressSnapshot `gorm:"embedded;embeddedPrefix:address_" json:"address"`
+
+	Currency         string  `gorm:"size:3;not null" json:"currency"`
+	Subtotal         Money   `gorm:"column:subtotal_minor;not null;default:0" json:"subtotal"`
+	DiscountTotal    Money   `gorm:"column:discount_total_minor;not null;default:0" json:"discount_total"`
+	NetTotal         Money   `gorm:"column:net_total_minor;not null;default:0" json:"net_total"`
+	TaxTotal         Money   `gorm:"column:tax_total_minor;not null;default:0" json:"tax_total"`
+	Total            Money   `gorm:"column:total_minor;not null;default:0" json:"total"`
+	TaxCountry       string  `gorm:"size:2" json:"tax_country,omitempty"`
+	TaxRate          float64 `gorm:"not null;default:0" json:"tax_rate"`
+	PricesIncludeTax bool    `gorm:"not null;default:false" json:"prices_include_tax"`
+
+	IssuedAt time.Time `gorm:"not null" json:"issued_at"`
+
+	// Relations
+	Lines     []InvoiceLine     `gorm:"foreignKey:InvoiceID" json:"lines"`
+	Discounts []InvoiceDiscount `gorm:"foreignKey:InvoiceID" json:"discounts"`
+}
+
+// InvoiceLine is a line item as it was invoiced
+type InvoiceLine struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	InvoiceID   uint   `gorm:"not null;index:idx_invoice_lines_invoice" json:"invoice_id"`
+	LineItemID  *uint  `json:"line_item_id,omitempty"`
+	SKU         string `gorm:"size:64" json:"sku,omitempty"`
+	Description string `gorm:"size:100;not null" json:"description"`
+	Quantity    int    `gorm:"not null" json:"quantity"`
+	UnitPrice   Money  `gorm:"column:unit_price_minor;not null;default:0" json:"unit_price"`
+	Total       Money  `gorm:"column:total_minor;not null;default:0" json:"total"`
+	Discount    Money  `gorm:"column:discount_minor;not null;default:0" json:"discount"`
+	Net         Money  `gorm:"column:net_minor;not null;default:0" json:"net"`
+	Tax         Money  `gorm:"column:tax_minor;not null;default:0" json:"tax"`
+}
+
+// InvoiceDiscount is a coupon discount as it was invoiced
+type InvoiceDiscount struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	InvoiceID   uint   `gorm:"not null;index:idx_invoice_discounts_invoice" json:"invoice_id"`
+	Code        string `gorm:"size:32;not null" json:"code"`
+	Description string `gorm:"size:255" json:"description"`
+	Amount      Money  `gorm:"column:amount_minor;not null;default:0" json:"amount"`
+}
+
+// DocumentSequence hands out gap-free document numbers per series, e.g.
+// INV-2025. Numbers are taken inside the transaction that creates the
+// document, so a rolled back document gives its number back.
+type DocumentSequence struct {
+	Series     string `gorm:"primaryKey;size:20" json:"series"`
+	LastNumber int    `gorm:"not null;default:0" json:"last_number"`
+}
@@ -0,0 +1,216 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of orders that do not name one
+const DefaultCurrency = "THB"
+
+// SupportedCurrencies are the ISO 4217 currencies orders can be placed in.
+// All of them have two decimal places, which is the scale Money uses.
+var SupportedCurrencies = map[string]bool{
+	"THB": true,
+	"USD": true,
+	"EUR": true,
+	"GBP": true,
+	"SGD": true,
+	"MYR": true,
+}
+
+// Money is an exact amount in minor units (satang, cents). It is stored as an
+// integer so sums never drift, and written to JSON as a number with two
+// decimals (1500.50) so clients that expect floats keep working.
+//
+// Rounding rule: input is refused if it is finer than a minor unit; amounts
+// computed from floats or rates are rounded half away from zero.
+type Money int64
+
+// moneyPattern matches plain decimal amounts with at most two decimals
+var moneyPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]{1,2})?$`)
+
+// ParseMoney parses a decimal amount such as "1500.5" or "-3.35". Anything
+// else, including fractions ("1/3"), exponents ("1e3") and amounts finer
+// than a minor unit ("3.335"), is rejected.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if !moneyPattern.MatchString(s) {
+		return 0, fmt.Errorf("invalid money amount %q: use a decimal number with at most two decimals", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("invalid money amount %q", s)
+	}
+	return moneyFromRat(r)
+}
+
+// MoneyFromFloat converts a float amount, rounding to the nearest minor unit.
+// The float's shortest decimal form is used so 1.005 rounds to 1.01.
+func MoneyFromFloat(f float64) Money {
+	r := ratFromFloat(f)
+	if r == nil {
+		return 0
+	}
+	m, err := moneyFromRat(r)
+	if err != nil {
+		return 0
+	}
+	return m
+}
+
+// moneyFromRat rounds r to minor units, half away from zero
+func moneyFromRat(r *big.Rat) (Money, error) {
+	scaled := new(big.Rat).Mul(r, big.NewRat(100, 1))
+	num, den := scaled.Num(), scaled.Denom()
+
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	// Round half away from zero: compare 2*|rem| with den
+	twice := new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2))
+	if twice.Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+
+	if !quo.IsInt64() {
+		return 0, errors.New("money amount out of range")
+	}
+	return Money(quo.Int64()), nil
+}
+
+// Float returns the amount in major units. Use it only for display or for
+// rates such as points earned per unit spent.
+func (m Money) Float() float64 {
+	return float64(m) / 100
+}
+
+// Mul multiplies the amount by a whole quantity
+func (m Money) Mul(quantity int) Money {
+	return m * Money(quantity)
+}
+
+// Percent returns pct percent of the amount, rounded to the nearest minor unit
+func (m Money) Percent(pct float64) Money {
+	// pct/100 of m minor units is m*pct/10000 major units
+	return m.scale(ratFromFloat(pct), big.NewRat(10000, 1))
+}
+
+// TaxIncluded returns the tax contained in an amount that includes tax at
+// rate percent, i.e. amount*rate/(100+rate), rounded to the nearest minor unit
+func (m Money) TaxIncluded(rate float64) Money {
+	r := ratFromFloat(rate)
+	den := new(big.Rat).Add(r, big.NewRat(100, 1))
+	return m.scale(r, den.Mul(den, big.NewRat(100, 1)))
+}
+
+// Share returns part/whole of the amount, rounded to the nearest minor unit.
+// It is used to spread an amount over lines in proportion to their value.
+func (m Money) Share(part, whole Money) Money {
+	if whole == 0 {
+		return 0
+	}
+	return m.scale(big.NewRat(int64(part), 1), big.NewRat(int64(whole)*100, 1))
+}
+
+// scale returns m*num/den major units rounded to minor units
+func (m Money) scale(num, den *big.Rat) Money {
+	if num == nil || den.Sign() == 0 {
+		return 0
+	}
+	r := new(big.Rat).Mul(big.NewRat(int64(m), 1), num)
+	v, err := moneyFromRat(r.Quo(r, den))
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// ratFromFloat converts f exactly as written in its shortest decimal form
+func ratFromFloat(f float64) *big.Rat {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	if !ok {
+		return nil
+	}
+	return r
+}
+
+// String formats the amount with two decimals, e.g. "1500.50"
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+// MarshalJSON writes the amount as a JSON number with two decimals
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a decimal string
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" || s == "" {
+		*m = 0
+		return nil
+	}
+
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value stores the amount as integer minor units
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
+
+// Scan reads integer minor units. Aggregates that SQLite returns as floats
+// or text are converted exactly.
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v)
+	case float64:
+		*m = Money(int64(v + 0.5*sign(v)))
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", value)
+	}
+	return nil
+}
+
+func (m *Money) scanString(s string) error {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("cannot scan %q into Money: %w", s, err)
+	}
+	*m = Money(n)
+	return nil
+}
+
+func sign(f float64) float64 {
+	if f < 0 {
+		return -1
+	}
+	return 1
+}
@@ -0,0 +1,139 @@
+package models
+
+import "testing"
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{"1500.5", 150050, false},
+		{"1500.50", 150050, false},
+		{"0", 0, false},
+		{"-3.35", -335, false},
+		{" 12 ", 1200, false},
+		{"3.335", 0, true},
+		{"1/3", 0, true},
+		{"1e3", 0, true},
+		{"+5", 0, true},
+		{".5", 0, true},
+		{"5.", 0, true},
+		{"", 0, true},
+		{"abc", 0, true},
+		{"99999999999999999999", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMoney(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyPercent(t *testing.T) {
+	tests := []struct {
+		m    Money
+		pct  float64
+		want Money
+	}{
+		{100000, 10, 10000},
+		{999, 10, 100},  // 0.999 rounds up
+		{1005, 50, 503}, // 5.025 rounds half away from zero
+		{-1005, 50, -503},
+		{12345, 0, 0},
+		{12345, 100, 12345},
+		{3333, 33.3, 1110},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.Percent(tt.pct); got != tt.want {
+			t.Errorf("Money(%d).Percent(%g) = %d, want %d", tt.m, tt.pct, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyTaxIncluded(t *testing.T) {
+	tests := []struct {
+		m    Money
+		rate float64
+		want Money
+	}{
+		{10700, 7, 700},
+		{150000, 7, 9813}, // 98.130841...
+		{100, 7, 7},       // 0.0654...
+		{10000, 0, 0},
+		{12000, 20, 2000},
+		{-10700, 7, -700},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.TaxIncluded(tt.rate); got != tt.want {
+			t.Errorf("Money(%d).TaxIncluded(%g) = %d, want %d", tt.m, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyShare(t *testing.T) {
+	tests := []struct {
+		m           Money
+		part, whole Money
+		want        Money
+	}{
+		{1000, 1, 3, 333},
+		{1000, 2, 3, 667},
+		{1000, 3, 3, 1000},
+		{1000, 0, 3, 0},
+		{1000, 1, 0, 0},
+		{5, 1, 2, 3}, // 2.5 rounds half away from zero
+		{-5, 1, 2, -3},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.Share(tt.part, tt.whole); got != tt.want {
+			t.Errorf("Money(%d).Share(%d, %d) = %d, want %d", tt.m, tt.part, tt.whole, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyFromFloat(t *testing.T) {
+	tests := []struct {
+		f    float64
+		want Money
+	}{
+		{1500.5, 150050},
+		{1.005, 101},
+		{0.1 + 0.2, 30},
+		{33.335, 3334},
+		{-2.675, -268},
+	}
+
+	for _, tt := range tests {
+		if got := MoneyFromFloat(tt.f); got != tt.want {
+			t.Errorf("MoneyFromFloat(%g) = %d, want %d", tt.f, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{150050, "1500.50"},
+		{5, "0.05"},
+		{0, "0.00"},
+		{-335, "-3.35"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", tt.m, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// PaymentCode is a one-time code a user hands out to receive points,
+// e.g. shown as a QR code at a POS terminal
+type PaymentCode struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Code       string     `gorm:"size:16;not null;uniqueIndex" json:"code"`
+	UserID     uint       `gorm:"not null;index:idx_payment_codes_user" json:"user_id"` // Recipient
+	Amount     int        `gorm:"not null;default:0;check:amount >= 0" json:"amount"`   // 0 = payer chooses the amount
+	Payload    string     `gorm:"size:255;not null" json:"payload"`                     // QR-friendly payload with checksum
+	Status     string     `gorm:"size:20;not null;default:'active';check:status IN ('active','used','expired')" json:"status"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt     *time.Time `json:"used_at,omitempty"`
+	TransferID *uint      `json:"transfer_id,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	// Relations
+	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
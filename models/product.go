@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Product is a catalog item that orders are placed against. Stock is the
+// number of units that can still be ordered; it is taken when an order is
+// placed and given back when the order is cancelled.
+type Product struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	SKU       string    `gorm:"size:64;not null;uniqueIndex" json:"sku"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	Category  string    `gorm:"size:50" json:"category,omitempty"` // Matched by earn rule category multipliers
+	Price     Money     `gorm:"column:price_minor;not null;default:0" json:"price"`
+	Currency  string    `gorm:"size:3;not null;default:'THB'" json:"currency"`
+	Stock     int       `gorm:"not null;default:0;check:stock >= 0" json:"stock"`
+	Active    bool      `gorm:"not null" json:"active"` // Inactive products cannot be ordered
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// ReferralConfig holds the points paid out when a referred user completes a
+// qualifying action. There is a single row.
+type ReferralConfig struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	PointType      string    `gorm:"size:20;not null;default:'points'" json:"point_type"`
+	ReferrerPoints int       `gorm:"not null;default:0" json:"referrer_points"`
+	RefereePoints  int       `gorm:"not null;default:0" json:"referee_points"`
+	Active         bool      `gorm:"not null" json:"active"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Referral links a new user to the user whose referral code they signed up with
+type Referral struct {
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	ReferrerID       uint       `gorm:"not null;index:idx_referrals_referrer" json:"referrer_id"`
+	RefereeID        uint       `gorm:"not null;uniqueIndex" json:"referee_id"`
+	Code             string     `gorm:"size:20;not null" json:"code"`
+	Status           string     `gorm:"size:20;not null;default:'pending';check:status IN ('pending','rewarded','rejected')" json:"status"`
+	RejectReason     string     `gorm:"size:255" json:"reject_reason,omitempty"`
+	QualifyingAction string     `gorm:"size:20" json:"qualifying_action,omitempty"` // order or transfer
+	ReferrerPoints   int        `gorm:"not null;default:0" json:"referrer_points"`
+	RefereePoints    int        `gorm:"not null;default:0" json:"referee_points"`
+	RewardedAt       *time.Time `json:"rewarded_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+
+	// Relations
+	Referrer User `gorm:"foreignKey:ReferrerID" json:"referrer,omitempty"`
+	Referee  User `gorm:"foreignKey:RefereeID" json:"referee,omitempty"`
+}
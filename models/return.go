@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// OrderReturn is a customer's request to send back shipped line items (an
+// RMA). Staff approve it, receive the goods, which go back into stock, and
+// refund it either as money or as points.
+type OrderReturn struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	OrderID    uint   `gorm:"not null;index:idx_order_returns_order" json:"order_id"`
+	CustomerID uint   `gorm:"not null" json:"customer_id"`
+	Status     string `gorm:"size:20;not null;default:'requested';check:status IN ('requested','approved','rejected','received','refunded')" json:"status"`
+	Reason     string `gorm:"size:255;not null" json:"reason"`
+	Note       string `gorm:"type:text" json:"note,omitempty"`                      // Staff comments
+	Amount     Money  `gorm:"column:amount_minor;not null;default:0" json:"amount"` // Gross value of the returned items
+
+	// Refund, set when the return is refunded
+	RefundMethod    string `gorm:"size:20" json:"refund_method,omitempty"` // money or points
+	RefundPoints    int    `gorm:"not null;default:0" json:"refund_points,omitempty"`
+	RefundPointType string `gorm:"size:20" json:"refund_point_type,omitempty"`
+	LedgerID        *uint  `json:"ledger_id,omitempty"`      // Points credited
+	CreditNoteID    *uint  `json:"credit_note_id,omitempty"` // Credit note issued for the refund
+
+	UpdatedBy  string     `gorm:"size:100" json:"updated_by,omitempty"`
+	ApprovedAt *time.Time `json:"approved_at,omitempty"`
+	ReceivedAt *time.Time `json:"received_at,omitempty"`
+	RefundedAt *time.Time `json:"refunded_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	// Relations
+	Items []ReturnItem `gorm:"foreignKey:ReturnID" json:"items"`
+}
+
+// ReturnItem is a quantity of a line item being returned, with its share of
+// the line's discount, net amount and tax
+type ReturnItem struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	ReturnID    uint   `gorm:"not null;index:idx_return_items_return" json:"return_id"`
+	LineItemID  uint   `gorm:"not null;index:idx_return_items_line_item" json:"line_item_id"`
+	SKU         string `gorm:"size:64" json:"sku,omitempty"`
+	ProductName string `gorm:"size:100;not null" json:"product_name"`
+	Quantity    int    `gorm:"not null;check:quantity > 0" json:"quantity"`
+	UnitPrice   Money  `gorm:"column:unit_price_minor;not null;default:0" json:"unit_price"`
+	Discount    Money  `gorm:"column:discount_minor;not null;default:0" json:"discount"`
+	Net         Money  `gorm:"column:net_minor;not null;default:0" json:"net"`
+	Tax         Money  `gorm:"column:tax_minor;not null;default:0" json:"tax"`
+}
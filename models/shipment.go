@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Shipment is a parcel handed to a carrier with some or all of an order's
+// items. An order may ship in several parcels; its status follows them.
+type Shipment struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	OrderID        uint       `gorm:"not null;index:idx_shipments_order" json:"order_id"`
+	Carrier        string     `gorm:"size:50;not null;uniqueIndex:idx_shipments_tracking" json:"carrier"`
+	TrackingNumber string     `gorm:"size:100;not null;uniqueIndex:idx_shipments_tracking" json:"tracking_number"`
+	Status         string     `gorm:"size:30;not null;default:'shipped'" json:"status"`
+	StatusAt       time.Time  `gorm:"not null" json:"status_at"` // When the carrier reported the current status
+	ShippedAt      time.Time  `gorm:"not null" json:"shipped_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Relations
+	Items  []ShipmentItem  `gorm:"foreignKey:ShipmentID" json:"items"`
+	Events []ShipmentEvent `gorm:"foreignKey:ShipmentID" json:"events"`
+}
+
+// ShipmentItem is the quantity of a line item packed in a shipment
+type ShipmentItem struct {
+	ID         uint `gorm:"primaryKey" json:"id"`
+	ShipmentID uint `gorm:"not null;index:idx_shipment_items_shipment" json:"shipment_id"`
+	LineItemID uint `gorm:"not null" json:"line_item_id"`
+	Quantity   int  `gorm:"not null;check:quantity > 0" json:"quantity"`
+}
+
+// ShipmentEvent is a tracking update of a shipment, as reported by its
+// carrier. A carrier resending the same update is recorded once.
+type ShipmentEvent struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	ShipmentID  uint      `gorm:"not null;uniqueIndex:idx_shipment_events_dedupe" json:"shipment_id"`
+	Status      string    `gorm:"size:30;not null;uniqueIndex:idx_shipment_events_dedupe" json:"status"`
+	OccurredAt  time.Time `gorm:"not null;uniqueIndex:idx_shipment_events_dedupe" json:"occurred_at"`
+	Location    string    `gorm:"size:100" json:"location,omitempty"`
+	Description string    `gorm:"size:255" json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
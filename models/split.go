@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// SplitBill groups the transfers that settle one payer's cost between several users
+type SplitBill struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	SplitID     string     `gorm:"size:64;not null;uniqueIndex" json:"split_id"`
+	PayerUserID uint       `gorm:"not null;index:idx_split_bills_payer" json:"payer_user_id"`
+	TotalAmount int        `gorm:"not null;check:total_amount > 0" json:"total_amount"`
+	Mode        string     `gorm:"size:20;not null;check:mode IN ('equal','custom')" json:"mode"`
+	Note        string     `gorm:"type:text" json:"note,omitempty"`
+	Status      string     `gorm:"size:20;not null;default:'open';check:status IN ('open','settled')" json:"status"`
+	CreatedAt   time.Time  `gorm:"not null" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"not null" json:"updated_at"`
+	SettledAt   *time.Time `json:"settled_at,omitempty"`
+
+	// Progress summary, filled in by the handlers
+	PaidCount        int `gorm:"-" json:"paid_count"`
+	ParticipantCount int `gorm:"-" json:"participant_count"`
+
+	// Relations
+	Payer        User               `gorm:"foreignKey:PayerUserID" json:"payer,omitempty"`
+	Participants []SplitParticipant `gorm:"foreignKey:SplitBillID" json:"participants,omitempty"`
+}
+
+// SplitParticipant is one user's share of a split bill
+type SplitParticipant struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	SplitBillID uint       `gorm:"not null;uniqueIndex:idx_split_participant" json:"split_bill_id"`
+	UserID      uint       `gorm:"not null;uniqueIndex:idx_split_participant" json:"user_id"`
+	Amount      int        `gorm:"not null;check:amount > 0" json:"amount"`
+	Status      string     `gorm:"size:20;not null;default:'pending';check:status IN ('pending','paid')" json:"status"`
+	TransferID  *uint      `json:"transfer_id,omitempty"` // Transfer that settled this share
+	PaidAt      *time.Time `json:"paid_at,omitempty"`
+
+	// Relations
+	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// TaxRule is the sales tax charged on orders shipped to a country. With
+// PricesIncludeTax the catalog price already contains the tax and it is
+// backed out of the price; otherwise it is added on top.
+type TaxRule struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	Country          string    `gorm:"size:2;not null;uniqueIndex" json:"country"`          // ISO 3166-1 alpha-2
+	Name             string    `gorm:"size:50;not null" json:"name"`                        // e.g. VAT, GST
+	Rate             float64   `gorm:"not null;check:rate >= 0 AND rate < 100" json:"rate"` // Percent
+	PricesIncludeTax bool      `gorm:"not null" json:"prices_include_tax"`
+	Active           bool      `gorm:"not null" json:"active"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
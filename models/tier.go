@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Tier is a membership level such as Silver, Gold or Platinum. A user holds
+// the highest ranked tier whose thresholds they meet over a rolling 12 months.
+type Tier struct {
+	ID                 uint      `gorm:"primaryKey" json:"id"`
+	Code               string    `gorm:"size:20;not null;uniqueIndex" json:"code"`
+	Name               string    `gorm:"size:100;not null" json:"name"`
+	Rank               int       `gorm:"not null;uniqueIndex" json:"rank"`               // Higher rank = better tier
+	MinPointsEarned    int       `gorm:"not null;default:0" json:"min_points_earned"`    // 0 = not used
+	MinOrders          int       `gorm:"not null;default:0" json:"min_orders"`           // 0 = not used
+	EarnMultiplier     float64   `gorm:"not null;default:1" json:"earn_multiplier"`      // Applied on top of earn rules
+	DailyTransferLimit int       `gorm:"not null;default:0" json:"daily_transfer_limit"` // 0 = unlimited
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// UserTierHistory records every change of a user's tier
+type UserTierHistory struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	UserID       uint      `gorm:"not null;index:idx_tier_history_user" json:"user_id"`
+	FromTier     string    `gorm:"size:20" json:"from_tier,omitempty"`
+	ToTier       string    `gorm:"size:20;not null" json:"to_tier"`
+	PointsEarned int       `gorm:"not null" json:"points_earned"` // Rolling 12 month figures at the time of the change
+	OrderCount   int       `gorm:"not null" json:"order_count"`
+	ChangedAt    time.Time `gorm:"not null" json:"changed_at"`
+}
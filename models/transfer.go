@@ -4,12 +4,14 @@ import "time"
 
 // User represents a user in the system who can send/receive points
 type User struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Name      string    `gorm:"size:100;not null" json:"name"`
-	Email     string    `gorm:"size:100;unique;not null" json:"email"`
-	Balance   int       `gorm:"default:0;not null" json:"balance"` // Current point balance
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Name         string    `gorm:"size:100;not null" json:"name"`
+	Email        string    `gorm:"size:100;unique;not null" json:"email"`
+	Balance      int       `gorm:"default:0;not null" json:"balance"`                  // Current balance of the default wallet
+	TierCode     string    `gorm:"size:20" json:"tier_code,omitempty"`                 // Maintained by the tier recompute job
+	ReferralCode string    `gorm:"size:20;uniqueIndex" json:"referral_code,omitempty"` // Code other users sign up with
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 // Transfer represents a point transfer between users
@@ -18,6 +20,7 @@ type Transfer struct {
 	FromUserID     uint       `gorm:"not null;index:idx_transfers_from" json:"from_user_id"`
 	ToUserID       uint       `gorm:"not null;index:idx_transfers_to" json:"to_user_id"`
 	Amount         int        `gorm:"not null;check:amount > 0" json:"amount"`
+	PointType      string     `gorm:"size:20;not null;default:'points'" json:"point_type"`
 	Status         string     `gorm:"size:20;not null;check:status IN ('pending','processing','completed','failed','cancelled','reversed')" json:"status"`
 	Note           string     `gorm:"type:text" json:"note,omitempty"`
 	IdempotencyKey string     `gorm:"size:255;not null;uniqueIndex" json:"idempotency_key"` // Used as ID in GET /transfers/{id}
@@ -25,7 +28,14 @@ type Transfer struct {
 	UpdatedAt      time.Time  `gorm:"not null" json:"updated_at"`
 	CompletedAt    *time.Time `json:"completed_at,omitempty"`
 	FailReason     string     `gorm:"type:text" json:"fail_reason,omitempty"`
-	
+
+	// Escrow transfers hold the sender's points until released or refunded
+	IsEscrow        bool       `gorm:"not null;default:false" json:"is_escrow"`
+	EscrowExpiresAt *time.Time `gorm:"index:idx_transfers_escrow_expires" json:"escrow_expires_at,omitempty"`
+
+	// Set once a dispute has been opened against the transfer
+	IsDisputed bool `gorm:"not null;default:false" json:"is_disputed"`
+
 	// Relations
 	FromUser User `gorm:"foreignKey:FromUserID" json:"from_user,omitempty"`
 	ToUser   User `gorm:"foreignKey:ToUserID" json:"to_user,omitempty"`
@@ -37,8 +47,11 @@ type PointLedger struct {
 	UserID       uint      `gorm:"not null;index:idx_ledger_user" json:"user_id"`
 	Change       int       `gorm:"not null" json:"change"` // +receive / -send
 	BalanceAfter int       `gorm:"not null" json:"balance_after"`
-	EventType    string    `gorm:"size:20;not null;check:event_type IN ('transfer_out','transfer_in','adjust','earn','redeem')" json:"event_type"`
+	PointType    string    `gorm:"size:20;not null;default:'points';index:idx_ledger_point_type" json:"point_type"`
+	WalletID     *uint     `gorm:"index:idx_ledger_wallet" json:"wallet_id,omitempty"`
+	EventType    string    `gorm:"size:20;not null;check:event_type IN ('transfer_out','transfer_in','adjust','earn','redeem','escrow_hold','escrow_release','escrow_refund','reversal_out','reversal_in','convert_out','convert_in','earn_reversal','redeem_refund','return_refund')" json:"event_type"`
 	TransferID   *uint     `gorm:"index:idx_ledger_transfer" json:"transfer_id,omitempty"` // Reference to transfers.id (internal ID)
+	OrderID      *uint     `gorm:"index:idx_ledger_order" json:"order_id,omitempty"`       // Reference to orders.id for earn/redeem events
 	Reference    string    `gorm:"size:255" json:"reference,omitempty"`
 	Metadata     string    `gorm:"type:text" json:"metadata,omitempty"` // JSON text
 	CreatedAt    time.Time `gorm:"not null;index:idx_ledger_created" json:"created_at"`
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// VoucherBatch is a set of voucher codes generated together with the same
+// point value, usage limit and expiry
+type VoucherBatch struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	PointType string    `gorm:"size:20;not null;default:'points'" json:"point_type"`
+	Points    int       `gorm:"not null;check:points > 0" json:"points"` // Credited per redemption
+	Quantity  int       `gorm:"not null" json:"quantity"`
+	MaxUses   int       `gorm:"not null;default:1;check:max_uses > 0" json:"max_uses"` // Redemptions allowed per code
+	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Relations
+	Vouchers []Voucher `gorm:"foreignKey:BatchID" json:"vouchers,omitempty"`
+}
+
+// Voucher is a single redeemable code. UsedCount only ever increases through
+// a conditional update, so a code is never redeemed more than MaxUses times.
+type Voucher struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	BatchID   uint      `gorm:"not null;index:idx_vouchers_batch" json:"batch_id"`
+	Code      string    `gorm:"size:20;not null;uniqueIndex" json:"code"`
+	MaxUses   int       `gorm:"not null" json:"max_uses"`
+	UsedCount int       `gorm:"not null;default:0" json:"used_count"`
+	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// VoucherRedemption records a user redeeming a voucher. A user can redeem
+// each code at most once.
+type VoucherRedemption struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	VoucherID uint      `gorm:"not null;uniqueIndex:idx_voucher_redemptions_user" json:"voucher_id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_voucher_redemptions_user" json:"user_id"`
+	LedgerID  uint      `gorm:"not null" json:"ledger_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// DefaultPointType is the point type behind User.Balance and transfers that
+// do not name a point type
+const DefaultPointType = "points"
+
+// PointType is a points programme such as shop points or airline miles
+type PointType struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Code        string    `gorm:"size:20;not null;uniqueIndex" json:"code"`
+	Name        string    `gorm:"size:100;not null" json:"name"`
+	RedeemValue float64   `gorm:"not null;default:0" json:"redeem_value"` // Value of one point in DefaultCurrency; 0 = not redeemable
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Wallet holds a user's balance of one point type. The default wallet is
+// mirrored into User.Balance.
+type Wallet struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_wallets_user_type" json:"user_id"`
+	PointType string    `gorm:"size:20;not null;uniqueIndex:idx_wallets_user_type" json:"point_type"`
+	Balance   int       `gorm:"default:0;not null" json:"balance"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ExchangeRate converts FromAmount points of one type into ToAmount points of another
+type ExchangeRate struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	FromPointType string    `gorm:"size:20;not null;uniqueIndex:idx_exchange_rates_pair" json:"from_point_type"`
+	ToPointType   string    `gorm:"size:20;not null;uniqueIndex:idx_exchange_rates_pair" json:"to_point_type"`
+	FromAmount    int       `gorm:"not null;check:from_amount > 0" json:"from_amount"`
+	ToAmount      int       `gorm:"not null;check:to_amount > 0" json:"to_amount"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
@@ -13,10 +13,20 @@ func SetupRoutes(app *fiber.App) {
 	// Customer routes
 	customers := api.Group("/customers")
 	customers.Get("/", handlers.GetCustomers)
+	customers.Get("/search", handlers.SearchCustomers)
 	customers.Get("/:id", handlers.GetCustomer)
 	customers.Post("/", handlers.CreateCustomer)
 	customers.Put("/:id", handlers.UpdateCustomer)
 	customers.Delete("/:id", handlers.DeleteCustomer)
+	customers.Get("/:id/addresses", handlers.GetCustomerAddresses)
+	customers.Post("/:id/addresses", handlers.CreateCustomerAddress)
+	customers.Put("/:id/addresses/:addressId", handlers.UpdateCustomerAddress)
+	customers.Delete("/:id/addresses/:addressId", handlers.DeleteCustomerAddress)
+	customers.Get("/:id/cart", handlers.GetCustomerCart)
+	customers.Get("/:id/orders", handlers.GetCustomerOrders)
+	customers.Get("/:id/duplicates", handlers.GetCustomerDuplicates)
+	customers.Get("/:id/merges", handlers.GetCustomerMerges)
+	customers.Post("/:id/merge", handlers.MergeCustomer)
 
 	// Order routes
 	orders := api.Group("/orders")
@@ -25,6 +35,81 @@ func SetupRoutes(app *fiber.App) {
 	orders.Post("/", handlers.CreateOrder)
 	orders.Put("/:id", handlers.UpdateOrder)
 	orders.Delete("/:id", handlers.DeleteOrder)
+	orders.Post("/:id/pay-with-points", handlers.PayOrderWithPoints)
+	orders.Get("/:id/transitions", handlers.GetOrderTransitions)
+	orders.Post("/:id/transitions", handlers.TransitionOrder)
+	orders.Get("/:id/items", handlers.GetOrderItems)
+	orders.Post("/:id/items", handlers.CreateOrderItem)
+	orders.Put("/:id/items/:itemId", handlers.UpdateOrderItem)
+	orders.Delete("/:id/items/:itemId", handlers.DeleteOrderItem)
+	orders.Post("/:id/coupons", handlers.ApplyOrderCoupon)
+	orders.Delete("/:id/coupons/:code", handlers.RemoveOrderCoupon)
+	orders.Get("/:id/invoice", handlers.GetOrderInvoice)
+	orders.Get("/:id/credit-notes", handlers.GetOrderCreditNotes)
+	orders.Get("/:id/shipments", handlers.GetOrderShipments)
+	orders.Post("/:id/shipments", handlers.CreateOrderShipment)
+	orders.Get("/:id/returns", handlers.GetOrderReturns)
+	orders.Post("/:id/returns", handlers.CreateOrderReturn)
+
+	// Cart routes
+	carts := api.Group("/carts")
+	carts.Post("/", handlers.CreateCart)
+	carts.Get("/:id", handlers.GetCart)
+	carts.Post("/:id/items", handlers.AddCartItem)
+	carts.Put("/:id/items/:itemId", handlers.UpdateCartItem)
+	carts.Delete("/:id/items/:itemId", handlers.DeleteCartItem)
+	carts.Post("/:id/coupons", handlers.ApplyCartCoupon)
+	carts.Delete("/:id/coupons/:code", handlers.RemoveCartCoupon)
+	carts.Post("/:id/checkout", handlers.CheckoutCart)
+
+	// Invoice routes; invoices are issued by the order lifecycle
+	invoices := api.Group("/invoices")
+	invoices.Get("/:number", handlers.GetInvoice)
+
+	// Shipment routes; carriers push tracking updates here
+	shipments := api.Group("/shipments")
+	shipments.Post("/events", handlers.IngestShipmentEvent)
+
+	// Return routes
+	returns := api.Group("/returns")
+	returns.Get("/", handlers.GetReturns)
+	returns.Get("/:id", handlers.GetReturn)
+	returns.Post("/:id/approve", handlers.ApproveReturn)
+	returns.Post("/:id/reject", handlers.RejectReturn)
+	returns.Post("/:id/receive", handlers.ReceiveReturn)
+	returns.Post("/:id/refund", handlers.RefundReturn)
+
+	// Product routes
+	products := api.Group("/products")
+	products.Get("/", handlers.GetProducts)
+	products.Get("/:id", handlers.GetProduct)
+	products.Post("/", handlers.CreateProduct)
+	products.Put("/:id", handlers.UpdateProduct)
+	products.Delete("/:id", handlers.DeleteProduct)
+	products.Post("/:id/stock", handlers.AdjustProductStock)
+
+	// Coupon routes
+	coupons := api.Group("/coupons")
+	coupons.Get("/", handlers.GetCoupons)
+	coupons.Get("/:id", handlers.GetCoupon)
+	coupons.Post("/", handlers.CreateCoupon)
+	coupons.Put("/:id", handlers.UpdateCoupon)
+	coupons.Delete("/:id", handlers.DeleteCoupon)
+
+	// Tax rule routes
+	taxRules := api.Group("/tax-rules")
+	taxRules.Get("/", handlers.GetTaxRules)
+	taxRules.Post("/", handlers.CreateTaxRule)
+	taxRules.Put("/:id", handlers.UpdateTaxRule)
+	taxRules.Delete("/:id", handlers.DeleteTaxRule)
+
+	// Earn rule routes
+	earnRules := api.Group("/earn-rules")
+	earnRules.Get("/", handlers.GetEarnRules)
+	earnRules.Get("/:id", handlers.GetEarnRule)
+	earnRules.Post("/", handlers.CreateEarnRule)
+	earnRules.Put("/:id", handlers.UpdateEarnRule)
+	earnRules.Delete("/:id", handlers.DeleteEarnRule)
 
 	// User routes
 	users := api.Group("/users")
@@ -34,13 +119,68 @@ func SetupRoutes(app *fiber.App) {
 	users.Put("/:id", handlers.UpdateUser)
 	users.Delete("/:id", handlers.DeleteUser)
 	users.Get("/:id/balance", handlers.GetUserBalance)
+	users.Post("/:id/payment-codes", handlers.CreatePaymentCode)
+	users.Get("/:id/wallets", handlers.GetUserWallets)
+	users.Post("/:id/wallets/convert", handlers.ConvertPoints)
+	users.Get("/:id/tier", handlers.GetUserTier)
+	users.Get("/:id/referrals", handlers.GetUserReferrals)
+
+	// Point type and exchange rate routes
+	pointTypes := api.Group("/point-types")
+	pointTypes.Get("/", handlers.GetPointTypes)
+	pointTypes.Post("/", handlers.CreatePointType)
+	pointTypes.Put("/:id", handlers.UpdatePointType)
+
+	exchangeRates := api.Group("/exchange-rates")
+	exchangeRates.Get("/", handlers.GetExchangeRates)
+	exchangeRates.Put("/", handlers.SetExchangeRate)
+
+	// Campaign routes
+	campaigns := api.Group("/campaigns")
+	campaigns.Get("/", handlers.GetCampaigns)
+	campaigns.Get("/report", handlers.GetCampaignReport)
+	campaigns.Get("/:id", handlers.GetCampaign)
+	campaigns.Post("/", handlers.CreateCampaign)
+	campaigns.Put("/:id", handlers.UpdateCampaign)
+
+	// Referral routes
+	referrals := api.Group("/referrals")
+	referrals.Get("/config", handlers.GetReferralConfig)
+	referrals.Put("/config", handlers.UpdateReferralConfig)
+
+	// Voucher routes
+	vouchers := api.Group("/vouchers")
+	vouchers.Get("/batches", handlers.GetVoucherBatches)
+	vouchers.Get("/batches/:id", handlers.GetVoucherBatch)
+	vouchers.Post("/batches", handlers.CreateVoucherBatch)
+	vouchers.Get("/report", handlers.GetVoucherReport)
+	vouchers.Post("/redeem", handlers.RedeemVoucher)
+
+	// Membership tier routes
+	tiers := api.Group("/tiers")
+	tiers.Get("/", handlers.GetTiers)
+	tiers.Put("/:id", handlers.UpdateTier)
 
 	// Transfer routes
 	transfers := api.Group("/transfers")
+	transfers.Post("/split", handlers.CreateSplit)
+	transfers.Get("/split/:id", handlers.GetSplit)
+	transfers.Post("/split/:id/pay", handlers.PaySplit)
+	transfers.Post("/pay-by-code", handlers.PayByCode)
 	transfers.Get("/", handlers.GetTransfers)
 	transfers.Get("/:id", handlers.GetTransfer)
 	transfers.Post("/", handlers.CreateTransfer)
 	transfers.Delete("/:id", handlers.CancelTransfer)
+	transfers.Post("/:id/release", handlers.ReleaseTransfer)
+	transfers.Post("/:id/disputes", handlers.CreateDispute)
+
+	// Dispute routes
+	disputes := api.Group("/disputes")
+	disputes.Get("/", handlers.GetDisputes)
+	disputes.Get("/:id", handlers.GetDispute)
+	disputes.Post("/:id/notes", handlers.AddDisputeNote)
+	disputes.Post("/:id/review", handlers.ReviewDispute)
+	disputes.Post("/:id/resolve", handlers.ResolveDispute)
 
 	// Point Ledger routes
 	api.Get("/users/:user_id/ledger", handlers.GetUserLedger)